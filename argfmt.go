@@ -54,19 +54,17 @@ func ParseArgFmt(argfmt types.Expr) (*ArgFmt, error) {
 		// bind arguments
 		result := &ArgFmt{}
 		for _, arg := range a.List {
+			if lit, ok := literalArg(arg.E); ok {
+				result.Args = append(result.Args, lit)
+				continue
+			}
 			switch r := arg.E.(type) {
-			case types.Int:
-				result.Args = append(result.Args, Arg{"", types.TypeInt, arg.E})
-			case types.Str:
-				result.Args = append(result.Args, Arg{"", types.TypeStr, arg.E})
-			case types.Bool:
-				result.Args = append(result.Args, Arg{"", types.TypeBool, arg.E})
 			case *types.Sexpr:
-				if !r.Empty() {
-					return nil, fmt.Errorf("Unexpected non-empty list in a list of arguments")
-				}
-				result.Args = append(result.Args, Arg{"", types.TypeList, arg.E})
+				return nil, fmt.Errorf("Unexpected non-empty list in a list of arguments")
 			case types.Ident:
+				if strings.HasPrefix(string(r), "=") && (len(r) == 1 || strings.Contains(string(r), ":")) {
+					return nil, fmt.Errorf("Expected name of constant in argument %v", string(r))
+				}
 				if colon := strings.Index(string(r), ":"); colon >= 0 {
 					tp, ok := types.ParseType(string(r)[colon:])
 					if !ok {
@@ -85,6 +83,69 @@ func ParseArgFmt(argfmt types.Expr) (*ArgFmt, error) {
 
 }
 
+// literalArg returns argument matching the literal value.
+func literalArg(e types.Expr) (Arg, bool) {
+	switch r := e.(type) {
+	case types.Int:
+		return Arg{"", types.TypeInt, e}, true
+	case types.Str:
+		return Arg{"", types.TypeStr, e}, true
+	case types.Bool:
+		return Arg{"", types.TypeBool, e}, true
+	case *types.Sexpr:
+		if r.Empty() {
+			return Arg{"", types.TypeList, e}, true
+		}
+	}
+	return Arg{}, false
+}
+
+// constPattern returns name of constant if argument matches its value: (=name).
+func (a Arg) constPattern() (string, bool) {
+	if a.T != types.TypeUnknown || !strings.HasPrefix(a.Name, "=") {
+		return "", false
+	}
+	return a.Name[1:], true
+}
+
+// bindConsts replaces arguments matching constants with their values.
+func (a *ArgFmt) bindConsts(consts map[string]*types.Value) {
+	for n, arg := range a.Args {
+		name, ok := arg.constPattern()
+		if !ok {
+			continue
+		}
+		if c, ok := consts[name]; ok {
+			if lit, ok := literalArg(c.E); ok {
+				a.Args[n] = lit
+			}
+		}
+	}
+}
+
+func argfmtString(a *ArgFmt) string {
+	if a == nil {
+		return "()"
+	}
+	if a.Wildcard != "" {
+		return a.Wildcard
+	}
+	items := make([]string, 0, len(a.Args))
+	for _, arg := range a.Args {
+		b := &strings.Builder{}
+		if arg.V != nil {
+			printLiteral(b, arg.V)
+		} else {
+			b.WriteString(arg.Name)
+			if arg.T != types.TypeUnknown {
+				b.WriteString(arg.T.String())
+			}
+		}
+		items = append(items, b.String())
+	}
+	return "(" + strings.Join(items, " ") + ")"
+}
+
 type Param struct {
 	T types.Type
 	V types.Expr
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Assertions used in tests (see "spil test").
+
+// (assert= expected actual)
+func (in *Interpret) FAssertEq(args []types.Value) (*types.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("assert=: expected 2 arguments, found %v", args)
+	}
+	if !types.Equal(args[0].E, args[1].E) {
+		return nil, fmt.Errorf("assert= failed:\n%v", diffValues(args[0].E, args[1].E))
+	}
+	return &types.Value{E: types.Bool(true), T: types.TypeBool}, nil
+}
+
+// (assert-error func ["message"]) calls function without arguments and expects it to fail.
+func (in *Interpret) FAssertError(args []types.Value) (*types.Value, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("assert-error: expected function and optional message, found %v", args)
+	}
+	name, ok := args[0].E.(types.Ident)
+	if !ok {
+		return nil, fmt.Errorf("assert-error: expected function, found %v", args[0])
+	}
+	fn, ok := in.funcs[string(name)]
+	if !ok {
+		return nil, fmt.Errorf("assert-error: unknown function: %v", name)
+	}
+	res, err := fn.Eval(nil)
+	// exit stops the program, it is not an error to assert
+	var exit *exitError
+	if errors.As(err, &exit) {
+		return nil, err
+	}
+	if err == nil {
+		b := &strings.Builder{}
+		printLiteral(b, res.E)
+		return nil, fmt.Errorf("assert-error failed: expected error, found value %v", b)
+	}
+	if len(args) == 2 {
+		msg, ok := args[1].E.(types.Str)
+		if !ok {
+			return nil, fmt.Errorf("assert-error: expected message to be string, found %v", args[1])
+		}
+		if !strings.Contains(err.Error(), string(msg)) {
+			return nil, fmt.Errorf("assert-error failed: expected error containing %q, found: %v", string(msg), err)
+		}
+	}
+	return &types.Value{E: types.Bool(true), T: types.TypeBool}, nil
+}
+
+// (assert-type value :type)
+func (in *Interpret) FAssertType(args []types.Value) (*types.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("assert-type: expected 2 arguments, found %v", args)
+	}
+	id, ok := args[1].E.(types.Ident)
+	if !ok {
+		return nil, fmt.Errorf("assert-type: expected type, found %v", args[1])
+	}
+	t, err := in.parseType(string(id))
+	if err != nil {
+		return nil, fmt.Errorf("assert-type: %v", err)
+	}
+	if ok, err := in.canConvertType(args[0].T, t); !ok || err != nil {
+		b := &strings.Builder{}
+		printLiteral(b, args[0].E)
+		return nil, fmt.Errorf("assert-type failed: expected type %v, found %v (%v)", t, args[0].T, b)
+	}
+	return &types.Value{E: types.Bool(true), T: types.TypeBool}, nil
+}
+
+// diffValues shows printed values and marks the first difference.
+func diffValues(exp, act types.Expr) string {
+	eb, ab := &strings.Builder{}, &strings.Builder{}
+	printLiteral(eb, exp)
+	printLiteral(ab, act)
+	e, a := eb.String(), ab.String()
+	el, al := strings.Split(e, "\n"), strings.Split(a, "\n")
+	if len(el) == 1 && len(al) == 1 {
+		pos := 0
+		for pos < len(e) && pos < len(a) && e[pos] == a[pos] {
+			pos++
+		}
+		return fmt.Sprintf("expected: %v\nactual:   %v\n          %v^", e, a, strings.Repeat(" ", pos))
+	}
+	b := &strings.Builder{}
+	for i := 0; i < len(el) || i < len(al); i++ {
+		switch {
+		case i >= len(al):
+			fmt.Fprintf(b, "- %v\n", el[i])
+		case i >= len(el):
+			fmt.Fprintf(b, "+ %v\n", al[i])
+		case el[i] != al[i]:
+			fmt.Fprintf(b, "- %v\n+ %v\n", el[i], al[i])
+		default:
+			fmt.Fprintf(b, "  %v\n", el[i])
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Ahead-of-time translation of SPIL programs into Go.
+//
+// "spil build" creates Go module containing the interpreter runtime
+// and main.go with function bodies translated from bytecode into Go code.
+
+// Runtime files of built programs: the interpreter without commands and tools.
+// Files added to the interpreter should be listed here if built programs need them,
+// otherwise in buildToolSources of build_test.go.
+// Coverage, the debugger and the profiler are replaced with stubs (see buildstubs.go).
+//
+//go:embed argfmt.go asserts.go buildstubs.go cli.go compiler.go const.go diag.go doc.go
+//go:embed eachline.go exit.go functions.go interpreter.go io.go lazy.go manifest.go module.go
+//go:embed native.go package.go parser.go quickcheck.go udf.go vm.go
+//go:embed types/*.go library/*.go
+var runtimeSources embed.FS
+
+// stubsConstraint excludes buildstubs.go from the interpreter.
+const stubsConstraint = "//go:build spilstubs\n\n"
+
+const runtimeModule = "github.com/avoronkov/spil"
+
+func buildCommand(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "output directory (default: name of the program)")
+	flags.BoolVar(&bigint, "big", bigint, "use big math")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil build [-o dir] [-big] file.lisp\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	fname := flags.Arg(0)
+	dir := *output
+	if dir == "" {
+		dir = strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
+	}
+	if err := buildProgram(fname, dir); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func buildProgram(fname, dir string) error {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	file, err := filepath.Abs(fname)
+	if err != nil {
+		return err
+	}
+	in := NewInterpreter(os.Stdout)
+	in.UseBigInt(bigint)
+	in.PluginDir = pluginDir
+	in.IncludeDirs = searchDirs(in.PluginDir)
+	if err := in.Parse(file, strings.NewReader(string(data))); err != nil {
+		return err
+	}
+	errs, warnings := in.Check()
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", w)
+	}
+	if len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return fmt.Errorf("%v", strings.Join(msgs, "\n"))
+	}
+	if !noOpt {
+		for _, w := range in.Optimize() {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", w)
+		}
+	}
+	in.Compile()
+
+	if err := writeRuntime(dir); err != nil {
+		return err
+	}
+	out, err := os.Create(filepath.Join(dir, "main.go"))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return in.GenerateGo(out, filepath.Base(fname), moduleName(dir))
+}
+
+var moduleNameRe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func moduleName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	name := strings.Trim(moduleNameRe.ReplaceAllString(filepath.Base(abs), "-"), ".-")
+	if name == "" {
+		name = "spilprog"
+	}
+	return name
+}
+
+// writeRuntime creates Go module with interpreter sources.
+func writeRuntime(dir string) error {
+	module := moduleName(dir)
+	err := fs.WalkDir(runtimeSources, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(file, "_test.go") {
+			return nil
+		}
+		data, err := runtimeSources.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		src := strings.TrimPrefix(string(data), stubsConstraint)
+		src = strings.ReplaceAll(src, `"`+runtimeModule+`/`, `"`+module+`/`)
+		target := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, []byte(src), 0644)
+	})
+	if err != nil {
+		return err
+	}
+	gomod := fmt.Sprintf("module %v\n\ngo 1.16\n", module)
+	return ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0644)
+}
+
+// GenerateGo writes main.go of the program.
+// It should be called after Compile.
+func (in *Interpret) GenerateGo(w io.Writer, source, module string) error {
+	g := &goGen{in: in, setup: &strings.Builder{}, bodies: &strings.Builder{}}
+	if err := g.program(); err != nil {
+		return err
+	}
+	_, bigint := in.intMaker.(*types.BigIntMaker)
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, `// Code generated by "spil build %v"; DO NOT EDIT.
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	"%v/types"
+)
+
+func main() {
+	log.SetOutput(ioutil.Discard)
+	in := NewInterpreter(os.Stdout)
+	in.UseBigInt(%v)
+	setupProgram(in)
+	os.Exit(in.exitStatus(in.RunArgs(os.Args[1:])))
+}
+
+func setupProgram(in *Interpret) {
+%v}
+%v`, source, module, bigint, g.setup, g.bodies)
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("Generated code is incorrect: %v", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+type goGen struct {
+	in     *Interpret
+	setup  *strings.Builder
+	bodies *strings.Builder
+	// number of generated functions
+	count int
+}
+
+func (g *goGen) program() error {
+	in := g.in
+	fresh := NewInterpreter(ioutil.Discard)
+	var names []string
+	for name, fn := range in.funcs {
+		if _, ok := fn.(*FuncInterpret); ok {
+			names = append(names, name)
+		} else if _, bound := in.nativeBindings[name]; bound {
+			continue
+		} else if _, builtin := fresh.funcs[name]; !builtin {
+			return fmt.Errorf("%v: plugin functions are not supported by spil build", name)
+		}
+	}
+	sort.Strings(names)
+
+	s := g.setup
+	fmt.Fprintf(s, "\tin.types = %v\n", typeMap(in.types))
+	fmt.Fprintf(s, "\tin.typeAliases = %v\n", typeMap(in.typeAliases))
+	var docs []string
+	for t, doc := range in.typeDocs {
+		docs = append(docs, fmt.Sprintf("%q: %q", string(t), doc))
+	}
+	sort.Strings(docs)
+	fmt.Fprintf(s, "\tin.typeDocs = map[types.Type]string{%v}\n", strings.Join(docs, ", "))
+	var contracts []string
+	for c := range in.contracts {
+		contracts = append(contracts, fmt.Sprintf("%q: {}", string(c)))
+	}
+	sort.Strings(contracts)
+	fmt.Fprintf(s, "\tin.contracts = map[types.Type]struct{}{%v}\n", strings.Join(contracts, ", "))
+	if in.quickcheckSeed != 0 {
+		fmt.Fprintf(s, "\tin.quickcheckSeed = %d\n", in.quickcheckSeed)
+	}
+	fmt.Fprintf(s, "\tvar f *FuncInterpret\n")
+	for _, name := range names {
+		if err := g.function(in.funcs[name].(*FuncInterpret)); err != nil {
+			return err
+		}
+		fmt.Fprintf(s, "\tin.funcs[%q] = f\n", name)
+	}
+	var bound []string
+	for name := range in.nativeBindings {
+		bound = append(bound, name)
+	}
+	sort.Strings(bound)
+	for _, name := range bound {
+		fmt.Fprintf(s, "\tin.funcs[%q] = in.funcs[%q]\n", name, in.nativeBindings[name])
+	}
+	if err := g.function(in.main); err != nil {
+		return err
+	}
+	fmt.Fprintf(s, "\tin.main = f\n")
+	fmt.Fprintf(s, "\tin.linkNative()\n")
+	return nil
+}
+
+func typeMap(m map[types.Type]types.Type) string {
+	items := make([]string, 0, len(m))
+	for k, v := range m {
+		items = append(items, fmt.Sprintf("%q: %q", string(k), string(v)))
+	}
+	sort.Strings(items)
+	return "map[types.Type]types.Type{" + strings.Join(items, ", ") + "}"
+}
+
+func (g *goGen) function(fi *FuncInterpret) error {
+	fmt.Fprintf(g.setup, "\tf = NewFuncInterpret(in, %q)\n", fi.name)
+	for idx, impl := range fi.bodies {
+		argfmt, err := goArgFmt(impl.argfmt)
+		if err != nil {
+			return fmt.Errorf("%v: %v", fi.name, err)
+		}
+		body := "nil"
+		code := "nil"
+		if impl.code != nil {
+			if code, err = g.code(impl.code, fmt.Sprintf("clause %v of %q", idx+1, fi.name)); err != nil {
+				return fmt.Errorf("%v: %v", fi.name, err)
+			}
+		} else if body, err = goValues(impl.body); err != nil {
+			return fmt.Errorf("%v: %v", fi.name, err)
+		}
+		fmt.Fprintf(g.setup, "\tf.addNative(%v, %v, %v, %q, %v)\n", argfmt, body, impl.memo, string(impl.returnType), code)
+		if impl.doc != "" {
+			fmt.Fprintf(g.setup, "\tf.bodies[%d].doc = %q\n", idx, impl.doc)
+		}
+	}
+	return nil
+}
+
+// code generates vmCode literal with function translated into Go.
+func (g *goGen) code(c *vmCode, descr string) (string, error) {
+	fname := fmt.Sprintf("body%d", g.count)
+	g.count++
+	if err := g.body(fname, c, descr); err != nil {
+		return "", err
+	}
+	consts, err := goValues(c.consts)
+	if err != nil {
+		return "", err
+	}
+	var callees []string
+	for _, cl := range c.callees {
+		callees = append(callees, fmt.Sprintf("{name: %q, slot: %d}", cl.name, cl.slot))
+	}
+	var lambdas []string
+	for i, l := range c.lambdas {
+		var body, code string
+		if l.code != nil {
+			body = "nil"
+			if code, err = g.code(l.code, fmt.Sprintf("lambda %v in %v", i+1, descr)); err != nil {
+				return "", err
+			}
+		} else {
+			code = "nil"
+			if body, err = goValues(l.body); err != nil {
+				return "", err
+			}
+		}
+		lambdas = append(lambdas, fmt.Sprintf("{body: %v, code: %v, free: %v, freeSlots: %v}", body, code, goStrings(l.free), goInts(l.freeSlots)))
+	}
+	var slotOf []string
+	for n, s := range c.slotOf {
+		slotOf = append(slotOf, fmt.Sprintf("%q: %d", n, s))
+	}
+	sort.Strings(slotOf)
+	var casts []string
+	for _, t := range c.casts {
+		casts = append(casts, strconv.Quote(string(t)))
+	}
+	return fmt.Sprintf(`&vmCode{
+		consts:   %v,
+		names:    %v,
+		casts:    []types.Type{%v},
+		callees:  []vmCallee{%v},
+		lambdas:  []*vmLambda{%v},
+		nslots:   %d,
+		maxStack: %d,
+		varArgs:  %d,
+		slotOf:   map[string]int{%v},
+		argSlots: %v,
+		wildcard: %d,
+		argsSlot: %d,
+		posSlots: %v,
+		native:   %v,
+	}`, consts, goStrings(c.names), strings.Join(casts, ", "), strings.Join(callees, ", "),
+		strings.Join(lambdas, ", "), c.nslots, c.maxStack, c.varArgs, strings.Join(slotOf, ", "),
+		goInts(c.argSlots), c.wildcard, c.argsSlot, goInts(c.posSlots), fname), nil
+}
+
+// body translates bytecode into Go function.
+func (g *goGen) body(fname string, c *vmCode, descr string) error {
+	targets := make(map[int]bool)
+	tail := false
+	for _, ins := range c.instrs {
+		switch ins.op {
+		case opJump, opJumpIfFalse, opJumpIfTrue:
+			targets[ins.a] = true
+		case opTailCall, opTailApply:
+			targets[0] = true
+			tail = true
+		}
+	}
+	b := g.bodies
+	fmt.Fprintf(b, "\n// %v\nfunc %v(m *vmFrame) (*types.Value, error) {\n", descr, fname)
+	if tail {
+		fmt.Fprintf(b, "\tself := m.code\n")
+	}
+	for pc, ins := range c.instrs {
+		if targets[pc] {
+			fmt.Fprintf(b, "L%d:\n", pc)
+		}
+		switch ins.op {
+		case opConst:
+			fmt.Fprintf(b, "\tm.push(m.code.consts[%d])\n", ins.a)
+		case opLoad:
+			fmt.Fprintf(b, "\tm.load(%d, %d)\n", ins.a, ins.b)
+		case opLoadName:
+			fmt.Fprintf(b, "\tm.push(m.loadName(%q))\n", c.names[ins.a])
+		case opStore:
+			fmt.Fprintf(b, "\tm.slots[%d] = m.pop()\n", ins.a)
+		case opStoreScoped:
+			fmt.Fprintf(b, "\tm.storeScoped(%d)\n", ins.a)
+		case opCast:
+			fmt.Fprintf(b, "\tif err := m.cast(%d); err != nil {\n\t\treturn nil, err\n\t}\n", ins.a)
+		case opPop:
+			fmt.Fprintf(b, "\tm.pop()\n")
+		case opJump:
+			fmt.Fprintf(b, "\tgoto L%d\n", ins.a)
+		case opJumpIfFalse, opJumpIfTrue:
+			neg := "!"
+			if ins.op == opJumpIfTrue {
+				neg = ""
+			}
+			fmt.Fprintf(b, "\tif cond, err := m.cond(%d); err != nil {\n\t\treturn nil, err\n\t} else if %vcond {\n\t\tgoto L%d\n\t}\n", ins.b, neg, ins.a)
+		case opCall:
+			fmt.Fprintf(b, "\tif err := m.call(%d, %d); err != nil {\n\t\treturn nil, err\n\t}\n", ins.a, ins.b)
+		case opApply:
+			fmt.Fprintf(b, "\tif err := m.apply(%d); err != nil {\n\t\treturn nil, err\n\t}\n", ins.a)
+		case opTailCall, opTailApply:
+			fmt.Fprintf(b, "\tif res, err := m.tailCall(%v, %d); err != nil || res != nil {\n\t\treturn res, err\n\t}\n", ins.op == opTailApply, ins.b)
+			fmt.Fprintf(b, "\tif m.code == self {\n\t\tgoto L0\n\t}\n\treturn nil, errTailCall\n")
+		case opGen, opGenHashable:
+			fmt.Fprintf(b, "\tif err := m.gen(%d, %v); err != nil {\n\t\treturn nil, err\n\t}\n", ins.b, ins.op == opGenHashable)
+		case opLambda:
+			fmt.Fprintf(b, "\tm.push(m.makeLambda(m.code.lambdas[%d]))\n", ins.a)
+		case opReturn:
+			fmt.Fprintf(b, "\treturn m.ret(), nil\n")
+		default:
+			return fmt.Errorf("unexpected instruction: %v", ins)
+		}
+	}
+	if n := len(c.instrs); n == 0 || !isTerminating(c.instrs[n-1].op) {
+		fmt.Fprintf(b, "\tpanic(%q)\n", fname+": unexpected end of function")
+	}
+	fmt.Fprintf(b, "}\n")
+	return nil
+}
+
+func isTerminating(op opcode) bool {
+	switch op {
+	case opReturn, opJump, opTailCall, opTailApply:
+		return true
+	}
+	return false
+}
+
+func goArgFmt(af *ArgFmt) (string, error) {
+	if af == nil {
+		return "nil", nil
+	}
+	if af.Wildcard != "" {
+		return fmt.Sprintf("&ArgFmt{Wildcard: %q}", af.Wildcard), nil
+	}
+	args := make([]string, 0, len(af.Args))
+	for _, arg := range af.Args {
+		v := "nil"
+		if arg.V != nil {
+			var err error
+			if v, err = goExpr(arg.V); err != nil {
+				return "", err
+			}
+		}
+		args = append(args, fmt.Sprintf("{Name: %q, T: %q, V: %v}", arg.Name, string(arg.T), v))
+	}
+	return fmt.Sprintf("&ArgFmt{Args: []Arg{%v}}", strings.Join(args, ", ")), nil
+}
+
+func goValues(vs []types.Value) (string, error) {
+	if vs == nil {
+		return "nil", nil
+	}
+	items := make([]string, 0, len(vs))
+	for _, v := range vs {
+		e, err := goExpr(v.E)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, fmt.Sprintf("{E: %v, T: %q}", e, string(v.T)))
+	}
+	return "[]types.Value{" + strings.Join(items, ", ") + "}", nil
+}
+
+// goExpr generates Go expression creating constant value.
+func goExpr(e types.Expr) (string, error) {
+	switch a := e.(type) {
+	case types.Int:
+		b := &strings.Builder{}
+		a.Print(b)
+		return fmt.Sprintf("in.mustInt(%q)", b.String()), nil
+	case types.Float:
+		return fmt.Sprintf("in.mustFloat(%q)", strconv.FormatFloat(a.Float64(), 'g', -1, 64)), nil
+	case types.Str:
+		return fmt.Sprintf("types.Str(%q)", string(a)), nil
+	case types.Bool:
+		return fmt.Sprintf("types.Bool(%v)", bool(a)), nil
+	case types.Ident:
+		return fmt.Sprintf("types.Ident(%q)", string(a)), nil
+	case *types.Sexpr:
+		list, err := goValues(a.List)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("&types.Sexpr{List: %v, Quoted: %v, Lambda: %v}", list, a.Quoted, a.Lambda), nil
+	}
+	return "", fmt.Errorf("cannot translate constant into Go: %v", e)
+}
+
+func goStrings(items []string) string {
+	if items == nil {
+		return "nil"
+	}
+	quoted := make([]string, 0, len(items))
+	for _, s := range items {
+		quoted = append(quoted, strconv.Quote(s))
+	}
+	return "[]string{" + strings.Join(quoted, ", ") + "}"
+}
+
+func goInts(items []int) string {
+	if items == nil {
+		return "nil"
+	}
+	strs := make([]string, 0, len(items))
+	for _, i := range items {
+		strs = append(strs, strconv.Itoa(i))
+	}
+	return "[]int{" + strings.Join(strs, ", ") + "}"
+}
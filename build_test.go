@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var buildAll = flag.Bool("build-all", false, "build all examples in TestBuildExamples")
+
+// Examples covering tail calls, memoization, lambdas, lazy lists and user-defined types.
+var buildExamples = []string{
+	"examples/ex.factorial.lisp",
+	"examples/ex.memo.lisp",
+	"examples/ex.short-lambda.lisp",
+	"examples/ex.prime-2.lisp",
+	"examples/ex.user-defined-types.lisp",
+	"examples/ex.use-bigmath.lisp",
+	"examples/ex.variadic-func.lisp",
+}
+
+// Files of the interpreter which are not included into built programs: commands and tools.
+var buildToolSources = []string{
+	"build.go", "bundle.go", "coverage.go", "covercmd.go", "cst.go", "dap.go", "debug.go", "debugcmd.go",
+	"doccmd.go", "fmtcmd.go", "goldencmd.go", "lsp.go", "main.go", "optimizer.go", "pkgcmd.go", "pprof.go",
+	"profile.go", "spiltest.go", "vet.go", "watchcmd.go",
+}
+
+// Every file of the interpreter should be either a runtime file or a tool file.
+func TestRuntimeSources(t *testing.T) {
+	tools := make(map[string]bool)
+	for _, f := range buildToolSources {
+		tools[f] = true
+	}
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		_, err := fs.Stat(runtimeSources, f)
+		if runtime := err == nil; runtime && tools[f] {
+			t.Errorf("%v is listed both as runtime and as tool file", f)
+		} else if !runtime && !tools[f] {
+			t.Errorf("%v should be embedded into built programs (see runtimeSources) or listed in buildToolSources", f)
+		}
+	}
+}
+
+func TestBuildExamples(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Building examples is slow")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skipf("Go toolchain is not found: %v", err)
+	}
+	inputs := buildExamples
+	if *buildAll {
+		var err error
+		if inputs, err = filepath.Glob("examples/ex.*"); err != nil {
+			panic(err)
+		}
+	}
+	tmp := t.TempDir()
+	for _, test := range inputs {
+		test := test
+		t.Run(test, func(t *testing.T) {
+			t.Parallel()
+			dir, file := filepath.Split(test)
+			expData, err := ioutil.ReadFile(filepath.Join(dir, "out"+file[2:]))
+			if os.IsNotExist(err) {
+				t.Skipf("No output file for %v found", test)
+			}
+			if err != nil {
+				t.Fatalf("Reading output file failed: %v", err)
+			}
+
+			// the same module name lets go build reuse cached runtime packages
+			out := filepath.Join(tmp, file, "prog")
+			if err := buildProgram(test, out); err != nil {
+				t.Fatalf("buildProgram() failed: %v", err)
+			}
+			goBuild := exec.Command("go", "build", "-o", "prog")
+			goBuild.Dir = out
+			if data, err := goBuild.CombinedOutput(); err != nil {
+				t.Fatalf("go build failed: %v\n%s", err, data)
+			}
+			act, err := exec.Command(filepath.Join(out, "prog")).Output()
+			if err != nil {
+				t.Fatalf("Program failed: %v", err)
+			}
+			if string(act) != string(expData) {
+				t.Errorf("Incorrect output for %v:\nexpected %q,\n  actual %q", test, expData, act)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+//go:build spilstubs
+
+package main
+
+// Stubs of the tools which are not included into programs built with "spil build":
+// coverage, the debugger and the profiler are never enabled there.
+// The build constraint is removed when the file is written into the built program (see build.go).
+
+import "github.com/avoronkov/spil/types"
+
+type coverage struct{}
+
+func (c *coverage) clause(impl *FuncImpl)             {}
+func (c *coverage) expr(se *types.Sexpr)              {}
+func (c *coverage) branch(se *types.Sexpr, cond bool) {}
+func (c *coverage) alias(copied, orig *types.Sexpr)   {}
+
+type debugger struct{}
+
+func (d *debugger) enter(rt *FuncRuntime)                       {}
+func (d *debugger) leave()                                      {}
+func (d *debugger) expr(rt *FuncRuntime, se *types.Sexpr) error { return nil }
+func (d *debugger) bound(rt *FuncRuntime, impl *FuncImpl) error { return nil }
+
+type profiler struct{}
+
+func (p *profiler) enter(fi *FuncInterpret)          {}
+func (p *profiler) leave()                           {}
+func (p *profiler) bound(fi *FuncInterpret, idx int) {}
+func (p *profiler) memo(fi *FuncInterpret, hit bool) {}
+func (p *profiler) forced(fi *FuncInterpret)         {}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Standalone executables.
+//
+// "spil bundle" copies the interpreter executable and appends zip archive with the program,
+// its modules and plugins followed by the footer: size of the archive and bundleMagic.
+// On start the interpreter checks if it has the archive and runs the embedded program.
+
+const bundleMagic = "SPILBNDL"
+
+const bundleFooterSize = 8 + len(bundleMagic)
+
+type bundle struct {
+	// name and source of the entry point
+	name string
+	main []byte
+	// path relative to the directory of the entry point -> source
+	modules map[string][]byte
+	// directories where modules are searched relative to the directory of the entry point
+	dirs []string
+	// plugin name -> shared library
+	plugins map[string][]byte
+}
+
+func bundleCommand(args []string) int {
+	flags := flag.NewFlagSet("bundle", flag.ExitOnError)
+	output := flags.String("o", "", "output executable (default: name of the program)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil bundle [-o file] file.lisp\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	fname := flags.Arg(0)
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
+	}
+	if err := writeBundleFile(fname, out); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func writeBundleFile(fname, out string) error {
+	b, err := makeBundle(fname, pluginDir)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(exe)
+	if err != nil {
+		return err
+	}
+	// do not include the program if spil itself is a bundle
+	if len(data) < bundleFooterSize {
+		return fmt.Errorf("Incorrect executable: %v", exe)
+	}
+	if size, ok := bundleSize(data[len(data)-bundleFooterSize:]); ok {
+		data = data[:len(data)-bundleFooterSize-int(size)]
+	}
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if err := writeBundle(f, data, b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// makeBundle parses the program and collects all modules and plugins it uses.
+func makeBundle(fname, plugins string) (*bundle, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	file, err := filepath.Abs(fname)
+	if err != nil {
+		return nil, err
+	}
+	in := NewInterpreter(ioutil.Discard)
+	in.PluginDir = plugins
+	in.IncludeDirs = searchDirs(in.PluginDir)
+	if err := in.Parse(file, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	errs, warnings := in.Check()
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", w)
+	}
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	b := &bundle{
+		name:    filepath.Base(fname),
+		main:    data,
+		modules: make(map[string][]byte),
+		plugins: make(map[string][]byte),
+	}
+	for name, file := range in.usedModules {
+		if b.modules[name], err = ioutil.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	// the first directory is the directory of the using file
+	for _, d := range in.moduleDirs(file)[1:] {
+		if abs, err := filepath.Abs(d); err == nil {
+			d = abs
+		}
+		b.dirs = append(b.dirs, in.rootPath(d))
+	}
+	for name, file := range in.usedPlugins {
+		if b.plugins[name], err = ioutil.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func writeBundle(w io.Writer, exe []byte, b *bundle) error {
+	if _, err := w.Write(exe); err != nil {
+		return err
+	}
+	archive := &bytes.Buffer{}
+	z := zip.NewWriter(archive)
+	add := func(name string, data []byte) error {
+		f, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+	if err := add("main/"+b.name, b.main); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(b.modules) {
+		if err := add("modules/"+name, b.modules[name]); err != nil {
+			return err
+		}
+	}
+	if err := add("dirs", []byte(strings.Join(b.dirs, "\n"))); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(b.plugins) {
+		if err := add("plugins/"+name, b.plugins[name]); err != nil {
+			return err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return err
+	}
+	footer := make([]byte, 8, bundleFooterSize)
+	binary.LittleEndian.PutUint64(footer, uint64(archive.Len()))
+	footer = append(footer, bundleMagic...)
+	if _, err := archive.WriteTo(w); err != nil {
+		return err
+	}
+	_, err := w.Write(footer)
+	return err
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func bundleSize(footer []byte) (uint64, bool) {
+	if len(footer) != bundleFooterSize || string(footer[8:]) != bundleMagic {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(footer), true
+}
+
+// readBundle returns nil if file does not contain bundle.
+func readBundle(f *os.File) (*bundle, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() < int64(bundleFooterSize) {
+		return nil, nil
+	}
+	footer := make([]byte, bundleFooterSize)
+	if _, err := f.ReadAt(footer, st.Size()-int64(bundleFooterSize)); err != nil {
+		return nil, err
+	}
+	size, ok := bundleSize(footer)
+	if !ok {
+		return nil, nil
+	}
+	offset := st.Size() - int64(bundleFooterSize) - int64(size)
+	z, err := zip.NewReader(io.NewSectionReader(f, offset, int64(size)), int64(size))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read bundled program: %v", err)
+	}
+	b := &bundle{
+		modules: make(map[string][]byte),
+		plugins: make(map[string][]byte),
+	}
+	for _, zf := range z.File {
+		r, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(zf.Name, "main/"):
+			b.name, b.main = strings.TrimPrefix(zf.Name, "main/"), data
+		case strings.HasPrefix(zf.Name, "modules/"):
+			b.modules[strings.TrimPrefix(zf.Name, "modules/")] = data
+		case zf.Name == "dirs":
+			if len(data) > 0 {
+				b.dirs = strings.Split(string(data), "\n")
+			}
+		case strings.HasPrefix(zf.Name, "plugins/"):
+			b.plugins[strings.TrimPrefix(zf.Name, "plugins/")] = data
+		}
+	}
+	if b.main == nil {
+		return nil, fmt.Errorf("Bundled program not found")
+	}
+	return b, nil
+}
+
+// openBundle checks if the running executable contains a program.
+func openBundle() (*bundle, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readBundle(f)
+}
+
+// runBundle runs embedded program with command line arguments.
+func runBundle(b *bundle, w io.Writer, args []string) int {
+	log.SetOutput(ioutil.Discard)
+	in := NewInterpreter(w)
+	in.embeddedModules = b.modules
+	in.embeddedDirs = b.dirs
+	if len(b.plugins) > 0 {
+		dir, err := ioutil.TempDir("", "spil-plugins")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+		for name, data := range b.plugins {
+			if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return 1
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, name, name+".so"), data, 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return 1
+			}
+		}
+		in.PluginDir = dir
+	}
+	if err := in.Parse(b.name, bytes.NewReader(b.main)); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if errs, _ := in.Check(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		return 1
+	}
+	in.Optimize()
+	in.Compile()
+	return in.exitStatus(in.RunArgs(args))
+}
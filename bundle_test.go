@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.lisp":      "(use \"lib/util.lisp\")\n(greet (head __args))\n",
+		"lib/util.lisp":  "(use \"lib/names.lisp\")\n(def greet (name) (print (hello) name))\n",
+		"lib/names.lisp": "(def hello () \"hello\")\n",
+	}
+	for name, data := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := makeBundle(filepath.Join(dir, "main.lisp"), dir)
+	if err != nil {
+		t.Fatalf("makeBundle() failed: %v", err)
+	}
+
+	exe := filepath.Join(dir, "tool")
+	f, err := os.Create(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeBundle(f, []byte("executable"), b); err != nil {
+		t.Fatalf("writeBundle() failed: %v", err)
+	}
+	f.Close()
+
+	// modules are loaded from the bundle only
+	for name := range files {
+		os.Remove(filepath.Join(dir, name))
+	}
+
+	f, err = os.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	loaded, err := readBundle(f)
+	if err != nil {
+		t.Fatalf("readBundle() failed: %v", err)
+	}
+	if loaded == nil {
+		t.Fatalf("Bundle not found")
+	}
+	if len(loaded.modules) != 2 {
+		t.Errorf("Expected 2 bundled modules, found: %v", len(loaded.modules))
+	}
+	out := &strings.Builder{}
+	if code := runBundle(loaded, out, []string{"world"}); code != 0 {
+		t.Fatalf("runBundle() failed with exit code %v", code)
+	}
+	if exp := "hello world\n"; out.String() != exp {
+		t.Errorf("Incorrect output: expected %q, actual %q", exp, out.String())
+	}
+}
+
+func TestBundleSameNameModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.lisp":      "(use \"lib/a.lisp\")\n(use \"lib2/b.lisp\")\n(print (a) (b))\n",
+		"lib/a.lisp":     "(use \"util.lisp\")\n(def a () (hello))\n",
+		"lib/util.lisp":  "(def hello () \"lib-util\")\n",
+		"lib2/b.lisp":    "(use \"util.lisp\" :as u2)\n(def b () (u2.hello))\n",
+		"lib2/util.lisp": "(def hello () \"lib2-util\")\n",
+	}
+	for name, data := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := makeBundle(filepath.Join(dir, "main.lisp"), "")
+	if err != nil {
+		t.Fatalf("makeBundle() failed: %v", err)
+	}
+	if len(b.modules) != 4 {
+		t.Errorf("Expected 4 bundled modules, found: %v", len(b.modules))
+	}
+	buf := &bytes.Buffer{}
+	if err := writeBundle(buf, nil, b); err != nil {
+		t.Fatalf("writeBundle() failed: %v", err)
+	}
+	exe := filepath.Join(t.TempDir(), "tool")
+	if err := ioutil.WriteFile(exe, buf.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	loaded, err := readBundle(f)
+	if err != nil || loaded == nil {
+		t.Fatalf("readBundle() failed: %v", err)
+	}
+	out := &strings.Builder{}
+	if code := runBundle(loaded, out, nil); code != 0 {
+		t.Fatalf("runBundle() failed with exit code %v", code)
+	}
+	if exp := "lib-util lib2-util\n"; out.String() != exp {
+		t.Errorf("Incorrect output: expected %q, actual %q", exp, out.String())
+	}
+}
+
+func TestReadBundleNoBundle(t *testing.T) {
+	f, err := os.Open("examples/ex.factorial.lisp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if b, err := readBundle(f); b != nil || err != nil {
+		t.Errorf("Expected no bundle, found: %v, %v", b, err)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Command line parsing for (use cli).
+//
+//	(cli.parse '((about "Search lines in files.")
+//	             (flag "count" :int 10 "number of lines")
+//	             (flag "verbose" :bool false "print more")
+//	             (arg "pattern" :str "pattern to search")
+//	             (rest "files" :str "input files"))
+//	           [args])
+//
+// returns list of pairs (name value), arguments of the program are parsed by default.
+
+type cliOption struct {
+	kind string
+	name string
+	t    types.Type
+	def  *types.Value
+	help string
+}
+
+type cliSpec struct {
+	program string
+	about   string
+	flags   []*cliOption
+	args    []*cliOption
+	rest    *cliOption
+}
+
+func (in *Interpret) FCliParse(args []types.Value) (*types.Value, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("cli.parse: expected specification and optional arguments, found %v", args)
+	}
+	spec, err := in.parseCliSpec(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("cli.parse: %w", err)
+	}
+	params := in.args
+	if len(args) == 2 {
+		if params, err = strList(args[1]); err != nil {
+			return nil, fmt.Errorf("cli.parse: %w", err)
+		}
+	}
+	for _, p := range params {
+		if p == "--" {
+			break
+		}
+		if p == "-h" || p == "--help" {
+			fmt.Fprint(in.output, spec.usage())
+			in.exit = &exitError{code: 0}
+			return nil, in.exit
+		}
+	}
+	res, err := in.parseCliArgs(spec, params)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w (see --help)", spec.program, err)
+	}
+	return res, nil
+}
+
+// (cli.get opts name)
+func FCliGet(args []types.Value) (*types.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("cli.get: expected parsed options and name, found %v", args)
+	}
+	name, ok := args[1].E.(types.Str)
+	if !ok {
+		return nil, fmt.Errorf("cli.get: expected name to be string, found %v", args[1])
+	}
+	opts, ok := args[0].E.(types.List)
+	if !ok {
+		return nil, fmt.Errorf("cli.get: expected parsed options, found %v", args[0])
+	}
+	for !opts.Empty() {
+		item, err := opts.Head()
+		if err != nil {
+			return nil, err
+		}
+		if pair, ok := item.E.(*types.Sexpr); ok && len(pair.List) == 2 {
+			if n, ok := pair.List[0].E.(types.Str); ok && n == name {
+				return &pair.List[1], nil
+			}
+		}
+		if opts, err = opts.Tail(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("cli.get: unknown option %q", string(name))
+}
+
+func strList(v types.Value) ([]string, error) {
+	l, ok := v.E.(types.List)
+	if !ok {
+		return nil, fmt.Errorf("expected list of strings, found %v", v)
+	}
+	var res []string
+	for !l.Empty() {
+		item, err := l.Head()
+		if err != nil {
+			return nil, err
+		}
+		s, ok := item.E.(types.Str)
+		if !ok {
+			return nil, fmt.Errorf("expected list of strings, found %v", item)
+		}
+		res = append(res, string(s))
+		if l, err = l.Tail(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (in *Interpret) parseCliSpec(v types.Value) (*cliSpec, error) {
+	list, ok := v.E.(*types.Sexpr)
+	if !ok {
+		return nil, fmt.Errorf("expected list of options, found %v", v)
+	}
+	spec := &cliSpec{program: "program"}
+	if in.main != nil && len(in.main.bodies) > 0 && in.main.bodies[0].file != "" {
+		spec.program = filepath.Base(in.main.bodies[0].file)
+	}
+	for _, item := range list.List {
+		se, ok := item.E.(*types.Sexpr)
+		if !ok || len(se.List) < 2 {
+			return nil, fmt.Errorf("expected option, found %v", literal(item.E))
+		}
+		kind, _ := se.List[0].E.(types.Ident)
+		var strs []string
+		for _, a := range se.List[1:] {
+			if s, ok := a.E.(types.Str); ok {
+				strs = append(strs, string(s))
+			}
+		}
+		switch kind {
+		case "program", "about":
+			if len(se.List) != 2 || len(strs) != 1 {
+				return nil, fmt.Errorf("expected (%v \"text\"), found %v", kind, literal(se))
+			}
+			if kind == "program" {
+				spec.program = strs[0]
+			} else {
+				spec.about = strs[0]
+			}
+		case "flag", "arg", "rest":
+			opt, err := in.parseCliOption(string(kind), se)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case kind == "flag":
+				spec.flags = append(spec.flags, opt)
+			case kind == "rest":
+				spec.rest = opt
+			case opt.def == nil && len(spec.args) > 0 && spec.args[len(spec.args)-1].def != nil:
+				return nil, fmt.Errorf("required argument %v follows optional one", opt.name)
+			default:
+				spec.args = append(spec.args, opt)
+			}
+		default:
+			return nil, fmt.Errorf("unknown option kind: %v", literal(se))
+		}
+	}
+	return spec, nil
+}
+
+// (flag "name" :type default "help"), (arg "name" :type [default] "help"), (rest "name" :type "help")
+func (in *Interpret) parseCliOption(kind string, se *types.Sexpr) (*cliOption, error) {
+	items := se.List[1:]
+	n := len(items)
+	ok := (n == 4 && kind != "rest") || (n == 3 && kind != "flag")
+	if !ok {
+		return nil, fmt.Errorf("incorrect option %v", literal(se))
+	}
+	name, ok1 := items[0].E.(types.Str)
+	tid, ok2 := items[1].E.(types.Ident)
+	help, ok3 := items[n-1].E.(types.Str)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf("incorrect option %v", literal(se))
+	}
+	t, ok := types.ParseType(string(tid))
+	if !ok || (t != types.TypeInt && t != types.TypeStr && t != types.TypeBool && t != types.TypeFloat) {
+		return nil, fmt.Errorf("option %v: unsupported type %v", name, tid)
+	}
+	opt := &cliOption{kind: kind, name: string(name), t: t, help: string(help)}
+	if n == 4 {
+		def := items[2]
+		if !sameLiteralType(def.E, t) {
+			return nil, fmt.Errorf("option %v: default value %v is not %v", name, literal(def.E), t)
+		}
+		opt.def = &types.Value{E: def.E, T: t}
+	}
+	return opt, nil
+}
+
+func sameLiteralType(e types.Expr, t types.Type) bool {
+	switch e.(type) {
+	case types.Int:
+		return t == types.TypeInt
+	case types.Float:
+		return t == types.TypeFloat
+	case types.Str:
+		return t == types.TypeStr
+	case types.Bool:
+		return t == types.TypeBool
+	}
+	return false
+}
+
+func (in *Interpret) cliValue(opt *cliOption, s string) (*types.Value, error) {
+	switch opt.t {
+	case types.TypeInt:
+		if i, ok := in.intMaker.ParseInt(s); ok {
+			return &types.Value{E: i, T: types.TypeInt}, nil
+		}
+	case types.TypeFloat:
+		if f, ok := in.floatMaker.ParseFloat(s); ok {
+			return &types.Value{E: f, T: types.TypeFloat}, nil
+		}
+	case types.TypeBool:
+		switch s {
+		case "true", "1":
+			return &types.Value{E: types.Bool(true), T: types.TypeBool}, nil
+		case "false", "0":
+			return &types.Value{E: types.Bool(false), T: types.TypeBool}, nil
+		}
+	case types.TypeStr:
+		return &types.Value{E: types.Str(s), T: types.TypeStr}, nil
+	}
+	return nil, fmt.Errorf("incorrect value of %v: expected %v, found %q", opt.name, opt.t, s)
+}
+
+func (in *Interpret) parseCliArgs(spec *cliSpec, params []string) (*types.Value, error) {
+	values := make(map[string]*types.Value)
+	var positional []string
+	for idx := 0; idx < len(params); idx++ {
+		p := params[idx]
+		if p == "--" {
+			positional = append(positional, params[idx+1:]...)
+			break
+		}
+		if !strings.HasPrefix(p, "-") || p == "-" {
+			positional = append(positional, p)
+			continue
+		}
+		name := strings.TrimLeft(p, "-")
+		value, hasValue := "", false
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, value, hasValue = name[:eq], name[eq+1:], true
+		}
+		var opt *cliOption
+		for _, f := range spec.flags {
+			if f.name == name {
+				opt = f
+			}
+		}
+		if opt == nil {
+			return nil, fmt.Errorf("unknown flag %v", p)
+		}
+		if !hasValue {
+			if opt.t == types.TypeBool {
+				value = "true"
+			} else if idx+1 < len(params) {
+				idx++
+				value = params[idx]
+			} else {
+				return nil, fmt.Errorf("flag %v needs a value", p)
+			}
+		}
+		v, err := in.cliValue(opt, value)
+		if err != nil {
+			return nil, err
+		}
+		values[opt.name] = v
+	}
+
+	res := &types.Sexpr{Quoted: true}
+	add := func(name string, v types.Value) {
+		res.List = append(res.List, types.Value{E: types.QList(types.Value{E: types.Str(name), T: types.TypeStr}, v), T: types.TypeList})
+	}
+	for _, f := range spec.flags {
+		if v, ok := values[f.name]; ok {
+			add(f.name, *v)
+		} else {
+			add(f.name, *f.def)
+		}
+	}
+	for _, a := range spec.args {
+		if len(positional) == 0 {
+			if a.def == nil {
+				return nil, fmt.Errorf("missing argument %v", a.name)
+			}
+			add(a.name, *a.def)
+			continue
+		}
+		v, err := in.cliValue(a, positional[0])
+		if err != nil {
+			return nil, err
+		}
+		positional = positional[1:]
+		add(a.name, *v)
+	}
+	if spec.rest != nil {
+		rest := &types.Sexpr{Quoted: true}
+		for _, p := range positional {
+			v, err := in.cliValue(spec.rest, p)
+			if err != nil {
+				return nil, err
+			}
+			rest.List = append(rest.List, *v)
+		}
+		add(spec.rest.name, types.Value{E: rest, T: types.Type("list[" + strings.TrimPrefix(string(spec.rest.t), ":") + "]")})
+	} else if len(positional) > 0 {
+		return nil, fmt.Errorf("unexpected argument %v", positional[0])
+	}
+	return &types.Value{E: res, T: types.TypeList}, nil
+}
+
+// usage returns text printed by --help.
+func (s *cliSpec) usage() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Usage: %v", s.program)
+	if len(s.flags) > 0 {
+		fmt.Fprintf(b, " [flags]")
+	}
+	for _, a := range s.args {
+		if a.def != nil {
+			fmt.Fprintf(b, " [%v]", a.name)
+		} else {
+			fmt.Fprintf(b, " %v", a.name)
+		}
+	}
+	if s.rest != nil {
+		fmt.Fprintf(b, " [%v...]", s.rest.name)
+	}
+	fmt.Fprintf(b, "\n")
+	if s.about != "" {
+		fmt.Fprintf(b, "\n%v\n", s.about)
+	}
+	var lines [][2]string
+	if len(s.args) > 0 || s.rest != nil {
+		fmt.Fprintf(b, "\nArguments:\n")
+		for _, a := range s.args {
+			lines = append(lines, [2]string{a.name + " " + a.t.String(), a.help + defaultHelp(a)})
+		}
+		if s.rest != nil {
+			lines = append(lines, [2]string{s.rest.name + "... " + s.rest.t.String(), s.rest.help})
+		}
+		writeColumns(b, lines)
+	}
+	fmt.Fprintf(b, "\nFlags:\n")
+	lines = nil
+	for _, f := range s.flags {
+		l := "--" + f.name
+		if f.t != types.TypeBool {
+			l += " " + f.t.String()
+		}
+		lines = append(lines, [2]string{l, f.help + defaultHelp(f)})
+	}
+	lines = append(lines, [2]string{"-h, --help", "show this help"})
+	writeColumns(b, lines)
+	return b.String()
+}
+
+func defaultHelp(o *cliOption) string {
+	if o.def == nil {
+		return ""
+	}
+	if b, ok := o.def.E.(types.Bool); ok && !bool(b) {
+		return ""
+	}
+	return fmt.Sprintf(" (default %v)", literal(o.def.E))
+}
+
+func writeColumns(b *strings.Builder, lines [][2]string) {
+	width := 0
+	for _, l := range lines {
+		if len(l[0]) > width {
+			width = len(l[0])
+		}
+	}
+	for _, l := range lines {
+		fmt.Fprintf(b, "  %-*v  %v\n", width, l[0], l[1])
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCli(t *testing.T) {
+	program := `(use cli)
+(set opts (cli.parse '((program "greet")
+                       (about "Greets somebody.")
+                       (flag "times" :int 1 "repeat greeting")
+                       (flag "loud" :bool false "shout")
+                       (arg "name" :str "who to greet")
+                       (arg "suffix" :str "!" "end of greeting")
+                       (rest "others" :str "more names"))))
+(print (cli.int opts "times") (cli.bool opts "loud") (cli.str opts "name") (cli.str opts "suffix") (cli.rest opts "others"))`
+	help := `Usage: greet [flags] name [suffix] [others...]
+
+Greets somebody.
+
+Arguments:
+  name :str       who to greet
+  suffix :str     end of greeting (default "!")
+  others... :str  more names
+
+Flags:
+  --times :int  repeat greeting (default 1)
+  --loud        shout
+  -h, --help    show this help
+`
+	tests := []struct {
+		args []string
+		exp  string
+		err  string
+	}{
+		{args: []string{"bob"}, exp: "1 false bob ! '()\n"},
+		{args: []string{"--times", "3", "-loud", "bob", "?", "ann", "joe"}, exp: "3 true bob ? '(ann joe)\n"},
+		{args: []string{"--times=2", "--loud=false", "--", "--bob"}, exp: "2 false --bob ! '()\n"},
+		{args: []string{"--help"}, exp: help},
+		{args: []string{}, err: "greet: missing argument name (see --help)"},
+		{args: []string{"--times", "x", "bob"}, err: `incorrect value of times: expected :int, found "x"`},
+		{args: []string{"--count", "1", "bob"}, err: "unknown flag --count"},
+		{args: []string{"bob", "--times"}, err: "flag --times needs a value"},
+		// "spil prog.lisp -- args..." passes arguments after the separator
+		{args: []string{"--", "--times", "3", "bob"}, exp: "3 false bob ! '()\n"},
+		{args: []string{"--", "--", "--bob"}, exp: "1 false --bob ! '()\n"},
+		{args: []string{"--", "--help"}, exp: help},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			in := NewInterpreter(stdout)
+			if err := in.Parse("main.lisp", strings.NewReader(program)); err != nil {
+				t.Fatal(err)
+			}
+			if errs, _ := in.Check(); len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			err := in.RunArgs(programArgs(test.args))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("Expected error %q, found %v", test.err, err)
+				}
+			} else if err != nil {
+				if e, ok := err.(*exitError); !ok || e.code != 0 {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}
+			if test.err == "" && stdout.String() != test.exp {
+				t.Errorf("Incorrect output:\nexpected %q\n  actual %q", test.exp, stdout.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Compile translates user-defined functions into bytecode (see vm.go).
+// It should be called after type checking.
+// Functions which cannot be compiled are evaluated by the tree-walking interpreter.
+func (in *Interpret) Compile() {
+	for _, fn := range in.funcs {
+		if fi, ok := fn.(*FuncInterpret); ok {
+			in.compileFunc(fi)
+		}
+	}
+	for _, t := range in.tests {
+		in.compileFunc(t)
+	}
+	in.compileFunc(in.main)
+}
+
+func (in *Interpret) compileFunc(fi *FuncInterpret) {
+	codes := make([]*vmCode, len(fi.bodies))
+	for idx, impl := range fi.bodies {
+		c := newCompiler(in, fi.name)
+		if err := c.compileImpl(impl.argfmt, impl.body); err != nil {
+			log.Printf("%v: cannot compile function, using tree-walker: %v", fi.name, err)
+			return
+		}
+		codes[idx] = c.code
+	}
+	for idx, impl := range fi.bodies {
+		impl.code = codes[idx]
+	}
+	fi.compiled = true
+}
+
+type compiler struct {
+	in *Interpret
+	// name of the function used to detect tail calls
+	fname string
+	code  *vmCode
+	names map[string]int
+	// current depth of the stack
+	depth int
+}
+
+func newCompiler(in *Interpret, fname string) *compiler {
+	return &compiler{
+		in:    in,
+		fname: fname,
+		code: &vmCode{
+			slotOf:   make(map[string]int),
+			calls:    make(map[int]*types.Sexpr),
+			wildcard: -1,
+			argsSlot: -1,
+			varArgs:  -1,
+		},
+		names: make(map[string]int),
+	}
+}
+
+func (c *compiler) emit(op opcode, a, b int) int {
+	c.code.instrs = append(c.code.instrs, instr{op: op, a: a, b: b})
+	// estimate stack size (both branches of conditions are counted so it never underestimates)
+	switch op {
+	case opConst, opLoad, opLoadName, opLambda:
+		c.depth++
+	case opStore, opStoreScoped, opPop, opJumpIfFalse, opJumpIfTrue:
+		c.depth--
+	case opCall, opGen, opGenHashable:
+		c.depth -= b - 1
+	}
+	if c.depth > c.code.maxStack {
+		c.code.maxStack = c.depth
+	}
+	return len(c.code.instrs) - 1
+}
+
+// emitCall emits instruction calling function and remembers its expression.
+func (c *compiler) emitCall(se *types.Sexpr, op opcode, a, b int) {
+	c.code.calls[c.emit(op, a, b)] = se
+}
+
+// patch sets jump target of instruction at pc to the current position.
+func (c *compiler) patch(pc int) {
+	c.code.instrs[pc].a = len(c.code.instrs)
+}
+
+func (c *compiler) constant(v types.Value) int {
+	c.code.consts = append(c.code.consts, v)
+	return len(c.code.consts) - 1
+}
+
+func (c *compiler) name(n string) int {
+	if idx, ok := c.names[n]; ok {
+		return idx
+	}
+	c.code.names = append(c.code.names, n)
+	c.names[n] = len(c.code.names) - 1
+	return c.names[n]
+}
+
+func (c *compiler) cast(t types.Type) int {
+	c.code.casts = append(c.code.casts, t)
+	return len(c.code.casts) - 1
+}
+
+// slot returns slot of variable (allocating it if needed).
+func (c *compiler) slot(n string) int {
+	if s, ok := c.code.slotOf[n]; ok {
+		return s
+	}
+	s := c.code.nslots
+	c.code.nslots++
+	c.code.slotOf[n] = s
+	return s
+}
+
+// lookup returns slot of variable or -1 if name is not a variable.
+// Arguments of lambdas (__args, _1, _2...) are bound on demand.
+func (c *compiler) lookup(n string) int {
+	if s, ok := c.code.slotOf[n]; ok {
+		return s
+	}
+	if n == "__args" {
+		c.code.argsSlot = c.slot(n)
+		return c.code.argsSlot
+	}
+	if reArg.MatchString(n) {
+		pos, _ := strconv.Atoi(n[1:])
+		if pos < 1 {
+			return -1
+		}
+		for len(c.code.posSlots) < pos {
+			c.code.posSlots = append(c.code.posSlots, -1)
+		}
+		c.code.posSlots[pos-1] = c.slot(n)
+		return c.code.posSlots[pos-1]
+	}
+	return -1
+}
+
+func (c *compiler) callee(n string) int {
+	cl := vmCallee{name: n, slot: c.lookup(n)}
+	if cl.slot < 0 {
+		cl.fn = c.in.funcs[n]
+	}
+	c.code.callees = append(c.code.callees, cl)
+	return len(c.code.callees) - 1
+}
+
+func (c *compiler) compileImpl(argfmt *ArgFmt, body []types.Value) error {
+	if argfmt != nil {
+		if argfmt.Wildcard != "" {
+			c.code.wildcard = c.slot(argfmt.Wildcard)
+		} else {
+			for i, arg := range argfmt.Args {
+				if arg.T.Basic() == "args" && c.code.varArgs < 0 {
+					c.code.varArgs = i
+				}
+				s := -1
+				if arg.V == nil {
+					s = c.slot(arg.Name)
+				}
+				c.code.argSlots = append(c.code.argSlots, s)
+			}
+		}
+	}
+
+	last := len(body) - 1
+	if last < 0 {
+		c.emit(opConst, c.constant(types.Value{E: types.QEmpty, T: types.TypeList}), 0)
+		c.emit(opReturn, 0, 0)
+		return nil
+	}
+	var casts []types.Type
+	if id, ok := body[last].E.(types.Ident); ok {
+		if tp, ok := types.ParseType(string(id)); ok {
+			// Last statement is type declaration
+			last--
+			casts = append(casts, tp)
+		}
+	}
+	if last < 0 {
+		return fmt.Errorf("function body is empty")
+	}
+	for _, st := range body[:last] {
+		if err := c.compileExpr(st); err != nil {
+			return err
+		}
+		c.emit(opPop, 0, 0)
+	}
+	return c.compileTail(body[last], casts)
+}
+
+// compileTail compiles expression which result is returned from the function.
+// casts are applied to the result unless it is a tail call.
+func (c *compiler) compileTail(e types.Value, casts []types.Type) error {
+	se, ok := e.E.(*types.Sexpr)
+	if !ok || se.Quoted || se.Lambda || se.Empty() {
+		return c.compileReturn(e, casts)
+	}
+	head, ok := se.List[0].E.(types.Ident)
+	if !ok {
+		return c.compileReturn(e, casts)
+	}
+	switch name := string(head); name {
+	case "if":
+		if len(se.List) != 4 {
+			return fmt.Errorf("Expected 3 arguments to if, found: %v", se.List[1:])
+		}
+		if err := c.compileExpr(se.List[1]); err != nil {
+			return err
+		}
+		jElse := c.emit(opJumpIfFalse, 0, c.constant(se.List[1]))
+		if err := c.compileTail(se.List[2], casts); err != nil {
+			return err
+		}
+		c.patch(jElse)
+		return c.compileTail(se.List[3], casts)
+	case "do":
+		body, retType, err := c.doBody(se)
+		if err != nil {
+			return err
+		}
+		for _, st := range body[:len(body)-1] {
+			if err := c.compileExpr(st); err != nil {
+				return err
+			}
+			c.emit(opPop, 0, 0)
+		}
+		if retType != nil {
+			casts = append([]types.Type{*retType}, casts...)
+		}
+		return c.compileTail(body[len(body)-1], casts)
+	case "apply":
+		fn, err := c.applyFunc(se)
+		if err != nil {
+			return err
+		}
+		if fn != c.fname && fn != "self" {
+			return c.compileReturn(e, casts)
+		}
+		if err := c.compileExpr(se.List[2]); err != nil {
+			return err
+		}
+		c.emitCall(se, opTailApply, 0, 0)
+		return nil
+	case "lambda", "and", "or", "set", "set'", "gen", "gen'":
+		return c.compileReturn(e, casts)
+	default:
+		if name != c.fname && name != "self" {
+			return c.compileReturn(e, casts)
+		}
+		// Tail call!
+		for _, arg := range se.List[1:] {
+			if err := c.compileExpr(arg); err != nil {
+				return err
+			}
+		}
+		c.emitCall(se, opTailCall, 0, len(se.List)-1)
+		return nil
+	}
+}
+
+func (c *compiler) compileReturn(e types.Value, casts []types.Type) error {
+	if err := c.compileExpr(e); err != nil {
+		return err
+	}
+	for _, t := range casts {
+		c.emit(opCast, c.cast(t), 0)
+	}
+	c.emit(opReturn, 0, 0)
+	return nil
+}
+
+func (c *compiler) compileExpr(e types.Value) error {
+	switch a := e.E.(type) {
+	case types.Int, types.Float, types.Str, types.Bool:
+		c.emit(opConst, c.constant(e), 0)
+		return nil
+	case types.Ident:
+		if s := c.lookup(string(a)); s >= 0 {
+			c.emit(opLoad, s, c.name(string(a)))
+		} else {
+			c.emit(opLoadName, c.name(string(a)), 0)
+		}
+		return nil
+	case *types.Sexpr:
+		return c.compileSexpr(a)
+	}
+	return fmt.Errorf("Unexpected Expr type: %v (%T)", e, e.E)
+}
+
+func (c *compiler) compileSexpr(a *types.Sexpr) error {
+	if a.Quoted {
+		c.emit(opConst, c.constant(types.Value{E: a, T: types.TypeList}), 0)
+		return nil
+	}
+	if a.Empty() {
+		return fmt.Errorf("Unexpected empty s-expression: %v", a)
+	}
+	if a.Lambda {
+		return c.compileLambda([]types.Value{{E: &types.Sexpr{List: a.List, File: a.File, Line: a.Line, Col: a.Col}, T: types.TypeList}})
+	}
+	head, ok := a.List[0].E.(types.Ident)
+	if !ok {
+		return fmt.Errorf("Wanted identifier, found: %v (%v)", a.List[0], a)
+	}
+	switch name := string(head); name {
+	case "lambda":
+		return c.compileLambda(a.List[1:])
+	case "if":
+		if len(a.List) != 4 {
+			return fmt.Errorf("Expected 3 arguments to if, found: %v", a.List[1:])
+		}
+		if err := c.compileExpr(a.List[1]); err != nil {
+			return err
+		}
+		jElse := c.emit(opJumpIfFalse, 0, c.constant(a.List[1]))
+		if err := c.compileExpr(a.List[2]); err != nil {
+			return err
+		}
+		jEnd := c.emit(opJump, 0, 0)
+		c.patch(jElse)
+		if err := c.compileExpr(a.List[3]); err != nil {
+			return err
+		}
+		c.patch(jEnd)
+		return nil
+	case "do":
+		body, retType, err := c.doBody(a)
+		if err != nil {
+			return err
+		}
+		for i, st := range body {
+			if i > 0 {
+				c.emit(opPop, 0, 0)
+			}
+			if err := c.compileExpr(st); err != nil {
+				return err
+			}
+		}
+		if retType != nil {
+			c.emit(opCast, c.cast(*retType), 0)
+		}
+		return nil
+	case "and", "or":
+		// jump to the end as soon as result is known
+		jumpOp, result := opJumpIfFalse, types.Bool(false)
+		if name == "or" {
+			jumpOp, result = opJumpIfTrue, types.Bool(true)
+		}
+		var jumps []int
+		for _, arg := range a.List[1:] {
+			if err := c.compileExpr(arg); err != nil {
+				return err
+			}
+			jumps = append(jumps, c.emit(jumpOp, 0, c.constant(arg)))
+		}
+		c.emit(opConst, c.constant(types.Value{E: !result, T: types.TypeBool}), 0)
+		jEnd := c.emit(opJump, 0, 0)
+		for _, j := range jumps {
+			c.patch(j)
+		}
+		c.emit(opConst, c.constant(types.Value{E: result, T: types.TypeBool}), 0)
+		c.patch(jEnd)
+		return nil
+	case "set", "set'":
+		return c.compileSet(a, name == "set'")
+	case "gen", "gen'":
+		if len(a.List) < 3 {
+			return fmt.Errorf("gen wants at least 2 arguments, found %v", a)
+		}
+		for _, arg := range a.List[1:] {
+			if err := c.compileExpr(arg); err != nil {
+				return err
+			}
+		}
+		op := opGen
+		if name == "gen'" {
+			op = opGenHashable
+		}
+		c.emitCall(a, op, 0, len(a.List)-1)
+		return nil
+	case "apply":
+		fn, err := c.applyFunc(a)
+		if err != nil {
+			return err
+		}
+		if err := c.compileExpr(a.List[2]); err != nil {
+			return err
+		}
+		c.emitCall(a, opApply, c.callee(fn), 0)
+		return nil
+	default:
+		for _, arg := range a.List[1:] {
+			if err := c.compileExpr(arg); err != nil {
+				return err
+			}
+		}
+		c.emitCall(a, opCall, c.callee(name), len(a.List)-1)
+		return nil
+	}
+}
+
+// (do statements... [:type])
+func (c *compiler) doBody(se *types.Sexpr) (body []types.Value, retType *types.Type, err error) {
+	body = se.List[1:]
+	if len(body) > 0 {
+		if id, ok := body[len(body)-1].E.(types.Ident); ok {
+			if rt, ok := types.ParseType(string(id)); ok {
+				// Last statement is type declaration
+				body = body[:len(body)-1]
+				retType = &rt
+			}
+		}
+	}
+	if len(body) == 0 {
+		return nil, nil, fmt.Errorf("do: empty body")
+	}
+	return body, retType, nil
+}
+
+// (apply function list-of-args)
+func (c *compiler) applyFunc(se *types.Sexpr) (string, error) {
+	if len(se.List) != 3 {
+		return "", fmt.Errorf("apply expects function with list of arguments")
+	}
+	fn, ok := se.List[1].E.(types.Ident)
+	if !ok {
+		return "", fmt.Errorf("Wanted identifier, found: %v", se.List[1])
+	}
+	return string(fn), nil
+}
+
+// (set var-name value [:type])
+func (c *compiler) compileSet(se *types.Sexpr, scoped bool) error {
+	if len(se.List) != 3 && len(se.List) != 4 {
+		return fmt.Errorf("set wants 2 or 3 arguments, found %v", se)
+	}
+	name, ok := se.List[1].E.(types.Ident)
+	if !ok {
+		return fmt.Errorf("set expected identifier first, found %v", se.List[1])
+	}
+	if err := c.compileExpr(se.List[2]); err != nil {
+		return err
+	}
+	if len(se.List) == 4 {
+		id, ok := se.List[3].E.(types.Ident)
+		if !ok {
+			return fmt.Errorf("set expects type identifier, found: %v", se.List[3])
+		}
+		t, err := c.in.parseType(string(id))
+		if err != nil {
+			return err
+		}
+		c.emit(opCast, c.cast(t), 0)
+	}
+	op := opStore
+	if scoped {
+		op = opStoreScoped
+	}
+	c.emit(op, c.slot(string(name)), 0)
+	c.emit(opConst, c.constant(types.Value{E: types.QEmpty, T: types.TypeAny}), 0)
+	return nil
+}
+
+func (c *compiler) compileLambda(body []types.Value) error {
+	l := &vmLambda{body: body}
+	lc := newCompiler(c.in, "")
+	if err := lc.compileImpl(nil, body); err != nil {
+		log.Printf("%v: cannot compile lambda, using tree-walker: %v", c.fname, err)
+	} else {
+		l.code = lc.code
+	}
+	seen := make(map[string]bool)
+	collectNames(body, func(n string) {
+		if seen[n] || lambdaArgRe.MatchString(n) {
+			return
+		}
+		seen[n] = true
+		l.free = append(l.free, n)
+		s, ok := c.code.slotOf[n]
+		if !ok {
+			s = -1
+		}
+		l.freeSlots = append(l.freeSlots, s)
+	})
+	c.code.lambdas = append(c.code.lambdas, l)
+	c.emit(opLambda, len(c.code.lambdas)-1, 0)
+	return nil
+}
+
+func collectNames(st []types.Value, fn func(string)) {
+	for _, s := range st {
+		switch a := s.E.(type) {
+		case *types.Sexpr:
+			collectNames(a.List, fn)
+		case types.Ident:
+			fn(string(a))
+		}
+	}
+}
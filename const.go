@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Constants are defined on top level with (const name expr).
+// They are evaluated once after all files are parsed, references to constants
+// are replaced with their values in all function bodies, so constants are
+// visible in all modules and typed by the checker as literals.
+// Argument =name of function clause matches the value of constant name.
+
+type constDef struct {
+	name string
+	expr types.Value
+	file string
+	line int
+}
+
+// (const name expr)
+func (in *Interpret) defineConst(file string, line int, args []types.Value) error {
+	if len(args) != 2 {
+		return fmt.Errorf("'const' expects name and value, found: %v", args)
+	}
+	name, ok := args[0].E.(types.Ident)
+	if !ok {
+		return fmt.Errorf("'const' expects name of constant, found: %v", args[0])
+	}
+	if _, ok := types.ParseType(string(name)); ok {
+		return fmt.Errorf("'const' expects name of constant, found type: %v", string(name))
+	}
+	for _, c := range in.consts {
+		if c.name == string(name) {
+			return fmt.Errorf("Constant %v is already defined in %v:%d", c.name, c.file, c.line)
+		}
+	}
+	in.consts = append(in.consts, &constDef{name: string(name), expr: args[1], file: file, line: line})
+	return nil
+}
+
+// evalConsts evaluates constants in the order of their dependencies
+// and replaces references to them with their values.
+func (in *Interpret) evalConsts() error {
+	if len(in.consts) == 0 {
+		return in.checkConstPatterns()
+	}
+	defs := make(map[string]*constDef)
+	for _, c := range in.consts {
+		if _, ok := in.funcs[c.name]; ok {
+			return errorAt(c.file, c.line, fmt.Errorf("Constant %v conflicts with function %v", c.name, c.name))
+		}
+		defs[c.name] = c
+	}
+	// lambdas created while constants are evaluated are not needed at runtime
+	lambdas := in.lambdaCount
+	defer func() {
+		for n := lambdas; n < in.lambdaCount; n++ {
+			in.DeleteLambda(fmt.Sprintf("__lambda__%03d", n))
+		}
+	}()
+	values := make(map[string]*types.Value)
+	// constants which are being evaluated
+	var stack []string
+	var eval func(c *constDef) error
+	eval = func(c *constDef) error {
+		if _, ok := values[c.name]; ok {
+			return nil
+		}
+		for idx, name := range stack {
+			if name == c.name {
+				return errorAt(c.file, c.line, fmt.Errorf("Constant cycle: %v", strings.Join(append(stack[idx:], c.name), " -> ")))
+			}
+		}
+		stack = append(stack, c.name)
+		defer func() { stack = stack[:len(stack)-1] }()
+		for _, dep := range in.constDeps(c.expr, defs) {
+			if err := eval(defs[dep]); err != nil {
+				return err
+			}
+		}
+		// dependencies are inlined into the expression and functions it calls
+		body := []types.Value{c.expr}
+		inlineConsts(values, nil, body)
+		in.inlineFuncConsts(values)
+		fi := NewFuncInterpret(in, "__const_"+c.name)
+		if err := fi.AddImpl(types.Ident("__args"), body, false, types.TypeAny); err != nil {
+			return err
+		}
+		v, err := fi.Eval(nil)
+		if err != nil {
+			return errorAt(c.file, c.line, fmt.Errorf("Cannot evaluate constant %v: %w", c.name, err))
+		}
+		if values[c.name], err = constValue(v); err != nil {
+			return errorAt(c.file, c.line, fmt.Errorf("Constant %v: %w", c.name, err))
+		}
+		return nil
+	}
+	for _, c := range in.consts {
+		if err := eval(c); err != nil {
+			return err
+		}
+	}
+	in.inlineFuncConsts(values)
+	inlineConsts(values, nil, in.mainBody)
+	for _, fi := range in.tests {
+		inlineConsts(values, nil, fi.bodies[0].body)
+	}
+	return in.checkConstPatterns()
+}
+
+// checkConstPatterns reports arguments matching constants which are not replaced with their values.
+func (in *Interpret) checkConstPatterns() error {
+	for _, fn := range in.funcs {
+		fi, ok := fn.(*FuncInterpret)
+		if !ok {
+			continue
+		}
+		for _, impl := range fi.bodies {
+			if impl.argfmt == nil {
+				continue
+			}
+			for _, arg := range impl.argfmt.Args {
+				name, ok := arg.constPattern()
+				if !ok {
+					continue
+				}
+				err := fmt.Errorf("%v: unknown constant %v in arguments", fi.name, name)
+				for _, c := range in.consts {
+					if c.name == name {
+						err = fmt.Errorf("%v: constant %v cannot be used in arguments: only numbers, strings, booleans and empty list can", fi.name, name)
+					}
+				}
+				return inFunc(fi.name, errorAtCol(impl.file, impl.line, impl.col, err))
+			}
+		}
+	}
+	return nil
+}
+
+// constDeps returns constants used by the expression directly or by functions it calls.
+func (in *Interpret) constDeps(expr types.Value, defs map[string]*constDef) []string {
+	var deps []string
+	seen := make(map[string]bool)
+	var walk func(body []types.Value)
+	walk = func(body []types.Value) {
+		collectNames(body, func(name string) {
+			if seen[name] {
+				return
+			}
+			seen[name] = true
+			if _, ok := defs[name]; ok {
+				deps = append(deps, name)
+				return
+			}
+			if fi, ok := in.funcs[name].(*FuncInterpret); ok {
+				for _, impl := range fi.bodies {
+					walk(impl.body)
+				}
+			}
+		})
+	}
+	walk([]types.Value{expr})
+	return deps
+}
+
+func (in *Interpret) inlineFuncConsts(values map[string]*types.Value) {
+	for _, fn := range in.funcs {
+		fi, ok := fn.(*FuncInterpret)
+		if !ok {
+			continue
+		}
+		for _, impl := range fi.bodies {
+			if impl.argfmt != nil {
+				impl.argfmt.bindConsts(values)
+			}
+			inlineConsts(values, impl.argfmt, impl.body)
+		}
+	}
+}
+
+// inlineConsts replaces names of constants which are not shadowed by local variables with their values.
+func inlineConsts(values map[string]*types.Value, argfmt *ArgFmt, body []types.Value) {
+	if len(values) == 0 {
+		return
+	}
+	locals := localNames(argfmt, body)
+	var walk func(body []types.Value)
+	walk = func(body []types.Value) {
+		for i := range body {
+			switch a := body[i].E.(type) {
+			case types.Ident:
+				if v, ok := values[string(a)]; ok && !locals[string(a)] {
+					body[i] = *v
+				}
+			case *types.Sexpr:
+				if !a.Quoted {
+					walk(a.List)
+				}
+			}
+		}
+	}
+	walk(body)
+}
+
+// constValue converts the value of constant into literal, lists are evaluated completely.
+func constValue(v *types.Value) (*types.Value, error) {
+	switch a := v.E.(type) {
+	case types.Int, types.Float, types.Str, types.Bool:
+		return v, nil
+	case types.Ident:
+		if strings.HasPrefix(string(a), "__lambda__") {
+			return nil, fmt.Errorf("lambda cannot be a value of constant")
+		}
+		return v, nil
+	case types.List:
+		list := &types.Sexpr{Quoted: true}
+		var l types.List = a
+		for !l.Empty() {
+			head, err := l.Head()
+			if err != nil {
+				return nil, err
+			}
+			item, err := constValue(head)
+			if err != nil {
+				return nil, err
+			}
+			list.List = append(list.List, *item)
+			if l, err = l.Tail(); err != nil {
+				return nil, err
+			}
+		}
+		return &types.Value{E: list, T: v.T}, nil
+	}
+	return nil, fmt.Errorf("unsupported value %v", v)
+}
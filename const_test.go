@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConstErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		err  string
+	}{
+		{"cycle", "(const a b)\n(const b (inc a))", "Constant cycle: a -> b -> a"},
+		{"cycle through function", "(def f () (inc a))\n(const a (f))", "Constant cycle: a -> a"},
+		{"redefinition", "(const a 1)\n(const a 2)", "Constant a is already defined"},
+		{"function", "(def a () 1)\n(const a 2)", "Constant a conflicts with function a"},
+		{"lambda", "(const f (lambda (+ _1 1)))", "lambda cannot be a value of constant"},
+		{"arguments", "(const a)", "'const' expects name and value"},
+		{"type checking", "(const a \"s\")\n(def f (x:int) x)\n(print (f a))", "no matching function implementation found"},
+		{"unknown pattern", "(def f (=a) 1)", "f: unknown constant a in arguments"},
+		{"list pattern", "(const a '(1))\n(def f (=a) 1)", "f: constant a cannot be used in arguments"},
+		{"typed pattern", "(const a 1)\n(def f (=a:int) 1)", "Expected name of constant in argument =a:int"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := NewInterpreter(ioutil.Discard)
+			err := run(in, "main.lisp", strings.NewReader(test.code), true)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error %q, found %v", test.err, err)
+			}
+		})
+	}
+}
+
+// Parameters named as constants of other modules are variables.
+func TestConstShadowedInModule(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib.lisp"), []byte("(const n 100)\n(def big? (=n) true)\n(def big? (_) false)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "main.lisp")
+	code := "(use \"lib.lisp\")\n(def double (n) (* n 2))\n(print (double 3) (big? 100) (big? 3))\n"
+	for _, vm := range []bool{true, false} {
+		out := &bytes.Buffer{}
+		in := NewInterpreter(out)
+		in.Stderr = os.Stderr
+		if err := run(in, file, strings.NewReader(code), vm); err != nil {
+			t.Fatal(err)
+		}
+		if exp := "6 true false\n"; out.String() != exp {
+			t.Errorf("Incorrect output (vm: %v): expected %q, actual %q", vm, exp, out.String())
+		}
+	}
+}
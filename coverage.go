@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Code coverage (see "spil run -cover").
+//
+// Coverage is collected by the tree-walking interpreter: FuncRuntime.bind counts matched clauses,
+// FuncRuntime.lastParameter counts evaluated expressions and taken if branches.
+
+// Kinds of coverage blocks.
+const (
+	coverClause = "clause"
+	coverExpr   = "expr"
+	coverThen   = "then"
+	coverElse   = "else"
+)
+
+type coverBlock struct {
+	Kind string
+	File string
+	Line int
+	// clause description for clauses
+	Name  string
+	Count int
+}
+
+type coverage struct {
+	clauses  map[*FuncImpl]*coverBlock
+	exprs    map[*types.Sexpr]*coverBlock
+	branches map[*types.Sexpr][2]*coverBlock
+	blocks   []*coverBlock
+}
+
+// EnableCoverage registers clauses, expressions and if branches of parsed program.
+// It should be called after Parse, the program should be neither optimized nor compiled.
+func (in *Interpret) EnableCoverage() {
+	c := &coverage{
+		clauses:  make(map[*FuncImpl]*coverBlock),
+		exprs:    make(map[*types.Sexpr]*coverBlock),
+		branches: make(map[*types.Sexpr][2]*coverBlock),
+	}
+	fis := []*FuncInterpret{in.main}
+	for _, fn := range in.funcs {
+		if fi, ok := fn.(*FuncInterpret); ok {
+			fis = append(fis, fi)
+		}
+	}
+	fis = append(fis, in.tests...)
+	for _, fi := range fis {
+		for _, impl := range fi.bodies {
+			if impl.file == "" || strings.HasPrefix(impl.file, "library/") {
+				continue
+			}
+			if fi != in.main {
+				c.clauses[impl] = c.add(coverClause, impl.file, impl.line, fi.name+" "+argfmtString(impl.argfmt))
+			}
+			c.register(impl.body)
+		}
+	}
+	in.cover = c
+}
+
+func (c *coverage) add(kind, file string, line int, name string) *coverBlock {
+	b := &coverBlock{Kind: kind, File: file, Line: line, Name: name}
+	c.blocks = append(c.blocks, b)
+	return b
+}
+
+func (c *coverage) register(body []types.Value) {
+	for _, st := range body {
+		se, ok := st.E.(*types.Sexpr)
+		if !ok || se.Quoted || se.Length() == 0 {
+			continue
+		}
+		if se.Line > 0 {
+			c.exprs[se] = c.add(coverExpr, se.File, se.Line, "")
+			if head, ok := se.List[0].E.(types.Ident); ok && head == "if" && se.Length() == 4 && !se.Lambda {
+				c.branches[se] = [2]*coverBlock{
+					c.add(coverThen, se.File, branchLine(se.List[2], se.Line), ""),
+					c.add(coverElse, se.File, branchLine(se.List[3], se.Line), ""),
+				}
+			}
+		}
+		c.register(se.List)
+	}
+}
+
+func branchLine(v types.Value, line int) int {
+	if se, ok := v.E.(*types.Sexpr); ok && se.Line > 0 {
+		return se.Line
+	}
+	return line
+}
+
+func (c *coverage) clause(impl *FuncImpl) {
+	if b, ok := c.clauses[impl]; ok {
+		b.Count++
+	}
+}
+
+func (c *coverage) expr(se *types.Sexpr) {
+	if b, ok := c.exprs[se]; ok {
+		b.Count++
+	}
+}
+
+func (c *coverage) branch(se *types.Sexpr, cond bool) {
+	b, ok := c.branches[se]
+	if !ok {
+		return
+	}
+	if cond {
+		b[0].Count++
+	} else {
+		b[1].Count++
+	}
+}
+
+// alias counts evaluation of copied expression (e.g. lambda body) as evaluation of the original one.
+func (c *coverage) alias(copied, orig *types.Sexpr) {
+	if b, ok := c.exprs[orig]; ok {
+		c.exprs[copied] = b
+	}
+	if b, ok := c.branches[orig]; ok {
+		c.branches[copied] = b
+	}
+}
+
+// CoverBlocks returns collected coverage sorted by source position.
+func (in *Interpret) CoverBlocks() []coverBlock {
+	if in.cover == nil {
+		return nil
+	}
+	res := make([]coverBlock, 0, len(in.cover.blocks))
+	for _, b := range in.cover.blocks {
+		res = append(res, *b)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].File != res[j].File {
+			return res[i].File < res[j].File
+		}
+		return res[i].Line < res[j].Line
+	})
+	return res
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	code := `(def fact (0) :int 1)
+(def fact (n:int) :int
+	(* n (fact (- n 1))))
+(def sign (n:int)
+	(if (< n 0) "negative" "positive"))
+(def unused (x) (+ x 1))
+(print (fact 3) (sign 1))
+(set inc \(+ _1 1))
+(print (inc 2) (inc 3))
+`
+	in := NewInterpreter(ioutil.Discard)
+	if err := in.Parse("prog.lisp", strings.NewReader(code)); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	in.EnableCoverage()
+	if err := in.RunArgs(nil); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	var act []string
+	for _, b := range in.CoverBlocks() {
+		if b.Kind != coverExpr {
+			act = append(act, strings.TrimSpace(fmt.Sprintf("%v %d %d %v", b.Kind, b.Line, b.Count, b.Name)))
+		}
+	}
+	exp := []string{
+		"clause 1 1 fact (0)",
+		"clause 2 3 fact (n:int)",
+		"clause 4 1 sign (n:int)",
+		"then 5 0",
+		"else 5 1",
+		"clause 6 0 unused (x)",
+	}
+	if !reflect.DeepEqual(act, exp) {
+		t.Errorf("Incorrect coverage:\nexpected %q,\n  actual %q", exp, act)
+	}
+	lines := make(map[int][]int)
+	for _, b := range in.CoverBlocks() {
+		if b.Kind == coverExpr {
+			lines[b.Line] = append(lines[b.Line], b.Count)
+		}
+	}
+	expLines := map[int][]int{
+		3: {3, 3, 3},
+		5: {1, 1},
+		6: {0},
+		7: {1, 1, 1},
+		// lambda is created once and called twice
+		8: {1, 3},
+		9: {1, 1, 1},
+	}
+	if !reflect.DeepEqual(lines, expLines) {
+		t.Errorf("Incorrect coverage of expressions:\nexpected %v,\n  actual %v", expLines, lines)
+	}
+}
+
+func TestCoverProfile(t *testing.T) {
+	a := []coverBlock{
+		{Kind: coverClause, File: "a.lisp", Line: 1, Name: "f (x)", Count: 1},
+		{Kind: coverExpr, File: "a.lisp", Line: 2, Count: 0},
+		{Kind: coverExpr, File: "a.lisp", Line: 2, Count: 3},
+	}
+	b := []coverBlock{
+		{Kind: coverClause, File: "a.lisp", Line: 1, Name: "f (x)", Count: 2},
+		{Kind: coverExpr, File: "a.lisp", Line: 2, Count: 0},
+		{Kind: coverExpr, File: "a.lisp", Line: 2, Count: 2},
+		{Kind: coverThen, File: "b.lisp", Line: 5, Count: 1},
+	}
+	merged := mergeCover(a, b)
+	exp := []coverBlock{
+		{Kind: coverClause, File: "a.lisp", Line: 1, Name: "f (x)", Count: 3},
+		{Kind: coverExpr, File: "a.lisp", Line: 2, Count: 0},
+		{Kind: coverExpr, File: "a.lisp", Line: 2, Count: 5},
+		{Kind: coverThen, File: "b.lisp", Line: 5, Count: 1},
+	}
+	if !reflect.DeepEqual(merged, exp) {
+		t.Errorf("Incorrect merged coverage:\nexpected %v,\n  actual %v", exp, merged)
+	}
+
+	file := filepath.Join(t.TempDir(), "out.cov")
+	if err := writeCoverProfile(file, merged); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readCoverProfile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, merged) {
+		t.Errorf("Incorrect profile:\nexpected %v,\n  actual %v", merged, read)
+	}
+
+	out := &strings.Builder{}
+	writeCoverText(out, merged)
+	for _, s := range []string{
+		"a.lisp: 50.0% of expressions, 1 of 1 clauses, 0 of 0 branches covered\n",
+		"    a.lisp:2: 1 of 2 expressions are not covered\n",
+		"total: 50.0% of expressions covered\n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Text report does not contain %q:\n%v", s, out)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// "spil run -cover file" writes coverage profile, "spil cover" renders it as text or HTML.
+//
+// Profile starts with "mode: count" line followed by blocks:
+// kind<TAB>file<TAB>line<TAB>count<TAB>name
+
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	cover := flags.String("cover", "", "write coverage profile to file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil run [-cover file] file.lisp [args...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+	return runProgram(flags.Arg(0), flags.Args()[1:], *cover)
+}
+
+func coverCommand(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ExitOnError)
+	html := flags.String("html", "", "write HTML report to file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil cover [-html file] profile\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	blocks, err := readCoverProfile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *html == "" {
+		writeCoverText(os.Stdout, blocks)
+		return 0
+	}
+	f, err := os.Create(*html)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if err := writeCoverHTML(f, blocks); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func writeCoverProfile(file string, blocks []coverBlock) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "mode: count\n")
+	for _, bl := range blocks {
+		fmt.Fprintf(b, "%v\t%v\t%d\t%d\t%v\n", bl.Kind, bl.File, bl.Line, bl.Count, bl.Name)
+	}
+	return ioutil.WriteFile(file, []byte(b.String()), 0644)
+}
+
+func readCoverProfile(file string) ([]coverBlock, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != "mode: count" {
+		return nil, fmt.Errorf("%v: incorrect coverage profile header", file)
+	}
+	var blocks []coverBlock
+	for n := 2; scanner.Scan(); n++ {
+		fields := strings.SplitN(scanner.Text(), "\t", 5)
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("%v:%d: incorrect coverage block: %q", file, n, scanner.Text())
+		}
+		line, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%v:%d: incorrect line: %v", file, n, err)
+		}
+		count, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("%v:%d: incorrect count: %v", file, n, err)
+		}
+		blocks = append(blocks, coverBlock{Kind: fields[0], File: fields[1], Line: line, Count: count, Name: fields[4]})
+	}
+	return blocks, scanner.Err()
+}
+
+// mergeCover adds counts of the same blocks collected in different runs.
+func mergeCover(a, b []coverBlock) []coverBlock {
+	res := append([]coverBlock{}, a...)
+	index := make(map[coverKey]int)
+	for i, k := range coverKeys(a) {
+		index[k] = i
+	}
+	for i, k := range coverKeys(b) {
+		if j, ok := index[k]; ok {
+			res[j].Count += b[i].Count
+		} else {
+			res = append(res, b[i])
+		}
+	}
+	return res
+}
+
+// coverKey identifies block: expressions on the same line are distinguished by their order.
+type coverKey struct {
+	kind, file, name string
+	line, n          int
+}
+
+func coverKeys(blocks []coverBlock) []coverKey {
+	seen := make(map[coverKey]int)
+	keys := make([]coverKey, len(blocks))
+	for i, bl := range blocks {
+		k := coverKey{kind: bl.Kind, file: bl.File, name: bl.Name, line: bl.Line}
+		keys[i] = k
+		keys[i].n = seen[k]
+		seen[k]++
+	}
+	return keys
+}
+
+// fileCover is coverage of source file.
+type fileCover struct {
+	File string
+	// line -> blocks
+	lines                  map[int][]coverBlock
+	exprs, clauses, branch [2]int // covered, total
+}
+
+func groupCover(blocks []coverBlock) []*fileCover {
+	files := make(map[string]*fileCover)
+	var names []string
+	for _, bl := range blocks {
+		fc, ok := files[bl.File]
+		if !ok {
+			fc = &fileCover{File: bl.File, lines: make(map[int][]coverBlock)}
+			files[bl.File] = fc
+			names = append(names, bl.File)
+		}
+		fc.lines[bl.Line] = append(fc.lines[bl.Line], bl)
+		var stat *[2]int
+		switch bl.Kind {
+		case coverExpr:
+			stat = &fc.exprs
+		case coverClause:
+			stat = &fc.clauses
+		default:
+			stat = &fc.branch
+		}
+		stat[1]++
+		if bl.Count > 0 {
+			stat[0]++
+		}
+	}
+	sort.Strings(names)
+	res := make([]*fileCover, 0, len(names))
+	for _, name := range names {
+		res = append(res, files[name])
+	}
+	return res
+}
+
+func percent(stat [2]int) float64 {
+	if stat[1] == 0 {
+		return 100
+	}
+	return 100 * float64(stat[0]) / float64(stat[1])
+}
+
+// notes describes uncovered blocks of the line.
+func (fc *fileCover) notes(line int) (notes []string) {
+	exprs, uncovered := 0, 0
+	for _, bl := range fc.lines[line] {
+		if bl.Kind == coverExpr {
+			exprs++
+			if bl.Count == 0 {
+				uncovered++
+			}
+			continue
+		}
+		if bl.Count > 0 {
+			continue
+		}
+		if bl.Kind == coverClause {
+			notes = append(notes, fmt.Sprintf("clause %v is not covered", bl.Name))
+		} else {
+			notes = append(notes, fmt.Sprintf("%v branch is not covered", bl.Kind))
+		}
+	}
+	if uncovered > 0 {
+		notes = append(notes, fmt.Sprintf("%d of %d expressions are not covered", uncovered, exprs))
+	}
+	return notes
+}
+
+func (fc *fileCover) sortedLines() []int {
+	lines := make([]int, 0, len(fc.lines))
+	for l := range fc.lines {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+func displayName(file string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, file); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return file
+}
+
+func writeCoverText(w io.Writer, blocks []coverBlock) {
+	var total [2]int
+	for _, fc := range groupCover(blocks) {
+		name := displayName(fc.File)
+		fmt.Fprintf(w, "%v: %.1f%% of expressions, %d of %d clauses, %d of %d branches covered\n",
+			name, percent(fc.exprs), fc.clauses[0], fc.clauses[1], fc.branch[0], fc.branch[1])
+		for _, line := range fc.sortedLines() {
+			for _, note := range fc.notes(line) {
+				fmt.Fprintf(w, "    %v:%d: %v\n", name, line, note)
+			}
+		}
+		total[0] += fc.exprs[0]
+		total[1] += fc.exprs[1]
+	}
+	fmt.Fprintf(w, "total: %.1f%% of expressions covered\n", percent(total))
+}
+
+type htmlLine struct {
+	N     int
+	Text  string
+	Class string
+	Notes string
+}
+
+type htmlFile struct {
+	Name    string
+	Percent float64
+	Lines   []htmlLine
+}
+
+func writeCoverHTML(w io.Writer, blocks []coverBlock) error {
+	var files []htmlFile
+	for _, fc := range groupCover(blocks) {
+		data, err := ioutil.ReadFile(fc.File)
+		if err != nil {
+			return err
+		}
+		hf := htmlFile{Name: displayName(fc.File), Percent: percent(fc.exprs)}
+		for i, text := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			l := htmlLine{N: i + 1, Text: text}
+			if bls, ok := fc.lines[l.N]; ok {
+				l.Class = "covered"
+				covered := false
+				for _, bl := range bls {
+					if bl.Count > 0 {
+						covered = true
+					} else {
+						l.Class = "partial"
+					}
+				}
+				if !covered {
+					l.Class = "uncovered"
+				}
+				l.Notes = strings.Join(fc.notes(l.N), "; ")
+			}
+			hf.Lines = append(hf.Lines, l)
+		}
+		files = append(files, hf)
+	}
+	return coverTemplate.Execute(w, files)
+}
+
+var coverTemplate = template.Must(template.New("cover").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>SPIL coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; }
+.n { color: #999; }
+.covered { background: #dfd; }
+.partial { background: #ffc; }
+.uncovered { background: #fdd; }
+.note { color: #c00; font-style: italic; }
+</style>
+</head>
+<body>
+{{range .}}<h2>{{.Name}}: {{printf "%.1f" .Percent}}% of expressions covered</h2>
+<pre>
+{{range .Lines}}<span class="n">{{printf "%4d" .N}}</span> <span class="{{.Class}}">{{.Text}}</span>{{if .Notes}}  <span class="note">; {{.Notes}}</span>{{end}}
+{{end}}</pre>
+{{end}}</body>
+</html>
+`))
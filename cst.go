@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Concrete syntax tree keeps comments and blank lines discarded by Parser,
+// so the source can be printed back in canonical layout (see "spil fmt").
+
+type cstKind int
+
+const (
+	cstAtom cstKind = iota
+	cstList
+	cstComment
+)
+
+type cstNode struct {
+	Kind cstKind
+	// token of the atom or text of the comment
+	Text string
+	// opening brace of the list: "(", "'(" or "\("
+	Open  string
+	Items []*cstNode
+	Line  int
+	// node is preceded by blank line(s)
+	BlankBefore bool
+}
+
+// ParseCST reads all top-level forms and comments.
+func ParseCST(r io.Reader) ([]*cstNode, error) {
+	scanner := bufio.NewScanner(r)
+	root := &cstNode{Kind: cstList}
+	stack := []*cstNode{root}
+	blank := false
+	add := func(n *cstNode) {
+		n.BlankBefore = blank
+		blank = false
+		top := stack[len(stack)-1]
+		top.Items = append(top.Items, n)
+	}
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			blank = true
+			continue
+		}
+		if text[0] == '#' || text[0] == ';' {
+			add(&cstNode{Kind: cstComment, Text: text, Line: line})
+			continue
+		}
+		for _, token := range tokenizeLine(text) {
+			switch token {
+			case "(", "'(", `\(`:
+				n := &cstNode{Kind: cstList, Open: token, Line: line}
+				add(n)
+				stack = append(stack, n)
+			case ")":
+				if len(stack) == 1 {
+					return nil, errorAt("", line, fmt.Errorf("Unexpected ')'"))
+				}
+				stack = stack[:len(stack)-1]
+				// blank lines before closing brace are dropped
+				blank = false
+			default:
+				add(&cstNode{Kind: cstAtom, Text: token, Line: line})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stack) > 1 {
+		return nil, errorAt("", stack[len(stack)-1].Line, UnexpectedEOF)
+	}
+	return root.Items, nil
+}
+
+const (
+	fmtLineWidth = 80
+	fmtTabWidth  = 4
+)
+
+// FormatCST prints nodes in canonical layout:
+//   - nested forms are indented with tabs, one tab per level;
+//   - form is kept on a single line if it fits into fmtLineWidth columns,
+//     otherwise its arguments are placed on separate lines;
+//   - function definitions with several body expressions are always broken;
+//   - bodies of consecutive single-line clauses of the same function are aligned;
+//   - boolean literals are written as 'T and 'F;
+//   - at most one blank line is kept between forms.
+func FormatCST(nodes []*cstNode) []byte {
+	p := &cstPrinter{}
+	for i := 0; i < len(nodes); {
+		if i > 0 && nodes[i].BlankBefore {
+			p.b.WriteString("\n")
+		}
+		group := clauseGroup(nodes[i:])
+		i += len(group)
+		if len(group) > 1 && p.aligned(group) {
+			continue
+		}
+		if len(group) == 0 {
+			group = nodes[i : i+1]
+			i++
+		}
+		for _, n := range group {
+			p.node(n, 0, 0)
+			p.newline()
+		}
+	}
+	return []byte(p.b.String())
+}
+
+type cstPrinter struct {
+	b strings.Builder
+	// current column
+	col int
+}
+
+func (p *cstPrinter) write(s string) {
+	p.b.WriteString(s)
+	p.col += utf8.RuneCountInString(s)
+}
+
+func (p *cstPrinter) newline() {
+	p.b.WriteString("\n")
+	p.col = 0
+}
+
+func (p *cstPrinter) indent(n int) {
+	p.b.WriteString(strings.Repeat("\t", n))
+	p.col = n * fmtTabWidth
+}
+
+// node prints n starting at the current column.
+// Continuation lines are indented relative to indent,
+// tail is the width of the text which follows n on the same line.
+func (p *cstPrinter) node(n *cstNode, indent, tail int) {
+	if n.Kind != cstList {
+		p.write(atomText(n))
+		return
+	}
+	if flat, ok := flatText(n); ok && !forcedBreak(n) && p.col+utf8.RuneCountInString(flat)+tail <= fmtLineWidth {
+		p.write(flat)
+		return
+	}
+	p.write(n.Open)
+	items := n.Items
+	head := headerSize(n)
+	for i := 0; i < head; i++ {
+		if i > 0 {
+			p.write(" ")
+		}
+		p.node(items[i], indent+1, itemTail(items, i, tail))
+	}
+	for i := head; i < len(items); i++ {
+		item := items[i]
+		if isAnnotation(items, i) {
+			p.write(" " + item.Text)
+			continue
+		}
+		if item.BlankBefore {
+			p.newline()
+		}
+		p.newline()
+		p.indent(indent + 1)
+		p.node(item, indent+1, itemTail(items, i, tail))
+	}
+	if len(items) > 0 && items[len(items)-1].Kind == cstComment {
+		p.newline()
+		p.indent(indent)
+	}
+	p.write(")")
+}
+
+// itemTail returns the width of text following items[i] on its line.
+func itemTail(items []*cstNode, i, tail int) int {
+	if i+1 < len(items) && isAnnotation(items, i+1) {
+		return 1 + utf8.RuneCountInString(items[i+1].Text) + itemTail(items, i+1, tail)
+	}
+	if i+1 == len(items) {
+		return tail + 1
+	}
+	return 0
+}
+
+func atomText(n *cstNode) string {
+	switch n.Text {
+	case "true":
+		return "'T"
+	case "false":
+		return "'F"
+	}
+	return n.Text
+}
+
+// flatText returns single-line representation of n if n does not contain comments.
+func flatText(n *cstNode) (string, bool) {
+	switch n.Kind {
+	case cstComment:
+		return "", false
+	case cstAtom:
+		return atomText(n), true
+	}
+	parts := make([]string, 0, len(n.Items))
+	for _, item := range n.Items {
+		s, ok := flatText(item)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, s)
+	}
+	return n.Open + strings.Join(parts, " ") + ")", true
+}
+
+func headName(n *cstNode) string {
+	if n.Kind != cstList || n.Open != "(" || len(n.Items) == 0 || n.Items[0].Kind != cstAtom {
+		return ""
+	}
+	return n.Items[0].Text
+}
+
+func isDefinition(n *cstNode) bool {
+	switch headName(n) {
+	case "def", "def'", "func", "func'":
+		return true
+	}
+	return false
+}
+
+// headerSize returns the number of items placed on the first line of broken list.
+func headerSize(n *cstNode) int {
+	size := 1
+	switch name := headName(n); {
+	case isDefinition(n):
+		// (def name (args) :ret
+		size = 3
+		if len(n.Items) > 3 && isType(n.Items[3]) {
+			size = 4
+		}
+	case name == "do" || name == "":
+		size = 1
+	default:
+		size = 2
+	}
+	for i, item := range n.Items {
+		if i >= size {
+			break
+		}
+		if item.Kind == cstComment {
+			return i
+		}
+	}
+	if size > len(n.Items) {
+		size = len(n.Items)
+	}
+	return size
+}
+
+func isType(n *cstNode) bool {
+	return n.Kind == cstAtom && strings.HasPrefix(n.Text, ":")
+}
+
+// isAnnotation reports if items[i] is type annotation of the preceding expression.
+func isAnnotation(items []*cstNode, i int) bool {
+	return i > 0 && isType(items[i]) && items[i-1].Kind != cstComment && !items[i].BlankBefore
+}
+
+// bodySize returns the number of body expressions of function definition.
+// Docstring of definition is not counted.
+func bodySize(n *cstNode) int {
+	size := 0
+	for i := headerSize(n); i < len(n.Items); i++ {
+		if !isAnnotation(n.Items, i) {
+			size++
+		}
+	}
+	if size > 1 && isDefinition(n) {
+		if doc := n.Items[headerSize(n)]; doc.Kind == cstAtom && strings.HasPrefix(doc.Text, "\"") {
+			size--
+		}
+	}
+	return size
+}
+
+// forcedBreak reports if n is definition which should not be written on a single line.
+func forcedBreak(n *cstNode) bool {
+	return isDefinition(n) && bodySize(n) > 1
+}
+
+// clauseGroup returns consecutive clauses of the same function at the beginning of nodes.
+func clauseGroup(nodes []*cstNode) []*cstNode {
+	first := nodes[0]
+	if !isDefinition(first) || len(first.Items) < 2 || first.Items[1].Kind != cstAtom || bodySize(first) != 1 {
+		return nil
+	}
+	i := 1
+	for ; i < len(nodes); i++ {
+		n := nodes[i]
+		if n.BlankBefore || headName(n) != headName(first) || len(n.Items) < 2 || n.Items[1].Text != first.Items[1].Text || bodySize(n) != 1 {
+			break
+		}
+	}
+	return nodes[:i]
+}
+
+// aligned prints single-line clauses with aligned bodies.
+// It returns false (and prints nothing) if some of the clauses do not fit into line.
+func (p *cstPrinter) aligned(group []*cstNode) bool {
+	headers := make([]string, len(group))
+	bodies := make([]string, len(group))
+	width := 0
+	for i, n := range group {
+		flat, ok := flatText(n)
+		if !ok || utf8.RuneCountInString(flat) > fmtLineWidth {
+			return false
+		}
+		head := headerSize(n)
+		h, _ := flatText(&cstNode{Kind: cstList, Open: n.Open, Items: n.Items[:head]})
+		headers[i] = strings.TrimSuffix(h, ")")
+		b, _ := flatText(&cstNode{Kind: cstList, Items: n.Items[head:]})
+		bodies[i] = b
+		if w := utf8.RuneCountInString(headers[i]); w > width {
+			width = w
+		}
+	}
+	for i := range group {
+		if width+1+utf8.RuneCountInString(bodies[i]) > fmtLineWidth {
+			return false
+		}
+	}
+	for i := range group {
+		pad := width - utf8.RuneCountInString(headers[i])
+		p.write(headers[i] + strings.Repeat(" ", pad+1) + bodies[i])
+		p.newline()
+	}
+	return true
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Debug Adapter Protocol server (https://microsoft.github.io/debug-adapter-protocol/).
+//
+// Requests are handled in the main loop while the program runs in its own goroutine.
+// When the program stops, it sends "stopped" event and waits for resuming request
+// (continue, next, stepIn, stepOut). Stack and variables are available only while the program is stopped.
+// Program output is sent as "output" events.
+
+type dapMessage struct {
+	Seq     int    `json:"seq"`
+	Type    string `json:"type"`
+	Command string `json:"command,omitempty"`
+	Event   string `json:"event,omitempty"`
+
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+
+	RequestSeq int         `json:"request_seq,omitempty"`
+	Success    bool        `json:"success,omitempty"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapBreakpoint struct {
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+const dapThreadID = 1
+
+type dapServer struct {
+	r *bufio.Reader
+	w io.Writer
+	// guards writing messages and fields below
+	mu  sync.Mutex
+	seq int
+
+	in   *Interpret
+	d    *debugger
+	args []string
+	// program is stopped and waits for action
+	stopped bool
+	resume  chan debugAction
+	// breakpoints set before launch
+	lines map[string][]int
+	funcs []string
+}
+
+func newDapServer(r io.Reader, w io.Writer) *dapServer {
+	return &dapServer{
+		r:      bufio.NewReader(r),
+		w:      w,
+		resume: make(chan debugAction),
+		lines:  make(map[string][]int),
+	}
+}
+
+// readMessage reads message with Content-Length header used by both DAP and LSP.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("incorrect Content-Length: %v", err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func writeMessage(w io.Writer, data []byte) {
+	fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (s *dapServer) read() (*dapMessage, error) {
+	data, err := readMessage(s.r)
+	if err != nil {
+		return nil, err
+	}
+	m := &dapMessage{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("dap: incorrect message: %v", err)
+	}
+	return m, nil
+}
+
+func (s *dapServer) send(m *dapMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	m.Seq = s.seq
+	data, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	writeMessage(s.w, data)
+}
+
+func (s *dapServer) respond(req *dapMessage, body interface{}) {
+	s.send(&dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: true, Body: body})
+}
+
+func (s *dapServer) fail(req *dapMessage, format string, args ...interface{}) {
+	s.send(&dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: fmt.Sprintf(format, args...)})
+}
+
+func (s *dapServer) event(name string, body interface{}) {
+	s.send(&dapMessage{Type: "event", Event: name, Body: body})
+}
+
+// Write sends program output.
+func (s *dapServer) Write(p []byte) (int, error) {
+	s.event("output", map[string]interface{}{"category": "stdout", "output": string(p)})
+	return len(p), nil
+}
+
+func (s *dapServer) serve() error {
+	for {
+		req, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if done := s.handle(req); done {
+			return nil
+		}
+	}
+}
+
+// handle handles request and returns true if the session is finished.
+func (s *dapServer) handle(req *dapMessage) bool {
+	switch req.Command {
+	case "initialize":
+		s.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+		})
+	case "launch":
+		var args struct {
+			Program     string   `json:"program"`
+			Args        []string `json:"args"`
+			StopOnEntry bool     `json:"stopOnEntry"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			s.fail(req, "incorrect arguments: %v", err)
+			break
+		}
+		in, err := loadProgram(args.Program, s)
+		if err != nil {
+			s.fail(req, "%v", err)
+			break
+		}
+		s.in, s.args = in, args.Args
+		s.d = in.EnableDebugger(args.StopOnEntry, s.onStop)
+		for file, lines := range s.lines {
+			s.d.SetBreakpoints(file, lines)
+		}
+		s.d.SetFuncBreakpoints(s.funcs)
+		s.respond(req, nil)
+		s.event("initialized", nil)
+	case "setBreakpoints":
+		var args struct {
+			Source      dapSource `json:"source"`
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			s.fail(req, "incorrect arguments: %v", err)
+			break
+		}
+		file, _ := filepath.Abs(args.Source.Path)
+		var breakable map[int]bool
+		if s.in != nil {
+			breakable = s.in.breakableLines(file)
+		}
+		var lines []int
+		res := []dapBreakpoint{}
+		for _, b := range args.Breakpoints {
+			bp := dapBreakpoint{Verified: true, Line: b.Line}
+			if breakable != nil && !breakable[b.Line] {
+				bp = dapBreakpoint{Line: b.Line, Message: "no code at this line"}
+			} else {
+				lines = append(lines, b.Line)
+			}
+			res = append(res, bp)
+		}
+		s.mu.Lock()
+		s.lines[file] = lines
+		s.mu.Unlock()
+		if s.d != nil {
+			s.d.SetBreakpoints(file, lines)
+		}
+		s.respond(req, map[string]interface{}{"breakpoints": res})
+	case "setFunctionBreakpoints":
+		var args struct {
+			Breakpoints []struct {
+				Name string `json:"name"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			s.fail(req, "incorrect arguments: %v", err)
+			break
+		}
+		s.funcs = nil
+		res := []dapBreakpoint{}
+		for _, b := range args.Breakpoints {
+			if s.in != nil {
+				if _, ok := s.in.funcs[b.Name].(*FuncInterpret); !ok {
+					res = append(res, dapBreakpoint{Message: "unknown function"})
+					continue
+				}
+			}
+			s.funcs = append(s.funcs, b.Name)
+			res = append(res, dapBreakpoint{Verified: true})
+		}
+		if s.d != nil {
+			s.d.SetFuncBreakpoints(s.funcs)
+		}
+		s.respond(req, map[string]interface{}{"breakpoints": res})
+	case "configurationDone":
+		if s.in == nil {
+			s.fail(req, "program is not launched")
+			break
+		}
+		s.respond(req, nil)
+		go s.run()
+	case "threads":
+		s.respond(req, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": dapThreadID, "name": "main"}},
+		})
+	case "pause":
+		if s.d != nil {
+			s.d.Pause()
+		}
+		s.respond(req, nil)
+	case "continue", "next", "stepIn", "stepOut":
+		actions := map[string]debugAction{
+			"continue": debugContinue,
+			"next":     debugStepOver,
+			"stepIn":   debugStepIn,
+			"stepOut":  debugStepOut,
+		}
+		if !s.isStopped() {
+			s.fail(req, "program is not stopped")
+			break
+		}
+		s.setStopped(false)
+		if req.Command == "continue" {
+			s.respond(req, map[string]interface{}{"allThreadsContinued": true})
+		} else {
+			s.respond(req, nil)
+		}
+		s.resume <- actions[req.Command]
+	case "stackTrace":
+		if !s.isStopped() {
+			s.fail(req, "program is not stopped")
+			break
+		}
+		frames := []map[string]interface{}{}
+		for i, fr := range s.d.Frames() {
+			frames = append(frames, map[string]interface{}{
+				"id":     i + 1,
+				"name":   fr.Name,
+				"source": dapSource{Name: filepath.Base(fr.File), Path: fr.File},
+				"line":   fr.Line,
+				"column": 1,
+			})
+		}
+		s.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			s.fail(req, "incorrect arguments: %v", err)
+			break
+		}
+		// variables references: 2*frame+1 for locals, 2*frame+2 for captured variables
+		n := args.FrameID - 1
+		s.respond(req, map[string]interface{}{"scopes": []map[string]interface{}{
+			{"name": "Locals", "variablesReference": 2*n + 1, "expensive": false},
+			{"name": "Captured", "variablesReference": 2*n + 2, "expensive": false},
+		}})
+	case "variables":
+		var args struct {
+			Ref int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			s.fail(req, "incorrect arguments: %v", err)
+			break
+		}
+		n := (args.Ref - 1) / 2
+		if !s.isStopped() || n < 0 || n >= len(s.d.stack) {
+			s.fail(req, "no variables available")
+			break
+		}
+		vars := s.d.Locals(n)
+		if args.Ref%2 == 0 {
+			vars = s.d.Captured(n)
+		}
+		res := []map[string]interface{}{}
+		for _, v := range vars {
+			res = append(res, map[string]interface{}{
+				"name":               v.Name,
+				"value":              v.Value,
+				"type":               strings.TrimPrefix(string(v.Type), ":"),
+				"variablesReference": 0,
+			})
+		}
+		s.respond(req, map[string]interface{}{"variables": res})
+	case "disconnect", "terminate":
+		s.respond(req, nil)
+		if s.isStopped() {
+			s.setStopped(false)
+			s.resume <- debugAbort
+		}
+		return true
+	default:
+		s.fail(req, "unsupported request: %v", req.Command)
+	}
+	return false
+}
+
+func (s *dapServer) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+func (s *dapServer) setStopped(stopped bool) {
+	s.mu.Lock()
+	s.stopped = stopped
+	s.mu.Unlock()
+}
+
+// onStop is called in the program goroutine.
+func (s *dapServer) onStop(reason string) debugAction {
+	s.setStopped(true)
+	s.event("stopped", map[string]interface{}{
+		"reason":            reason,
+		"threadId":          dapThreadID,
+		"allThreadsStopped": true,
+	})
+	return <-s.resume
+}
+
+func (s *dapServer) run() {
+	code := 0
+	if err := s.in.RunArgs(s.args); err != nil {
+		code = 1
+		if !s.d.aborted {
+			s.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+		}
+	}
+	s.event("exited", map[string]interface{}{"exitCode": code})
+	s.event("terminated", nil)
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Debugger of spil programs (see "spil debug").
+//
+// The tree-walking interpreter reports to the debugger evaluation of every expression (FuncRuntime.lastParameter)
+// and binding of every clause including tail calls (FuncRuntime.bind).
+// When the program stops on a breakpoint or after a step, the frontend (interactive CLI or DAP server)
+// inspects the stack and decides how to resume.
+
+type debugAction int
+
+const (
+	debugContinue debugAction = iota
+	debugStepIn
+	debugStepOver
+	debugStepOut
+	debugAbort
+)
+
+var errDebugAbort = errors.New("program is terminated by debugger")
+
+type debugger struct {
+	stack []*debugFrame
+	// guards breakpoints which can be changed while the program is running
+	mu sync.Mutex
+	// file -> line breakpoints
+	lines map[string]map[int]bool
+	funcs map[string]bool
+
+	action debugAction
+	// depth of the stack where the last step started
+	depth int
+	entry bool
+	// program is terminated by frontend
+	aborted bool
+	// set by frontend to stop as soon as possible
+	pause int32
+
+	// onStop is called when the program stops, it returns how to resume the program.
+	onStop func(reason string) debugAction
+}
+
+type debugFrame struct {
+	rt *FuncRuntime
+	// position of the current expression
+	file string
+	line int
+}
+
+// EnableDebugger makes the program stop on breakpoints and steps.
+// The program should be neither optimized nor compiled.
+func (in *Interpret) EnableDebugger(stopOnEntry bool, onStop func(reason string) debugAction) *debugger {
+	d := &debugger{
+		lines:  make(map[string]map[int]bool),
+		funcs:  make(map[string]bool),
+		entry:  stopOnEntry,
+		onStop: onStop,
+	}
+	if stopOnEntry {
+		d.action = debugStepIn
+	}
+	in.debug = d
+	return d
+}
+
+// SetBreakpoints replaces line breakpoints of the file.
+func (d *debugger) SetBreakpoints(file string, lines []int) {
+	m := make(map[int]bool)
+	for _, l := range lines {
+		m[l] = true
+	}
+	d.mu.Lock()
+	d.lines[file] = m
+	d.mu.Unlock()
+}
+
+// SetFuncBreakpoints replaces function breakpoints.
+func (d *debugger) SetFuncBreakpoints(names []string) {
+	funcs := make(map[string]bool)
+	for _, n := range names {
+		funcs[n] = true
+	}
+	d.mu.Lock()
+	d.funcs = funcs
+	d.mu.Unlock()
+}
+
+func (d *debugger) Pause() {
+	atomic.StoreInt32(&d.pause, 1)
+}
+
+// breakableLines returns lines of the file where the program can stop:
+// clause definitions and starts of expressions.
+func (in *Interpret) breakableLines(file string) map[int]bool {
+	lines := make(map[int]bool)
+	var walk func(body []types.Value)
+	walk = func(body []types.Value) {
+		for _, st := range body {
+			if se, ok := st.E.(*types.Sexpr); ok && !se.Quoted {
+				if se.File == file && se.Line > 0 {
+					lines[se.Line] = true
+				}
+				walk(se.List)
+			}
+		}
+	}
+	fis := []*FuncInterpret{in.main}
+	for _, fn := range in.funcs {
+		if fi, ok := fn.(*FuncInterpret); ok {
+			fis = append(fis, fi)
+		}
+	}
+	fis = append(fis, in.tests...)
+	for _, fi := range fis {
+		for _, impl := range fi.bodies {
+			if impl.file == file && fi != in.main {
+				lines[impl.line] = true
+			}
+			walk(impl.body)
+		}
+	}
+	return lines
+}
+
+func (d *debugger) enter(rt *FuncRuntime) {
+	d.stack = append(d.stack, &debugFrame{rt: rt})
+}
+
+func (d *debugger) leave() {
+	d.stack = d.stack[:len(d.stack)-1]
+}
+
+func (d *debugger) frame(rt *FuncRuntime) (fr *debugFrame, depth int) {
+	for i := len(d.stack) - 1; i >= 0; i-- {
+		if d.stack[i].rt == rt {
+			return d.stack[i], i + 1
+		}
+	}
+	// should not happen: every function is evaluated by FuncInterpret.Eval
+	fr = &debugFrame{rt: rt}
+	d.stack = append(d.stack, fr)
+	return fr, len(d.stack)
+}
+
+func (d *debugger) expr(rt *FuncRuntime, se *types.Sexpr) error {
+	if se.Line == 0 {
+		return nil
+	}
+	fr, depth := d.frame(rt)
+	if fr.file == se.File && fr.line == se.Line {
+		// already passed this line
+		return nil
+	}
+	fr.file, fr.line = se.File, se.Line
+	d.mu.Lock()
+	isBreak := d.lines[se.File][se.Line]
+	d.mu.Unlock()
+	return d.event(depth, isBreak, "breakpoint")
+}
+
+// bound is called when arguments are bound to the clause on the function call or on the tail call.
+func (d *debugger) bound(rt *FuncRuntime, impl *FuncImpl) error {
+	fr, depth := d.frame(rt)
+	fr.file, fr.line = impl.file, impl.line
+	if impl.line == 0 {
+		// main
+		return nil
+	}
+	d.mu.Lock()
+	isBreak := d.funcs[rt.fi.name]
+	d.mu.Unlock()
+	return d.event(depth, isBreak, "function breakpoint")
+}
+
+func (d *debugger) event(depth int, isBreak bool, breakReason string) error {
+	if d.aborted {
+		return errDebugAbort
+	}
+	reason := ""
+	switch fr := d.stack[depth-1]; {
+	case atomic.LoadInt32(&d.pause) != 0:
+		reason = "pause"
+	case isBreak:
+		reason = breakReason
+	case fr.file == "" || strings.HasPrefix(fr.file, "library/"):
+		// do not step into library functions
+		return nil
+	case d.entry:
+		reason = "entry"
+	case d.action == debugStepIn,
+		d.action == debugStepOver && depth <= d.depth,
+		d.action == debugStepOut && depth < d.depth:
+		reason = "step"
+	default:
+		return nil
+	}
+	atomic.StoreInt32(&d.pause, 0)
+	d.entry = false
+	d.action = d.onStop(reason)
+	d.depth = depth
+	if d.action == debugAbort {
+		d.aborted = true
+		return errDebugAbort
+	}
+	return nil
+}
+
+// debugFrameInfo describes stack frame of stopped program.
+type debugFrameInfo struct {
+	Name string
+	File string
+	Line int
+}
+
+// Frames returns the call stack of stopped program starting from the innermost frame.
+func (d *debugger) Frames() []debugFrameInfo {
+	res := make([]debugFrameInfo, 0, len(d.stack))
+	for i := len(d.stack) - 1; i >= 0; i-- {
+		fr := d.stack[i]
+		name, _, _ := fr.rt.fi.position()
+		res = append(res, debugFrameInfo{Name: name, File: fr.file, Line: fr.line})
+	}
+	return res
+}
+
+type debugVar struct {
+	Name  string
+	Value string
+	Type  types.Type
+}
+
+// Locals returns variables of the frame n (0 is the innermost one).
+func (d *debugger) Locals(n int) []debugVar {
+	fr := d.stack[len(d.stack)-1-n]
+	vars := make(map[string]*types.Value)
+	lambda := strings.HasPrefix(fr.rt.fi.name, "__lambda__")
+	for name, v := range fr.rt.vars {
+		if !lambda && lambdaArgRe.MatchString(name) {
+			// positional arguments are shown for lambdas only
+			continue
+		}
+		v := v
+		vars[name] = &v
+	}
+	return debugVars(vars)
+}
+
+// Captured returns variables captured by the lambda of the frame n.
+func (d *debugger) Captured(n int) []debugVar {
+	return debugVars(d.stack[len(d.stack)-1-n].rt.fi.capturedVars)
+}
+
+func debugVars(vars map[string]*types.Value) []debugVar {
+	res := make([]debugVar, 0, len(vars))
+	for name, v := range vars {
+		if strings.HasPrefix(name, "__") {
+			// __args and __stdin
+			continue
+		}
+		res = append(res, debugVar{Name: name, Value: debugRepr(v.E), Type: v.T})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// debugRepr returns representation of the value which does not force evaluation of lazy lists.
+func debugRepr(e types.Expr) string {
+	b := &strings.Builder{}
+	switch a := e.(type) {
+	case types.Str:
+		return strconv.Quote(string(a))
+	case types.Ident:
+		if strings.HasPrefix(string(a), "__lambda__") {
+			return "lambda"
+		}
+		return string(a)
+	case *LazyList:
+		items := []string{}
+		for l := a; ; l = l.tail {
+			if !l.valueReady {
+				items = append(items, "...")
+				break
+			}
+			if l.value == nil {
+				break
+			}
+			items = append(items, debugRepr(l.value.E))
+			if l.tail == nil {
+				items = append(items, "...")
+				break
+			}
+		}
+		return "'(" + strings.Join(items, " ") + ")"
+	case *types.Sexpr:
+		if !a.Quoted {
+			a.Print(b)
+			break
+		}
+		b.WriteString("'(")
+		for i, item := range a.List {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString(debugRepr(item.E))
+		}
+		b.WriteString(")")
+	case *LazyInput:
+		return "<stdin>"
+	default:
+		e.Print(b)
+	}
+	return b.String()
+}
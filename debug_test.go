@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/avoronkov/spil/types"
+)
+
+const debugProgram = `(def fact (0) :int 1)
+(def fact (n:int) :int
+	(* n (fact (- n 1))))
+(def sum (acc 0) acc)
+(def sum (acc n)
+	(sum (+ acc n) (- n 1)))
+(set k 10)
+(set add \(+ _1 k))
+(print (fact 2))
+(print (sum 0 2))
+(print (add 5))
+`
+
+func writeDebugProgram(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spil-debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	file := filepath.Join(dir, "prog.lisp")
+	if err := ioutil.WriteFile(file, []byte(debugProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestDebugger(t *testing.T) {
+	file := writeDebugProgram(t)
+	tests := []struct {
+		name    string
+		entry   bool
+		lines   []int
+		funcs   []string
+		actions []debugAction
+		exp     []string
+	}{
+		{
+			name:    "step in",
+			entry:   true,
+			actions: []debugAction{debugStepIn, debugStepIn, debugStepIn, debugStepIn, debugStepIn, debugContinue},
+			exp: []string{
+				"entry __main__:7",
+				"step __main__:8 k=10",
+				"step __main__:9 add=lambda k=10",
+				"step fact:2 n=2",
+				"step fact:3 n=2",
+				"step fact:2 n=1",
+			},
+		},
+		{
+			name:    "step over",
+			entry:   true,
+			actions: []debugAction{debugStepOver, debugStepOver, debugStepOver, debugStepOver, debugContinue},
+			exp: []string{
+				"entry __main__:7",
+				"step __main__:8 k=10",
+				"step __main__:9 add=lambda k=10",
+				"step __main__:10 add=lambda k=10",
+				"step __main__:11 add=lambda k=10",
+			},
+		},
+		{
+			name:    "step out",
+			entry:   true,
+			actions: []debugAction{debugStepIn, debugStepIn, debugStepIn, debugStepIn, debugStepOut, debugContinue},
+			exp: []string{
+				"entry __main__:7",
+				"step __main__:8 k=10",
+				"step __main__:9 add=lambda k=10",
+				"step fact:2 n=2",
+				"step fact:3 n=2",
+				"step __main__:10 add=lambda k=10",
+			},
+		},
+		{
+			name:    "tail calls",
+			funcs:   []string{"sum"},
+			actions: []debugAction{debugStepOver, debugStepOver, debugAbort},
+			exp: []string{
+				"function breakpoint sum:5 acc=0 n=2",
+				"step sum:6 acc=0 n=2",
+				"function breakpoint sum:5 acc=2 n=1",
+			},
+		},
+		{
+			name:    "breakpoint in lambda",
+			lines:   []int{8},
+			actions: []debugAction{debugStepOut, debugContinue},
+			exp: []string{
+				"breakpoint __main__:8 k=10",
+				"breakpoint lambda prog.lisp:8:8 _1=5 k=10(captured)",
+			},
+		},
+		{
+			name:    "abort",
+			lines:   []int{3},
+			actions: []debugAction{debugAbort},
+			exp:     []string{"breakpoint fact:3 n=2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := NewInterpreter(ioutil.Discard)
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := in.Parse(file, f); err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			var act []string
+			var d *debugger
+			d = in.EnableDebugger(test.entry, func(reason string) debugAction {
+				fr := d.Frames()[0]
+				s := fmt.Sprintf("%v %v:%d", reason, fr.Name, fr.Line)
+				for _, v := range d.Locals(0) {
+					s += fmt.Sprintf(" %v=%v", v.Name, v.Value)
+				}
+				for _, v := range d.Captured(0) {
+					s += fmt.Sprintf(" %v=%v(captured)", v.Name, v.Value)
+				}
+				act = append(act, s)
+				if len(act) > len(test.actions) {
+					return debugAbort
+				}
+				return test.actions[len(act)-1]
+			})
+			d.SetBreakpoints(file, test.lines)
+			d.SetFuncBreakpoints(test.funcs)
+			err = in.RunArgs(nil)
+			if aborted := test.actions[len(test.actions)-1] == debugAbort; aborted != (err != nil) {
+				t.Errorf("Unexpected result of the program: %v", err)
+			}
+			if !reflect.DeepEqual(act, test.exp) {
+				t.Errorf("Incorrect stops:\nexpected %q,\n  actual %q", test.exp, act)
+			}
+		})
+	}
+}
+
+func TestDebugRepr(t *testing.T) {
+	in := NewInterpreter(ioutil.Discard)
+	if err := in.Parse("prog.lisp", strings.NewReader(`(def nat (n) (list n (+ n 1)))`)); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	l := NewLazyList(in.funcs["nat"], []types.Value{{E: types.Int64(1), T: types.TypeInt}}, false)
+	if act := debugRepr(l); act != "'(...)" {
+		t.Errorf("Incorrect repr of unevaluated lazy list: %v", act)
+	}
+	var ll types.List = l
+	for i := 0; i < 2; i++ {
+		ll, _ = ll.Tail()
+	}
+	if act := debugRepr(l); act != "'(1 2 ...)" {
+		t.Errorf("Incorrect repr of lazy list: %v", act)
+	}
+	q := &types.Sexpr{List: []types.Value{{E: types.Str("a"), T: types.TypeStr}, {E: l, T: types.TypeList}}, Quoted: true}
+	if act := debugRepr(q); act != `'("a" '(1 2 ...))` {
+		t.Errorf("Incorrect repr of list: %v", act)
+	}
+}
+
+type dapClient struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+func (c *dapClient) request(command string, args interface{}) {
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// expect reads messages until the response to command or the event is received.
+func (c *dapClient) expect(kind, name string) map[string]interface{} {
+	s := &dapServer{r: c.r}
+	for {
+		m, err := s.read()
+		if err != nil {
+			c.t.Fatalf("Cannot read %v %v: %v", kind, name, err)
+		}
+		if kind == "response" && m.Type == kind && m.Command == name {
+			if !m.Success {
+				c.t.Fatalf("Request %v failed: %v", name, m.Message)
+			}
+			body, _ := m.Body.(map[string]interface{})
+			return body
+		}
+		if kind == "event" && m.Type == kind && m.Event == name {
+			body, _ := m.Body.(map[string]interface{})
+			return body
+		}
+	}
+}
+
+func TestDap(t *testing.T) {
+	file := writeDebugProgram(t)
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- newDapServer(reqR, respW).serve()
+		respW.Close()
+	}()
+	c := &dapClient{t: t, w: reqW, r: bufio.NewReader(respR)}
+
+	c.request("initialize", map[string]interface{}{"adapterID": "spil"})
+	c.expect("response", "initialize")
+	c.request("launch", map[string]interface{}{"program": file})
+	c.expect("response", "launch")
+	c.expect("event", "initialized")
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": file},
+		"breakpoints": []map[string]interface{}{{"line": 3}, {"line": 12}},
+	})
+	bps := c.expect("response", "setBreakpoints")["breakpoints"].([]interface{})
+	if v0, v1 := bps[0].(map[string]interface{})["verified"], bps[1].(map[string]interface{})["verified"]; v0 != true || v1 != false {
+		t.Errorf("Incorrect verification of breakpoints: %v", bps)
+	}
+	c.request("configurationDone", nil)
+	c.expect("response", "configurationDone")
+
+	if reason := c.expect("event", "stopped")["reason"]; reason != "breakpoint" {
+		t.Errorf("Incorrect stop reason: %v", reason)
+	}
+	c.request("stackTrace", map[string]interface{}{"threadId": 1})
+	frames := c.expect("response", "stackTrace")["stackFrames"].([]interface{})
+	top := frames[0].(map[string]interface{})
+	if len(frames) != 2 || top["name"] != "fact" || top["line"] != 3.0 {
+		t.Errorf("Incorrect stack trace: %v", frames)
+	}
+	c.request("scopes", map[string]interface{}{"frameId": top["id"]})
+	scopes := c.expect("response", "scopes")["scopes"].([]interface{})
+	c.request("variables", map[string]interface{}{"variablesReference": scopes[0].(map[string]interface{})["variablesReference"]})
+	vars := c.expect("response", "variables")["variables"].([]interface{})
+	if v := vars[0].(map[string]interface{}); len(vars) != 1 || v["name"] != "n" || v["value"] != "2" || v["type"] != "int" {
+		t.Errorf("Incorrect variables: %v", vars)
+	}
+
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": file}})
+	c.expect("response", "setBreakpoints")
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	c.expect("response", "continue")
+	var out []string
+	for {
+		s := &dapServer{r: c.r}
+		m, err := s.read()
+		if err != nil {
+			t.Fatalf("Cannot read message: %v", err)
+		}
+		if m.Type == "event" && m.Event == "output" {
+			out = append(out, m.Body.(map[string]interface{})["output"].(string))
+		}
+		if m.Type == "event" && m.Event == "exited" {
+			if code := m.Body.(map[string]interface{})["exitCode"]; code != 0.0 {
+				t.Errorf("Incorrect exit code: %v", code)
+			}
+			break
+		}
+	}
+	if act := strings.Join(out, ""); act != "2\n3\n15\n" {
+		t.Errorf("Incorrect program output: %q", act)
+	}
+	c.expect("event", "terminated")
+	c.request("disconnect", nil)
+	c.expect("response", "disconnect")
+	if err := <-done; err != nil {
+		t.Errorf("serve failed: %v", err)
+	}
+}
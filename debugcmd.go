@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// "spil debug" runs program under interactive debugger or serves Debug Adapter Protocol (see dap.go).
+
+// listFlag is a repeatable string flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func debugCommand(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	var breaks listFlag
+	flags.Var(&breaks, "b", "set breakpoint at file:line or function (repeatable)")
+	dap := flags.Bool("dap", false, "serve Debug Adapter Protocol on stdin/stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil debug [-b file:line|function]... file.lisp [args...]\n")
+		fmt.Fprintf(flags.Output(), "       spil debug -dap\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *dap {
+		if err := newDapServer(os.Stdin, os.Stdout).serve(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+	in, err := loadProgram(flags.Arg(0), os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	c := &debugCLI{in: in, r: bufio.NewScanner(os.Stdin), w: os.Stdout}
+	c.d = in.EnableDebugger(len(breaks) == 0, c.stopped)
+	for _, b := range breaks {
+		if err := c.addBreakpoint(b); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+	if err := in.RunArgs(flags.Args()[1:]); err != nil {
+		if !c.d.aborted {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+// loadProgram parses and checks program without optimizations (used by debug and vet).
+func loadProgram(fname string, w io.Writer) (*Interpret, error) {
+	in := NewInterpreter(w)
+	in.UseBigInt(bigint)
+	in.PluginDir = pluginDir
+	in.IncludeDirs = searchDirs(in.PluginDir)
+	file, err := filepath.Abs(fname)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := in.Parse(file, f); err != nil {
+		return nil, err
+	}
+	if errs, _ := in.Check(); len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, fmt.Errorf("%v", strings.Join(msgs, "\n"))
+	}
+	return in, nil
+}
+
+// parseLocation parses breakpoint location: file:line or function name.
+func parseLocation(loc string) (file string, line int, fname string, err error) {
+	if i := strings.LastIndex(loc, ":"); i > 0 {
+		if line, err := strconv.Atoi(loc[i+1:]); err == nil {
+			file, err := filepath.Abs(loc[:i])
+			return file, line, "", err
+		}
+	}
+	return "", 0, loc, nil
+}
+
+type debugCLI struct {
+	in *Interpret
+	d  *debugger
+	r  *bufio.Scanner
+	w  io.Writer
+	// selected frame
+	frame int
+	last  string
+}
+
+const debugHelp = `Commands:
+  c, continue        continue execution
+  s, step            step into function call
+  n, next            step over function call
+  o, out             step out of the current function
+  b, break LOC       set breakpoint at file:line, line of the current file or function
+  d, delete LOC      delete breakpoint
+  bt, backtrace      print call stack
+  f, frame N         select frame N
+  v, vars            print variables of the selected frame
+  p, print NAME      print variable
+  l, list            print source around the current line
+  q, quit            terminate the program
+`
+
+func (c *debugCLI) stopped(reason string) debugAction {
+	c.frame = 0
+	fr := c.d.Frames()[0]
+	fmt.Fprintf(c.w, "Stopped (%v) in %v at %v:%d\n", reason, fr.Name, displayName(fr.File), fr.Line)
+	c.printSource(fr.File, fr.Line, 0)
+	for {
+		fmt.Fprintf(c.w, "(spil) ")
+		if !c.r.Scan() {
+			fmt.Fprintf(c.w, "\n")
+			return debugAbort
+		}
+		cmd := strings.TrimSpace(c.r.Text())
+		if cmd == "" {
+			// repeat the last command
+			cmd = c.last
+		}
+		c.last = cmd
+		fields := strings.Fields(cmd)
+		if len(fields) == 0 {
+			continue
+		}
+		arg := strings.Join(fields[1:], " ")
+		switch fields[0] {
+		case "c", "continue":
+			return debugContinue
+		case "s", "step":
+			return debugStepIn
+		case "n", "next":
+			return debugStepOver
+		case "o", "out":
+			return debugStepOut
+		case "q", "quit":
+			return debugAbort
+		case "b", "break":
+			if err := c.addBreakpoint(c.currentFileLocation(arg)); err != nil {
+				fmt.Fprintf(c.w, "%v\n", err)
+			}
+		case "d", "delete":
+			c.deleteBreakpoint(c.currentFileLocation(arg))
+		case "bt", "backtrace":
+			for i, fr := range c.d.Frames() {
+				mark := " "
+				if i == c.frame {
+					mark = "*"
+				}
+				fmt.Fprintf(c.w, "%v %d %v at %v:%d\n", mark, i, fr.Name, displayName(fr.File), fr.Line)
+			}
+		case "f", "frame":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 || n >= len(c.d.Frames()) {
+				fmt.Fprintf(c.w, "Incorrect frame: %q\n", arg)
+				continue
+			}
+			c.frame = n
+			fr := c.d.Frames()[n]
+			fmt.Fprintf(c.w, "%d %v at %v:%d\n", n, fr.Name, displayName(fr.File), fr.Line)
+		case "v", "vars":
+			for _, v := range c.d.Locals(c.frame) {
+				fmt.Fprintf(c.w, "%v = %v %v\n", v.Name, v.Value, v.Type)
+			}
+			for _, v := range c.d.Captured(c.frame) {
+				fmt.Fprintf(c.w, "%v = %v %v (captured)\n", v.Name, v.Value, v.Type)
+			}
+		case "p", "print":
+			if v, ok := c.findVar(arg); ok {
+				fmt.Fprintf(c.w, "%v = %v %v\n", v.Name, v.Value, v.Type)
+			} else {
+				fmt.Fprintf(c.w, "Unknown variable: %q\n", arg)
+			}
+		case "l", "list":
+			fr := c.d.Frames()[c.frame]
+			c.printSource(fr.File, fr.Line, 5)
+		case "h", "help":
+			fmt.Fprint(c.w, debugHelp)
+		default:
+			fmt.Fprintf(c.w, "Unknown command: %q (try \"help\")\n", fields[0])
+		}
+	}
+}
+
+// currentFileLocation turns line number into location in the file of the selected frame.
+func (c *debugCLI) currentFileLocation(loc string) string {
+	if _, err := strconv.Atoi(loc); err == nil {
+		return c.d.Frames()[c.frame].File + ":" + loc
+	}
+	return loc
+}
+
+func (c *debugCLI) addBreakpoint(loc string) error {
+	file, line, fname, err := parseLocation(loc)
+	if err != nil {
+		return err
+	}
+	if fname != "" {
+		if _, ok := c.in.funcs[fname].(*FuncInterpret); !ok {
+			return fmt.Errorf("Cannot set breakpoint: unknown function %q", fname)
+		}
+		c.d.funcs[fname] = true
+		return nil
+	}
+	if !c.in.breakableLines(file)[line] {
+		return fmt.Errorf("Cannot set breakpoint: no code at %v:%d", displayName(file), line)
+	}
+	if c.d.lines[file] == nil {
+		c.d.lines[file] = make(map[int]bool)
+	}
+	c.d.lines[file][line] = true
+	return nil
+}
+
+func (c *debugCLI) deleteBreakpoint(loc string) {
+	file, line, fname, err := parseLocation(loc)
+	if err != nil {
+		return
+	}
+	if fname != "" {
+		delete(c.d.funcs, fname)
+	} else {
+		delete(c.d.lines[file], line)
+	}
+}
+
+func (c *debugCLI) findVar(name string) (debugVar, bool) {
+	for _, vars := range [][]debugVar{c.d.Locals(c.frame), c.d.Captured(c.frame)} {
+		for _, v := range vars {
+			if v.Name == name {
+				return v, true
+			}
+		}
+	}
+	return debugVar{}, false
+}
+
+// printSource prints line of the file with context lines around.
+func (c *debugCLI) printSource(file string, line, context int) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(string(data), "\n")
+	for n := line - context; n <= line+context; n++ {
+		if n < 1 || n > len(lines) {
+			continue
+		}
+		mark := " "
+		if n == line {
+			mark = ">"
+		}
+		fmt.Fprintf(c.w, "%v %4d  %v\n", mark, n, lines[n-1])
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Codes of diagnostics reported with "-format=json".
+// Codes are stable: new categories of errors get new codes, existing codes are never reused.
+const (
+	// no implementation of function matches the arguments
+	codeNoMatchingImpl = "E001"
+	// value cannot be cast into the expected type
+	codeCannotCast = "E002"
+	// argument or return type is missing in strict mode
+	codeStrictTypes = "E003"
+	// called function is not defined
+	codeUnknownFunction = "E004"
+)
+
+// Severities of diagnostics.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// Output formats of diagnostics.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// diagFormat is the output format of errors and warnings (see "-format" flag).
+var diagFormat = formatText
+
+// codeError is an error of the category identified by the code.
+type codeError struct {
+	Code string
+	Err  error
+}
+
+func (e *codeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *codeError) Unwrap() error {
+	return e.Err
+}
+
+// withCode assigns diagnostic code to the error.
+func withCode(code string, err error) error {
+	return &codeError{Code: code, Err: err}
+}
+
+// funcError is an error in the body of the function.
+type funcError struct {
+	Func string
+	Err  error
+}
+
+func (e *funcError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *funcError) Unwrap() error {
+	return e.Err
+}
+
+// inFunc attaches name of the function to the error unless it already has one.
+// Top-level expressions are not reported as a function.
+func inFunc(name string, err error) error {
+	var fe *funcError
+	if err == nil || name == "__main__" || errors.As(err, &fe) {
+		return err
+	}
+	return &funcError{Func: name, Err: err}
+}
+
+// callError attaches position of the call expression to the error raised by the call.
+// Expressions inlined by the optimizer keep the name of the function they come from.
+// Calls in library code are skipped, so errors point to the call from the program.
+func (in *Interpret) callError(se *types.Sexpr, err error) error {
+	if err == nil || se == nil || in.libraryFiles[se.File] {
+		return err
+	}
+	if name, ok := in.inlined[se]; ok {
+		err = inFunc(name, err)
+	}
+	return errorAtCol(se.File, se.Line, se.Col, err)
+}
+
+// diagnostic is a problem found in the program, position and function are empty if unknown.
+type diagnostic struct {
+	Severity string `json:"severity"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Func     string `json:"function,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message"`
+}
+
+func newDiagnostic(severity string, err error) diagnostic {
+	d := diagnostic{Severity: severity, Message: err.Error()}
+	var pe *posError
+	if errors.As(err, &pe) {
+		d.File, d.Line, d.Column = pe.File, pe.Line, pe.Col
+	}
+	var fe *funcError
+	if errors.As(err, &fe) {
+		d.Func = fe.Func
+	}
+	var ce *codeError
+	if errors.As(err, &ce) {
+		d.Code = ce.Code
+	}
+	return d
+}
+
+// report prints the error in the format selected with "-format":
+// text messages or JSON objects, one per line.
+func report(w io.Writer, severity string, err error) {
+	if diagFormat != formatJSON {
+		if severity == severityWarning {
+			fmt.Fprintf(w, "warning: %v\n", err)
+		} else {
+			fmt.Fprintf(w, "%v\n", err)
+		}
+		return
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	// diagnostic is always encodable, so only write errors are possible: ignore them like Fprintf ones.
+	_ = enc.Encode(newDiagnostic(severity, err))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		diag diagnostic
+	}{
+		{
+			name: "parse error",
+			code: "(print 1)\n  '(1 2)",
+			diag: diagnostic{Severity: severityError, File: "main.lisp", Line: 2, Column: 3},
+		},
+		{
+			name: "no matching implementation",
+			code: "(def f (x :int) :int (+ x 1))\n(print\n   (f \"a\"))",
+			diag: diagnostic{Severity: severityError, File: "main.lisp", Line: 3, Column: 4, Code: codeNoMatchingImpl},
+		},
+		{
+			name: "cannot cast",
+			code: "(def f (x :int) :str\n  (+ x 1))",
+			diag: diagnostic{Severity: severityError, File: "main.lisp", Line: 1, Column: 1, Func: "f", Code: codeCannotCast},
+		},
+		{
+			name: "strict types",
+			code: "(use strict)\n\n(def f (x) :int x)",
+			diag: diagnostic{Severity: severityError, File: "main.lisp", Line: 3, Column: 1, Func: "f", Code: codeStrictTypes},
+		},
+		{
+			name: "runtime error",
+			code: "(def f (x) (g x))\n(print (f 1))",
+			diag: diagnostic{Severity: severityError, File: "main.lisp", Line: 1, Column: 12, Func: "f", Code: codeUnknownFunction},
+		},
+		{
+			name: "test",
+			code: "(def f (x :int) :int x)\n(deftest t (f \"a\"))",
+			diag: diagnostic{Severity: severityError, File: "main.lisp", Line: 2, Column: 12, Func: "deftest t", Code: codeNoMatchingImpl},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := NewInterpreter(ioutil.Discard)
+			in.Stderr = ioutil.Discard
+			var err error
+			if err = in.Parse("main.lisp", strings.NewReader(test.code)); err == nil {
+				if errs, _ := in.Check(); len(errs) > 0 {
+					err = errs[0]
+				} else {
+					err = in.RunArgs(nil)
+				}
+			}
+			if err == nil {
+				t.Fatal("Expected error, found nil")
+			}
+			diag := newDiagnostic(severityError, err)
+			test.diag.Message = err.Error()
+			if diag != test.diag {
+				t.Errorf("Incorrect diagnostic:\nexpected %+v\nactual   %+v", test.diag, diag)
+			}
+		})
+	}
+}
+
+func TestRuntimeDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		diag diagnostic
+	}{
+		{
+			name: "inlined function",
+			code: "(def g (x) (+ x 1))\n(def f (x) (g x))\n(def h (x) (f x))\n(print (h \"a\"))",
+			diag: diagnostic{Severity: severityError, File: "main.lisp", Line: 1, Column: 12, Func: "g", Code: codeNoMatchingImpl},
+		},
+		{
+			name: "library function",
+			code: "(def f (x)\n  (head x))\n(print (f (list)))",
+			diag: diagnostic{Severity: severityError, File: "main.lisp", Line: 2, Column: 3, Func: "f"},
+		},
+	}
+	for _, test := range tests {
+		for _, mode := range []struct {
+			name    string
+			opt, vm bool
+		}{{"default", true, true}, {"no-vm", true, false}, {"no-opt", false, true}, {"no-opt-no-vm", false, false}} {
+			t.Run(test.name+"/"+mode.name, func(t *testing.T) {
+				testRuntimeDiagnostic(t, test.code, test.diag, mode.opt, mode.vm)
+			})
+		}
+	}
+}
+
+func testRuntimeDiagnostic(t *testing.T, code string, exp diagnostic, opt, vm bool) {
+	in := NewInterpreter(ioutil.Discard)
+	in.Stderr = ioutil.Discard
+	if err := in.Parse("main.lisp", strings.NewReader(code)); err != nil {
+		t.Fatal(err)
+	}
+	if errs, _ := in.Check(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if opt {
+		in.Optimize()
+	}
+	if vm {
+		in.Compile()
+	}
+	err := in.RunArgs(nil)
+	if err == nil {
+		t.Fatal("Expected error, found nil")
+	}
+	diag := newDiagnostic(severityError, err)
+	exp.Message = err.Error()
+	if diag != exp {
+		t.Errorf("Incorrect diagnostic:\nexpected %+v\nactual   %+v", exp, diag)
+	}
+}
+
+func TestDiagnosticsWarning(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	in := NewInterpreter(ioutil.Discard)
+	in.Stderr = stderr
+	if err := in.Parse("main.lisp", strings.NewReader("(def f (x)\n  (undefined x))")); err != nil {
+		t.Fatal(err)
+	}
+	errs, warnings := in.Check()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("Unexpected output: %q", stderr.String())
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("Expected one warning, found %v", warnings)
+	}
+	diag := newDiagnostic(severityWarning, warnings[0])
+	exp := diagnostic{
+		Severity: severityWarning,
+		File:     "main.lisp",
+		Line:     2,
+		Column:   3,
+		Func:     "f",
+		Code:     codeUnknownFunction,
+		Message:  "f: cannot detect return type of function undefined",
+	}
+	if diag != exp {
+		t.Errorf("Incorrect diagnostic:\nexpected %+v\nactual   %+v", exp, diag)
+	}
+}
+
+func TestReport(t *testing.T) {
+	defer func(f string) { diagFormat = f }(diagFormat)
+	coded := inFunc("f", withCode(codeCannotCast, errorAtCol("a.lisp", 3, 5, fmt.Errorf("f: <bad>"))))
+	plain := fmt.Errorf("plain")
+	tests := []struct {
+		format   string
+		severity string
+		err      error
+		out      string
+	}{
+		{formatText, severityError, coded, "f: <bad>\n"},
+		{formatText, severityWarning, coded, "warning: f: <bad>\n"},
+		{formatJSON, severityError, coded, `{"severity":"error","file":"a.lisp","line":3,"column":5,"function":"f","code":"E002","message":"f: <bad>"}` + "\n"},
+		{formatJSON, severityWarning, plain, `{"severity":"warning","message":"plain"}` + "\n"},
+	}
+	for _, test := range tests {
+		diagFormat = test.format
+		out := &bytes.Buffer{}
+		report(out, test.severity, test.err)
+		if out.String() != test.out {
+			t.Errorf("Incorrect output (%v, %v): expected %q, actual %q", test.format, test.severity, test.out, out.String())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Documentation of functions and types (see "(doc name)" and "spil doc").
+
+type docEntry struct {
+	Name string
+	// definitions without bodies
+	Signature []string
+	// distinct docstrings
+	Docs []string
+}
+
+func (e *docEntry) String() string {
+	return strings.Join(append([]string{strings.Join(e.Signature, "\n")}, e.Docs...), "\n\n")
+}
+
+func (e *docEntry) addDoc(doc string) {
+	if doc == "" {
+		return
+	}
+	for _, d := range e.Docs {
+		if d == doc {
+			return
+		}
+	}
+	e.Docs = append(e.Docs, doc)
+}
+
+// clauseSignature returns the definition of function clause without body.
+func clauseSignature(name string, impl *FuncImpl) string {
+	def := "def"
+	if impl.memo {
+		def = "def'"
+	}
+	l := fmt.Sprintf("(%v %v %v", def, name, argfmtString(impl.argfmt))
+	if impl.returnType != types.TypeUnknown {
+		l += " " + impl.returnType.String()
+	}
+	return l + ")"
+}
+
+func (in *Interpret) funcDoc(name string) (*docEntry, bool) {
+	fn, ok := in.funcs[name]
+	if !ok || strings.HasPrefix(name, "__") {
+		return nil, false
+	}
+	e := &docEntry{Name: name}
+	fi, ok := fn.(*FuncInterpret)
+	if !ok {
+		if rt, ok := fn.(ReturnTyper); ok && rt.ReturnType() != types.TypeUnknown {
+			e.Signature = []string{fmt.Sprintf("%v ; builtin %v", name, rt.ReturnType())}
+		} else {
+			e.Signature = []string{fmt.Sprintf("%v ; builtin", name)}
+		}
+		return e, true
+	}
+	if m, ok := in.modules[in.funcsOrigins[name]]; ok {
+		// clauses are written as they are defined in the module
+		name = strings.TrimPrefix(name, m.name+".")
+	}
+	for _, impl := range fi.bodies {
+		e.Signature = append(e.Signature, clauseSignature(name, impl))
+		e.addDoc(impl.doc)
+	}
+	return e, true
+}
+
+func (in *Interpret) typeDoc(t types.Type) (*docEntry, bool) {
+	parent, ok := in.types[t]
+	if !ok {
+		return nil, false
+	}
+	e := &docEntry{Name: t.String()}
+	if parent == "" {
+		e.Signature = []string{t.String()}
+	} else {
+		e.Signature = []string{fmt.Sprintf("(deftype %v %v)", t, parent)}
+	}
+	e.addDoc(in.typeDocs[t])
+	return e, true
+}
+
+// (doc name) returns description of function or type.
+func (in *Interpret) FDoc(args []types.Value) (*types.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("doc: expected exactly one argument, found %v", args)
+	}
+	name, ok := args[0].E.(types.Ident)
+	if !ok {
+		return nil, fmt.Errorf("doc: expected function or type, found %v", args[0])
+	}
+	if t, ok := types.ParseType(string(name)); ok {
+		if e, ok := in.typeDoc(in.UnaliasType(t)); ok {
+			return &types.Value{E: types.Str(e.String()), T: types.TypeStr}, nil
+		}
+		return nil, fmt.Errorf("doc: unknown type: %v", name)
+	}
+	e, ok := in.funcDoc(string(name))
+	if !ok {
+		return nil, fmt.Errorf("doc: unknown function: %v", name)
+	}
+	return &types.Value{E: types.Str(e.String()), T: types.TypeStr}, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDocstrings(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		exp  string
+	}{
+		{
+			name: "after arguments",
+			code: `(def f (x) "Doc of f." (+ x 1))`,
+			exp:  "(def f (x))\n\nDoc of f.",
+		},
+		{
+			name: "after return type",
+			code: `(def f (x:int) :int "Doc of f." (+ x 1))`,
+			exp:  "(def f (x:int) :int)\n\nDoc of f.",
+		},
+		{
+			name: "string result",
+			code: `(def f () "result")`,
+			exp:  "(def f ())",
+		},
+		{
+			name: "string result with type",
+			code: `(def f () :str "result" :str)`,
+			exp:  "(def f () :str)",
+		},
+		{
+			name: "several clauses",
+			code: `(def f (0) "Doc of f." 1)
+(def f (x:int) :int (* x 2))
+(def f (x:str) :str "Doc of f." x)
+(def f (x:float) :float "Doc of float f." x)`,
+			exp: "(def f (0))\n(def f (x:int) :int)\n(def f (x:str) :str)\n(def f (x:float) :float)\n\nDoc of f.\n\nDoc of float f.",
+		},
+		{
+			name: "type",
+			code: `(deftype :age :int "Age in years.")`,
+			exp:  "(deftype :age :int)\n\nAge in years.",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := NewInterpreter(ioutil.Discard)
+			if err := in.Parse("test.lisp", strings.NewReader(test.code)); err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			e, ok := in.funcDoc("f")
+			if !ok {
+				e, ok = in.typeDoc("age")
+			}
+			if !ok {
+				t.Fatalf("Definition not found")
+			}
+			if act := e.String(); act != test.exp {
+				t.Errorf("Incorrect doc:\nexpected %q,\n  actual %q", test.exp, act)
+			}
+		})
+	}
+}
+
+func TestDocMarkdown(t *testing.T) {
+	code := `(use std)
+(deftype :age :int "Age in years.")
+(def inc-age (a:age) :age "Next year." (do (inc a) :age))
+(def helper (x) x)`
+	in := NewInterpreter(ioutil.Discard)
+	if err := in.Parse("test.lisp", strings.NewReader(code)); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	page := in.docPage("Module test.lisp", func(file string) bool {
+		return file == "test.lisp"
+	})
+	exp := "# Module test.lisp\n" +
+		"\n## Types\n\n### `:age`\n\n```spil\n(deftype :age :int)\n```\n\nAge in years.\n" +
+		"\n## Functions\n\n### `helper`\n\n```spil\n(def helper (x))\n```\n" +
+		"\n### `inc-age`\n\n```spil\n(def inc-age (a:age) :age)\n```\n\nNext year.\n"
+	b := &strings.Builder{}
+	if err := writeDocMarkdown(b, page); err != nil {
+		t.Fatal(err)
+	}
+	if act := b.String(); act != exp {
+		t.Errorf("Incorrect markdown:\nexpected %q,\n  actual %q", exp, act)
+	}
+}
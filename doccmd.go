@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// "spil doc" generates documentation pages for a module or embedded library.
+
+func docCommand(args []string) int {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	html := flags.Bool("html", false, "generate HTML instead of Markdown")
+	out := flags.String("o", "", "write documentation to file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil doc [-html] [-o file] module.lisp|builtin|std|cli\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	page, err := loadDocPage(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if *html {
+		err = docTemplate.Execute(w, page)
+	} else {
+		err = writeDocMarkdown(w, page)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type docPage struct {
+	Title string
+	Types []*docEntry
+	Funcs []*docEntry
+}
+
+// loadDocPage collects functions and types defined in the module or in the embedded library.
+func loadDocPage(name string) (*docPage, error) {
+	switch name {
+	case "builtin", "std", "cli":
+		in := NewInterpreter(ioutil.Discard)
+		if err := in.Parse("", strings.NewReader("(use std) (use cli)")); err != nil {
+			return nil, err
+		}
+		prefix := "library/" + name + "/"
+		return in.docPage("Library "+name, func(file string) bool {
+			return strings.HasPrefix(file, prefix) || (name == "builtin" && file == "")
+		}), nil
+	}
+	in, err := loadProgram(name, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	file, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	return in.docPage("Module "+filepath.Base(name), func(f string) bool {
+		return f == file
+	}), nil
+}
+
+// docPage describes functions and types which origin satisfies the filter.
+// Native functions and basic types have empty origin.
+func (in *Interpret) docPage(title string, filter func(file string) bool) *docPage {
+	page := &docPage{Title: title}
+	var names []string
+	for name, fn := range in.funcs {
+		file := in.funcsOrigins[name]
+		if _, ok := fn.(*FuncInterpret); !ok && strings.Contains(name, ".") {
+			// internal implementation of library function
+			continue
+		}
+		if filter(file) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if e, ok := in.funcDoc(name); ok {
+			page.Funcs = append(page.Funcs, e)
+		}
+	}
+	var tps []string
+	for t := range in.types {
+		if t != types.TypeUnknown && filter(in.typeOrigins[t]) {
+			tps = append(tps, string(t))
+		}
+	}
+	sort.Strings(tps)
+	for _, t := range tps {
+		if e, ok := in.typeDoc(types.Type(t)); ok {
+			page.Types = append(page.Types, e)
+		}
+	}
+	return page
+}
+
+func writeDocMarkdown(w io.Writer, page *docPage) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# %v\n", page.Title)
+	sections := []struct {
+		name    string
+		entries []*docEntry
+	}{
+		{"Types", page.Types},
+		{"Functions", page.Funcs},
+	}
+	for _, s := range sections {
+		if len(s.entries) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "\n## %v\n", s.name)
+		for _, e := range s.entries {
+			fmt.Fprintf(b, "\n### `%v`\n\n%v\n", e.Name, markdownEntry(e))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var docTemplate = template.Must(template.New("doc").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; background: #f4f4f4; padding: 0.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Types}}<h2>Types</h2>
+{{range .Types}}<h3 id="type-{{.Name}}"><code>{{.Name}}</code></h3>
+<pre>{{range .Signature}}{{.}}
+{{end}}</pre>
+{{range .Docs}}<p>{{.}}</p>
+{{end}}{{end}}{{end}}{{if .Funcs}}<h2>Functions</h2>
+{{range .Funcs}}<h3 id="func-{{.Name}}"><code>{{.Name}}</code></h3>
+<pre>{{range .Signature}}{{.}}
+{{end}}</pre>
+{{range .Docs}}<p>{{.}}</p>
+{{end}}{{end}}{{end}}</body>
+</html>
+`))
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// In per-line mode (spil -n and -p) the main module is evaluated for every line of stdin
+// with variables "line" (line without new line character) and "nr" (number of line starting from 1).
+
+// EachLine enables per-line mode, if print is true the result of the main module is printed for every line.
+func (in *Interpret) EachLine(print bool) {
+	in.eachLine = true
+	in.printLines = print
+}
+
+func (in *Interpret) runLines(stdin types.List, params []types.Value) error {
+	for nr := int64(1); !stdin.Empty(); nr++ {
+		line, rest, err := readLine(stdin)
+		if err != nil {
+			return err
+		}
+		in.main.capturedVars["line"] = &types.Value{E: types.Str(line), T: types.TypeStr}
+		in.main.capturedVars["nr"] = &types.Value{E: in.intMaker.MakeInt(nr), T: types.TypeInt}
+		res, err := in.main.Eval(params)
+		if err != nil {
+			return err
+		}
+		if in.printLines {
+			if err := printValues(in.output, []types.Value{*res}); err != nil {
+				return err
+			}
+		}
+		stdin = rest
+	}
+	return nil
+}
+
+// readLine reads characters of the list until new line and returns the rest of the list.
+func readLine(l types.List) (string, types.List, error) {
+	b := &strings.Builder{}
+	for !l.Empty() {
+		h, err := l.Head()
+		if err != nil {
+			return "", nil, err
+		}
+		if l, err = l.Tail(); err != nil {
+			return "", nil, err
+		}
+		c := string(h.E.(types.Str))
+		if c == "\n" {
+			break
+		}
+		b.WriteString(c)
+	}
+	return strings.TrimSuffix(b.String(), "\r"), l, nil
+}
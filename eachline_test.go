@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEachLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		print bool
+		input string
+		exp   string
+	}{
+		{name: "-n", code: `(print nr line)`, input: "foo\nbar baz\n", exp: "1 foo\n2 bar baz\n"},
+		{name: "-p", code: `(use std) (set n (length line)) (list n line)`, print: true, input: "ab\n\r\nlast", exp: "'(2 ab)\n'(0 )\n'(4 last)\n"},
+		{name: "empty input", code: `(print line)`, input: "", exp: ""},
+	}
+	for _, test := range tests {
+		for _, vm := range []bool{true, false} {
+			t.Run(test.name, func(t *testing.T) {
+				stdout := &bytes.Buffer{}
+				in := NewInterpreter(stdout)
+				in.EachLine(test.print)
+				if err := in.Parse("main.lisp", strings.NewReader(test.code)); err != nil {
+					t.Fatal(err)
+				}
+				if errs, _ := in.Check(); len(errs) > 0 {
+					t.Fatal(errs)
+				}
+				if vm {
+					in.Compile()
+				}
+				stdin := NewLazyInput(ioutil.NopCloser(strings.NewReader(test.input)))
+				if err := in.runLines(stdin, nil); err != nil {
+					t.Fatal(err)
+				}
+				if act := stdout.String(); act != test.exp {
+					t.Errorf("Incorrect output: expected %q, actual %q", test.exp, act)
+				}
+			})
+		}
+	}
+}
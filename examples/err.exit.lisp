@@ -0,0 +1,2 @@
+dividing...
+error: division by zero: 1 / 0
@@ -0,0 +1,17 @@
+; command line parsing
+
+(use cli)
+
+(const spec '((about "Prints lines matching the pattern.")
+              (flag "count" :int 10 "maximal number of lines")
+              (flag "verbose" :bool false "print file names")
+              (arg "pattern" :str "pattern to search")
+              (rest "files" :str "input files")))
+
+; program arguments are parsed if they are not specified
+(set opts (cli.parse spec '("--count" "3" "-verbose" "error" "a.log" "--" "--b.log")))
+
+(print (cli.int opts "count") (cli.bool opts "verbose") (cli.str opts "pattern"))
+(print (cli.rest opts "files"))
+
+; vim: ft=lisp
@@ -0,0 +1,27 @@
+; global constants
+
+(use std)
+
+; constants are evaluated once in the order of their dependencies
+(const limit (* base 10))
+(const base 4)
+(const squares (map (lambda (* _1 _1)) '(1 2 3)))
+
+(def greet (s) (append prefix s))
+(const prefix "hello, ")
+(const greeting (greet "world"))
+
+; constants can be used as patterns
+(def classify (0) "zero")
+(def classify (=limit) "limit")
+(def classify (n:int) (if (< n limit) "small" "big"))
+
+; parameters and variables shadow constants
+(def scale (base:int) (* base 2))
+(def offset (n) (do (set limit 1) (+ n limit)))
+
+(print limit squares greeting)
+(print (classify 0) (classify 40) (classify 3) (classify 100))
+(print (scale 5) (offset 5))
+
+; vim: ft=lisp
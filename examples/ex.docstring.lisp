@@ -0,0 +1,18 @@
+; docstrings of functions and types
+
+(deftype :age :int "Age in years.")
+
+(def fact (0) :int "Factorial of n." 1)
+(def fact (n:int) :int
+	"Factorial of n."
+	(* n (fact (- n 1))))
+
+; string which is not followed by body is the result of function
+(def greeting () "hello")
+
+(print (fact 5) (greeting))
+(print (doc fact))
+(print (doc :age))
+(print (doc tail))
+
+; vim: ft=lisp
@@ -0,0 +1,11 @@
+; (error ...) raises an error, uncaught error stops the program with exit code 2
+(def safe-div (a:int b:int) :int
+  (if (= b 0)
+    (error "division by zero:" a "/" b)
+    (/ a b)))
+
+(eprint "dividing...")
+(print (safe-div 10 2))
+(print (assert-error \(safe-div 1 0) "division by zero"))
+(print (safe-div 1 0))
+(print "unreachable")
@@ -0,0 +1,10 @@
+(use std)
+(use quickcheck :seed 1)
+
+(deftype :stack :list[int])
+
+(def push (s:stack x:int) :stack (do (append '() x s) :stack))
+
+(print "commutative:" (forall (x:int y:int) (= (+ x y) (+ y x))))
+(print "concat-length:" (forall (l:list[int]) (= (length (concat l l)) (* 2 (length l)))))
+(print "push:" (forall 20 (s:stack x:int) (= (head (push s x)) x)))
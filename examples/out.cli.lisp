@@ -0,0 +1,2 @@
+3 true error
+'(a.log --b.log)
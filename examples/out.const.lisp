@@ -0,0 +1,3 @@
+40 '(1 4 9) hello, world
+zero limit small big
+10 6
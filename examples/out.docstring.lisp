@@ -0,0 +1,11 @@
+120 hello
+(def fact (0) :int)
+(def fact (n:int) :int)
+
+Factorial of n.
+(deftype :age :int)
+
+Age in years.
+(def tail (l:list[a]) :list[a])
+
+Returns the list without its first element.
@@ -0,0 +1,2 @@
+5
+true
@@ -0,0 +1,3 @@
+commutative: true
+concat-length: true
+push: true
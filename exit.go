@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Exit codes of the program.
+const (
+	// parsing, type checking and runtime errors
+	exitFailure = 1
+	// uncaught error raised with (error ...)
+	exitRaised = 2
+)
+
+// exitError stops the program with the exit code.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// raisedError is raised by the program with (error ...).
+type raisedError struct {
+	msg string
+}
+
+func (e *raisedError) Error() string {
+	return "error: " + e.msg
+}
+
+// exitStatus reports error returned by RunArgs and returns exit code of the program.
+func (in *Interpret) exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exit *exitError
+	if errors.As(err, &exit) {
+		return exit.code
+	}
+	report(in.Stderr, severityError, err)
+	var raised *raisedError
+	if errors.As(err, &raised) {
+		return exitRaised
+	}
+	return exitFailure
+}
+
+// (exit [code])
+func (in *Interpret) FExit(args []types.Value) (*types.Value, error) {
+	code := 0
+	if len(args) == 1 {
+		c, ok := args[0].E.(types.Int)
+		if !ok {
+			return nil, fmt.Errorf("exit: expected exit code, found %v", literal(args[0].E))
+		}
+		code = int(c.Int64())
+	} else if len(args) > 1 {
+		return nil, fmt.Errorf("exit: expected exit code, found %v", args)
+	}
+	in.exit = &exitError{code: code}
+	return nil, in.exit
+}
+
+// (eprint args...) prints arguments into standard error.
+func (in *Interpret) FEprint(args []types.Value) (*types.Value, error) {
+	if err := printValues(in.Stderr, args); err != nil {
+		return nil, err
+	}
+	return &types.Value{E: types.QEmpty, T: types.TypeList}, nil
+}
+
+// (error args...) raises an error with message made of arguments.
+func FError(args []types.Value) (*types.Value, error) {
+	b := &strings.Builder{}
+	if err := printValues(b, args); err != nil {
+		return nil, err
+	}
+	return nil, &raisedError{msg: strings.TrimSuffix(b.String(), "\n")}
+}
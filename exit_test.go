@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		status int
+		stdout string
+		stderr string
+	}{
+		{name: "success", code: `(print "ok")`, status: 0, stdout: "ok\n"},
+		{name: "exit", code: `(print 1) (exit 3) (print 2)`, status: 3, stdout: "1\n"},
+		{name: "exit without code", code: `(exit) (print 2)`, status: 0},
+		{name: "exit from function", code: `(def f (x) (if (> x 0) (exit x) x)) (print (f 0)) (print (f 4))`, status: 4, stdout: "0\n"},
+		{name: "eprint", code: `(eprint "warning:" 1 '(2 3)) (print "done")`, status: 0, stdout: "done\n", stderr: "warning: 1 '(2 3)\n"},
+		{name: "error", code: `(def f (x) (error "bad" x)) (def g (x) (f x)) (print (g 5))`, status: exitRaised, stderr: "error: bad 5\n"},
+		{name: "caught error", code: `(print (assert-error \(error "bad") "bad"))`, status: 0, stdout: "true\n"},
+		{name: "runtime error", code: `(print (head '()))`, status: exitFailure},
+		{name: "exit in lazy list", code: `(use std) (print (map (lambda (if (= _1 2) (exit 4) _1)) (list 1 2 3)))`, status: 4},
+		{name: "error in lazy list", code: `(use std) (print (map (lambda (if (= _1 2) (error "bad" _1) _1)) (list 1 2 3)))`, status: exitRaised, stderr: "error: bad 2\n"},
+		{name: "exit in forced lazy list", code: `(use std) (set l (map (lambda (exit 5)) (list 1))) (print (empty l))`, status: 5},
+		{name: "exit in assert-error", code: `(def q () (exit 3)) (print (assert-error q)) (print "after")`, status: 3},
+		{name: "incorrect exit code", code: `(exit "1")`, status: exitFailure, stderr: "exit: expected exit code, found \"1\"\n"},
+	}
+	for _, test := range tests {
+		for _, vm := range []bool{true, false} {
+			t.Run(test.name, func(t *testing.T) {
+				stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+				in := NewInterpreter(stdout)
+				in.Stderr = stderr
+				if err := in.Parse("main.lisp", strings.NewReader(test.code)); err != nil {
+					t.Fatal(err)
+				}
+				if err, _ := in.Check(); err != nil {
+					t.Fatal(err)
+				}
+				if vm {
+					in.Compile()
+				}
+				if status := in.exitStatus(in.RunArgs(nil)); status != test.status {
+					t.Errorf("Incorrect exit status: expected %v, actual %v (%v)", test.status, status, stderr.String())
+				}
+				if act := stdout.String(); act != test.stdout {
+					t.Errorf("Incorrect output: expected %q, actual %q", test.stdout, act)
+				}
+				if test.stderr != "" && !strings.HasSuffix(stderr.String(), test.stderr) {
+					t.Errorf("Incorrect stderr: expected %q, actual %q", test.stderr, stderr.String())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		exp  string
+	}{
+		{
+			name: "short forms",
+			in:   "(print   1\n  2)\n(set x\n\t'( 1 2 ))\n",
+			exp:  "(print 1 2)\n(set x '(1 2))\n",
+		},
+		{
+			name: "booleans",
+			in:   "(print true false 'T 'F)",
+			exp:  "(print 'T 'F 'T 'F)\n",
+		},
+		{
+			name: "comments and blank lines",
+			in:   "  ; header\n\n\n\n(def f (x)\n;; body\n\n  (+ x 1)\n\n)\n# end\n\n",
+			exp:  "; header\n\n(def f (x)\n\t;; body\n\n\t(+ x 1))\n# end\n",
+		},
+		{
+			name: "comment at the end of list",
+			in:   "(print 1\n; done\n)\n",
+			exp:  "(print 1\n\t; done\n)\n",
+		},
+		{
+			name: "several body expressions",
+			in:   "(def f (x) :int (set y (* x 2)) :int (+ y 1))\n",
+			exp:  "(def f (x) :int\n\t(set y (* x 2)) :int\n\t(+ y 1))\n",
+		},
+		{
+			name: "docstring",
+			in:   "(def f (x) :int \"Doc of f.\" (+ x 1))\n(def g (x) \"Doc of g.\" (set y x) y)\n",
+			exp:  "(def f (x) :int \"Doc of f.\" (+ x 1))\n(def g (x)\n\t\"Doc of g.\"\n\t(set y x)\n\ty)\n",
+		},
+		{
+			name: "long forms",
+			in: "(def long-function-name (first-argument second-argument) :int (+ first-argument second-argument 1000000))\n" +
+				`(print "a long string literal" (list "another long string literal" "and one more" 100500))` + "\n",
+			exp: "(def long-function-name (first-argument second-argument) :int\n\t(+ first-argument second-argument 1000000))\n" +
+				"(print \"a long string literal\"\n\t(list \"another long string literal\" \"and one more\" 100500))\n",
+		},
+		{
+			name: "lambdas and do",
+			in:   `(set f \(do (print "first line of output" _1) (print "second line of output" _2) (+ _1 _2)))`,
+			exp:  "(set f\n\t\\(do\n\t\t(print \"first line of output\" _1)\n\t\t(print \"second line of output\" _2)\n\t\t(+ _1 _2)))\n",
+		},
+		{
+			name: "aligned clauses",
+			in:   "(def fact (0) 1)\n(def fact (n:int) :int\n\t(* n (fact (- n 1))))\n(def other (x) x)\n",
+			exp:  "(def fact (0)          1)\n(def fact (n:int) :int (* n (fact (- n 1))))\n(def other (x) x)\n",
+		},
+		{
+			name: "clauses separated with blank line are not aligned",
+			in:   "(def fact (0) 1)\n\n(def fact (n:int) :int (* n (fact (- n 1))))\n",
+			exp:  "(def fact (0) 1)\n\n(def fact (n:int) :int (* n (fact (- n 1))))\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			act, err := formatSource([]byte(test.in))
+			if err != nil {
+				t.Fatalf("formatSource failed: %v", err)
+			}
+			if string(act) != test.exp {
+				t.Errorf("Incorrect formatting:\nexpected %q,\n  actual %q", test.exp, act)
+			}
+			again, err := formatSource(act)
+			if err != nil || string(again) != string(act) {
+				t.Errorf("Formatting is not idempotent: %q (%v)", again, err)
+			}
+		})
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp string
+	}{
+		{"(print 1\n(print 2", "<stdin>:2: Unexpected EOF"},
+		{"(print 1))", "<stdin>:1: Unexpected ')'"},
+	}
+	for _, test := range tests {
+		_, err := formatSource([]byte(test.in))
+		if err == nil {
+			t.Errorf("formatSource(%q) succeeded", test.in)
+			continue
+		}
+		if act := sourceError("<stdin>", err).Error(); act != test.exp {
+			t.Errorf("Incorrect error: expected %q, actual %q", test.exp, act)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := strings.Replace(strings.Replace(a, "2\n", "two\n", 1), "11\n", "", 1)
+	exp := `--- f
++++ f (formatted)
+@@ -1,5 +1,5 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+@@ -8,5 +8,4 @@
+ 8
+ 9
+ 10
+-11
+ 12
+`
+	if act := unifiedDiff("f", []byte(a), []byte(b)); act != exp {
+		t.Errorf("Incorrect diff:\nexpected %q,\n  actual %q", exp, act)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// "spil fmt" rewrites source files in canonical layout (see FormatCST).
+
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	list := flags.Bool("l", false, "list files whose formatting differs from canonical")
+	diff := flags.Bool("d", false, "print diffs instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil fmt [-l] [-d] [file.lisp|dir]...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		res, err := formatSource(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", sourceError("<stdin>", err))
+			return 1
+		}
+		if *diff {
+			fmt.Print(unifiedDiff("<stdin>", data, res))
+		} else if !*list {
+			os.Stdout.Write(res)
+		}
+		return 0
+	}
+	code := 0
+	for _, arg := range flags.Args() {
+		files, err := lispFiles(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			code = 1
+			continue
+		}
+		for _, file := range files {
+			if err := fmtFile(file, *list, *diff, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				code = 1
+			}
+		}
+	}
+	return code
+}
+
+// lispFiles returns path itself if it is a file or all .lisp files in the directory tree.
+func lispFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(file, ".lisp") {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func fmtFile(file string, list, diff bool, w io.Writer) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	res, err := formatSource(data)
+	if err != nil {
+		return sourceError(file, err)
+	}
+	if bytes.Equal(data, res) {
+		return nil
+	}
+	if list {
+		fmt.Fprintf(w, "%v\n", file)
+	}
+	if diff {
+		fmt.Fprint(w, unifiedDiff(file, data, res))
+	}
+	if list || diff {
+		return nil
+	}
+	return ioutil.WriteFile(file, res, 0644)
+}
+
+// formatSource formats the source and checks that the program is not changed.
+func formatSource(data []byte) ([]byte, error) {
+	nodes, err := ParseCST(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	res := FormatCST(nodes)
+	before, err := parsedForms(data)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parsedForms(res)
+	if err != nil || before != after {
+		return nil, fmt.Errorf("formatting changes the program")
+	}
+	return res, nil
+}
+
+// sourceError prefixes error message with file name and line if it is known.
+func sourceError(file string, err error) error {
+	var pe *posError
+	if errors.As(err, &pe) {
+		return fmt.Errorf("%v:%d: %v", file, pe.Line, pe.Err)
+	}
+	return fmt.Errorf("%v: %v", file, err)
+}
+
+func parsedForms(data []byte) (string, error) {
+	p := NewParser(bytes.NewReader(data), defaultNumberParser{})
+	b := &strings.Builder{}
+	for {
+		v, err := p.NextExpr(false)
+		if err == io.EOF {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", errorAt("", p.line, err)
+		}
+		fmt.Fprintf(b, "%v\n", v)
+	}
+}
+
+// unifiedDiff returns line diff of a and b in unified format.
+func unifiedDiff(name string, a, b []byte) string {
+	x := strings.SplitAfter(string(a), "\n")
+	y := strings.SplitAfter(string(b), "\n")
+	if x[len(x)-1] == "" {
+		x = x[:len(x)-1]
+	}
+	if y[len(y)-1] == "" {
+		y = y[:len(y)-1]
+	}
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	type diffLine struct {
+		op   byte
+		text string
+		// line numbers in a and b
+		i, j int
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, diffLine{' ', x[i], i, j})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', x[i], i, j})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', y[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "--- %v\n+++ %v (formatted)\n", name, name)
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			k++
+			continue
+		}
+		// hunk starts with context lines before the change and ends
+		// when there are more than 2*context unchanged lines
+		start := k - context
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			n := end
+			for n < len(lines) && lines[n].op == ' ' {
+				n++
+			}
+			if n == len(lines) || n-end > 2*context {
+				end += context
+				if end > len(lines) {
+					end = len(lines)
+				}
+				break
+			}
+			end = n
+		}
+		na, nb := 0, 0
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				na++
+			}
+			if l.op != '-' {
+				nb++
+			}
+		}
+		fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", lines[start].i+1, na, lines[start].j+1, nb)
+		for _, l := range lines[start:end] {
+			text := l.text
+			if !strings.HasSuffix(text, "\n") {
+				text += "\n\\ No newline at end of file\n"
+			}
+			fmt.Fprintf(out, "%c%v", l.op, text)
+		}
+		k = end
+	}
+	return out.String()
+}
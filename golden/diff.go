@@ -0,0 +1,80 @@
+package golden
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Maximum number of lines compared with LCS algorithm.
+const maxDiffLines = 2000
+
+// Diff returns line-based difference between texts or empty string if they are equal.
+// Removed lines are marked with "-", added lines are marked with "+".
+func Diff(exp, act string) string {
+	if exp == act {
+		return ""
+	}
+	el, al := splitLines(exp), splitLines(act)
+	if len(el) > maxDiffLines || len(al) > maxDiffLines {
+		return firstDifference(el, al)
+	}
+	// lcs[i][j] is the length of the longest common subsequence of el[i:] and al[j:]
+	lcs := make([][]int, len(el)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(al)+1)
+	}
+	for i := len(el) - 1; i >= 0; i-- {
+		for j := len(al) - 1; j >= 0; j-- {
+			if el[i] == al[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	b := &strings.Builder{}
+	i, j := 0, 0
+	for i < len(el) || j < len(al) {
+		switch {
+		case i < len(el) && j < len(al) && el[i] == al[j]:
+			fmt.Fprintf(b, "  %v\n", el[i])
+			i++
+			j++
+		case i < len(el) && (j == len(al) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(b, "- %v\n", el[i])
+			i++
+		default:
+			fmt.Fprintf(b, "+ %v\n", al[j])
+			j++
+		}
+	}
+	return b.String()
+}
+
+// splitLines splits text into lines, missing newline at the end is shown explicitly.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += " (no newline at end)"
+	return lines
+}
+
+func firstDifference(el, al []string) string {
+	for i := 0; ; i++ {
+		switch {
+		case i >= len(el):
+			return fmt.Sprintf("line %d:\n+ %v\n", i+1, al[i])
+		case i >= len(al):
+			return fmt.Sprintf("line %d:\n- %v\n", i+1, el[i])
+		case el[i] != al[i]:
+			return fmt.Sprintf("line %d:\n- %v\n+ %v\n", i+1, el[i], al[i])
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package golden runs SPIL scripts and compares their results with expected files.
+//
+// Scripts and expectations are paired by naming convention:
+// for script "ex.NAME.lisp" standard output is expected in "out.NAME.lisp",
+// standard error in "err.NAME.lisp" and exit code in "exit.NAME.lisp".
+// Missing stderr file means that stderr is not checked, missing exit code file means exit code 0.
+//
+// Results which differ in Big mode are expected in files "out.big.NAME.lisp", "err.big.NAME.lisp" and
+// "exit.big.NAME.lisp".
+package golden
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Modes of integer arithmetic.
+const (
+	Int64 = "int64"
+	Big   = "big"
+)
+
+// Modes lists all modes scripts are checked in.
+var Modes = []string{Int64, Big}
+
+// Case is a script with files of expected results.
+type Case struct {
+	Input    string
+	Stdout   string
+	Stderr   string
+	ExitCode string
+}
+
+// Find returns scripts from directory.
+func Find(dir string) ([]Case, error) {
+	inputs, err := filepath.Glob(filepath.Join(dir, "ex.*"))
+	if err != nil {
+		return nil, err
+	}
+	cases := make([]Case, 0, len(inputs))
+	for _, input := range inputs {
+		d, file := filepath.Split(input)
+		suffix := strings.TrimPrefix(file, "ex")
+		cases = append(cases, Case{
+			Input:    input,
+			Stdout:   filepath.Join(d, "out"+suffix),
+			Stderr:   filepath.Join(d, "err"+suffix),
+			ExitCode: filepath.Join(d, "exit"+suffix),
+		})
+	}
+	return cases, nil
+}
+
+// ForMode returns case with mode-specific expectations if they exist.
+func (c Case) ForMode(mode string) Case {
+	if mode == Int64 {
+		return c
+	}
+	for _, file := range []*string{&c.Stdout, &c.Stderr, &c.ExitCode} {
+		if mf := modeFile(*file, mode); exists(mf) {
+			*file = mf
+		}
+	}
+	return c
+}
+
+// modeFile inserts mode after the prefix of file name: "out.NAME.lisp" -> "out.MODE.NAME.lisp".
+func modeFile(file, mode string) string {
+	dir, base := filepath.Split(file)
+	dot := strings.Index(base, ".")
+	return filepath.Join(dir, base[:dot]+"."+mode+base[dot:])
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// Result of script execution.
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Runner runs script in specified mode.
+type Runner func(input, mode string) (*Result, error)
+
+// Command returns Runner executing spil binary with additional arguments.
+// Flag "-big" is added in Big mode.
+func Command(spil string, args ...string) Runner {
+	return func(input, mode string) (*Result, error) {
+		cmdArgs := append([]string{}, args...)
+		if mode == Big {
+			cmdArgs = append(cmdArgs, "-big")
+		}
+		cmdArgs = append(cmdArgs, input)
+		cmd := exec.Command(spil, cmdArgs...)
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		res := &Result{}
+		if err := cmd.Run(); err != nil {
+			exitErr, ok := err.(*exec.ExitError)
+			if !ok {
+				return nil, err
+			}
+			res.ExitCode = exitErr.ExitCode()
+		}
+		res.Stdout = stdout.Bytes()
+		res.Stderr = stderr.Bytes()
+		return res, nil
+	}
+}
+
+// Check compares result with expectations.
+// It returns os.ErrNotExist error if file with expected output does not exist.
+func (c Case) Check(res *Result) (diffs []string, err error) {
+	stdout, err := ioutil.ReadFile(c.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	if d := Diff(string(stdout), string(res.Stdout)); d != "" {
+		diffs = append(diffs, fmt.Sprintf("stdout differs (-expected +actual):\n%v", d))
+	}
+	stderr, err := ioutil.ReadFile(c.Stderr)
+	if err == nil {
+		if d := Diff(string(stderr), string(res.Stderr)); d != "" {
+			diffs = append(diffs, fmt.Sprintf("stderr differs (-expected +actual):\n%v", d))
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	code, err := c.expectedCode()
+	if err != nil {
+		return nil, err
+	}
+	if code != res.ExitCode {
+		msg := fmt.Sprintf("exit code: expected %v, actual %v", code, res.ExitCode)
+		if len(res.Stderr) > 0 && len(stderr) == 0 {
+			msg += fmt.Sprintf("\nstderr:\n%s", res.Stderr)
+		}
+		diffs = append(diffs, msg)
+	}
+	return diffs, nil
+}
+
+func (c Case) expectedCode() (int, error) {
+	data, err := ioutil.ReadFile(c.ExitCode)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("%v: incorrect exit code: %v", c.ExitCode, err)
+	}
+	return code, nil
+}
+
+// Update writes result as expectations.
+// Files of stderr and exit code are written only if they are not empty and zero.
+func (c Case) Update(res *Result) error {
+	if err := ioutil.WriteFile(c.Stdout, res.Stdout, 0644); err != nil {
+		return err
+	}
+	if err := writeOrRemove(c.Stderr, res.Stderr, len(res.Stderr) > 0); err != nil {
+		return err
+	}
+	code := []byte(fmt.Sprintf("%d\n", res.ExitCode))
+	return writeOrRemove(c.ExitCode, code, res.ExitCode != 0)
+}
+
+// UpdateMode writes mode-specific expectations which differ from common ones.
+func (c Case) UpdateMode(res *Result, mode string) error {
+	stdout, err := ioutil.ReadFile(c.Stdout)
+	if err != nil {
+		return err
+	}
+	stderr, err := ioutil.ReadFile(c.Stderr)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	code, err := c.expectedCode()
+	if err != nil {
+		return err
+	}
+	if err := writeOrRemove(modeFile(c.Stdout, mode), res.Stdout, !bytes.Equal(stdout, res.Stdout)); err != nil {
+		return err
+	}
+	if err := writeOrRemove(modeFile(c.Stderr, mode), res.Stderr, !bytes.Equal(stderr, res.Stderr)); err != nil {
+		return err
+	}
+	resCode := []byte(fmt.Sprintf("%d\n", res.ExitCode))
+	return writeOrRemove(modeFile(c.ExitCode, mode), resCode, code != res.ExitCode)
+}
+
+func writeOrRemove(file string, data []byte, write bool) error {
+	if write {
+		return ioutil.WriteFile(file, data, 0644)
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Test runs scripts from directory as subtests in specified modes (all Modes by default).
+func Test(t *testing.T, dir string, run Runner, modes ...string) {
+	if len(modes) == 0 {
+		modes = Modes
+	}
+	cases, err := Find(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		for _, mode := range modes {
+			c, mode := c, mode
+			t.Run(c.Input+"-"+mode, func(t *testing.T) {
+				res, err := run(c.Input, mode)
+				if err != nil {
+					t.Fatalf("Running %v failed: %v", c.Input, err)
+				}
+				diffs, err := c.ForMode(mode).Check(res)
+				if os.IsNotExist(err) {
+					t.Skipf("No output file for %v found: %v", c.Input, c.Stdout)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, d := range diffs {
+					t.Errorf("%v: %v", c.Input, d)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package golden
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		exp, act string
+		diff     string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\nc\n", "a\nc\n", "  a\n- b\n  c\n"},
+		{"a\n", "a\nb\n", "  a\n+ b\n"},
+		{"a\nb\n", "a\nc\n", "  a\n- b\n+ c\n"},
+		{"a\n", "a", "- a\n+ a (no newline at end)\n"},
+	}
+	for _, test := range tests {
+		if diff := Diff(test.exp, test.act); diff != test.diff {
+			t.Errorf("Incorrect diff of %q and %q:\nexpected %q\n  actual %q", test.exp, test.act, test.diff, diff)
+		}
+	}
+}
+
+func TestUpdateAndCheck(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "ex.x.lisp"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]*Result{
+		Int64: {Stdout: []byte("1\n"), Stderr: []byte("error: int64\n"), ExitCode: 2},
+		Big:   {Stdout: []byte("1\n"), Stderr: []byte("error: big\n"), ExitCode: 2},
+	}
+	cases, err := Find(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 1 {
+		t.Fatalf("Expected 1 case, found: %v", cases)
+	}
+	c := cases[0]
+	if exp := filepath.Join(dir, "out.x.lisp"); c.Stdout != exp {
+		t.Errorf("Incorrect stdout file: expected %v, actual %v", exp, c.Stdout)
+	}
+	if _, err := c.Check(results[Int64]); err == nil {
+		t.Errorf("Check() without expectations should fail")
+	}
+	if err := c.Update(results[Int64]); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateMode(results[Big], Big); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range Modes {
+		diffs, err := c.ForMode(mode).Check(results[mode])
+		if err != nil || len(diffs) > 0 {
+			t.Errorf("%v: unexpected Check() result: %v, %v", mode, diffs, err)
+		}
+	}
+	if exp := filepath.Join(dir, "err.big.x.lisp"); c.ForMode(Big).Stderr != exp {
+		t.Errorf("Incorrect stderr file in big mode: expected %v, actual %v", exp, c.ForMode(Big).Stderr)
+	}
+	if exp := filepath.Join(dir, "out.x.lisp"); c.ForMode(Big).Stdout != exp {
+		t.Errorf("Incorrect stdout file in big mode: expected %v, actual %v", exp, c.ForMode(Big).Stdout)
+	}
+
+	diffs, err := c.Check(&Result{Stdout: []byte("2\n"), Stderr: []byte("error: int64\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 {
+		t.Errorf("Expected differences in stdout and exit code, found: %v", diffs)
+	}
+}
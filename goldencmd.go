@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/avoronkov/spil/golden"
+)
+
+// "spil golden" runs scripts and compares their results with expected files (see package golden).
+
+// goldenFlags returns flags scripts are run with: module resolution and output format of errors.
+func goldenFlags() (args []string) {
+	if pluginDir != "" {
+		args = append(args, "-plugin-dir", pluginDir)
+	}
+	for _, dir := range includeDirs {
+		args = append(args, "-I", dir)
+	}
+	if diagFormat != formatText {
+		args = append(args, "-format", diagFormat)
+	}
+	return args
+}
+
+func goldenCommand(args []string) int {
+	flags := flag.NewFlagSet("golden", flag.ExitOnError)
+	update := flags.Bool("update", false, "write results of scripts as expected files")
+	verbose := flags.Bool("v", false, "print all checked scripts")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil golden [-update] [-v] dir...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	run := golden.Command(exe, goldenFlags()...)
+	failed := false
+	for _, dir := range flags.Args() {
+		cases, err := golden.Find(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		passed := 0
+		for _, c := range cases {
+			for _, mode := range golden.Modes {
+				res, err := run(c.Input, mode)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					return 1
+				}
+				if *update {
+					if mode == golden.Int64 {
+						err = c.Update(res)
+					} else {
+						err = c.UpdateMode(res, mode)
+					}
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "%v\n", err)
+						return 1
+					}
+				}
+				diffs, err := c.ForMode(mode).Check(res)
+				if os.IsNotExist(err) {
+					if *verbose {
+						fmt.Printf("--- SKIP: %v: no output file %v\n", c.Input, c.Stdout)
+					}
+					break
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					return 1
+				}
+				if len(diffs) > 0 {
+					failed = true
+					fmt.Printf("--- FAIL: %v (%v)\n", c.Input, mode)
+					for _, d := range diffs {
+						fmt.Print(indent(strings.TrimSuffix(d, "\n") + "\n"))
+					}
+					continue
+				}
+				passed++
+				if *verbose {
+					fmt.Printf("--- PASS: %v (%v)\n", c.Input, mode)
+				}
+			}
+		}
+		fmt.Printf("%v: %v of %v checks passed\n", dir, passed, len(cases)*len(golden.Modes))
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
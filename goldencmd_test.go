@@ -0,0 +1,23 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGoldenFlags(t *testing.T) {
+	defer func(p string, dirs listFlag, f string) {
+		pluginDir, includeDirs, diagFormat = p, dirs, f
+	}(pluginDir, includeDirs, diagFormat)
+
+	pluginDir, includeDirs, diagFormat = "", nil, formatText
+	if args := goldenFlags(); len(args) != 0 {
+		t.Errorf("Expected no flags, found %v", args)
+	}
+
+	pluginDir, includeDirs, diagFormat = "plugins", listFlag{"lib", "vendor"}, formatJSON
+	exp := []string{"-plugin-dir", "plugins", "-I", "lib", "-I", "vendor", "-format", "json"}
+	if args := goldenFlags(); !reflect.DeepEqual(args, exp) {
+		t.Errorf("Incorrect flags: expected %v, actual %v", exp, args)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"plugin"
 	"regexp"
@@ -25,9 +28,51 @@ type Interpret struct {
 
 	// string->filepath map to control where function was initially defined.
 	funcsOrigins map[string]string
+	// user-defined types: where they are defined and their docstrings
+	typeOrigins map[types.Type]string
+	typeDocs    map[types.Type]string
+
+	// standard error of the program (see eprint)
+	Stderr io.Writer
 
 	PluginDir   string
 	IncludeDirs []string
+	// project manifest, nil if the program does not have it
+	manifest *manifest
+
+	// directory of the entry file
+	root string
+	// modules loaded by "use": path relative to root -> file path
+	usedModules map[string]string
+	// plugins loaded by "use plugin": name -> file path
+	usedPlugins map[string]string
+	// module sources embedded into the executable by path relative to root
+	// and directories where they are searched (see bundle.go)
+	embeddedModules map[string][]byte
+	embeddedDirs    []string
+	// warnings found by Check
+	warnings []error
+	// expressions inlined by the optimizer -> name of the inlined function
+	inlined map[*types.Sexpr]string
+	// modules by file path and names imported into files (see module.go)
+	modules    map[string]*module
+	namespaces map[string]*namespace
+	// files which are being parsed, used to detect import cycles
+	parsing []string
+	// embedded libraries which are already loaded and their source files
+	libraries    map[string]bool
+	libraryFiles map[string]bool
+	// arguments of the program
+	args []string
+	// set when the program is stopped (see exitError)
+	exit *exitError
+	// main module is evaluated for every line of stdin (see eachline.go)
+	eachLine   bool
+	printLines bool
+	// constants defined with "const" (see const.go)
+	consts []*constDef
+	// package functions bound to builtin functions: global name -> builtin (see package.go)
+	nativeBindings map[string]string
 
 	intMaker   types.IntMaker
 	floatMaker types.FloatMaker
@@ -36,16 +81,50 @@ type Interpret struct {
 
 	strictTypes bool
 
+	// forall forms are expanded when quickcheck is used
+	quickcheck     bool
+	quickcheckSeed int64
+
 	main *FuncInterpret
+
+	// functions defined with deftest
+	tests []*FuncInterpret
+
+	// code coverage, nil if disabled
+	cover *coverage
+	// profiler, nil if disabled
+	prof *profiler
+	// debugger, nil if disabled
+	debug *debugger
+
+	// cache of canConvertType results used by VM
+	convertCache map[[2]types.Type]convertResult
+}
+
+type convertResult struct {
+	ok  bool
+	err error
 }
 
 func NewInterpreter(w io.Writer) *Interpret {
 	i := &Interpret{
-		output:       w,
-		intMaker:     &types.Int64Maker{},
-		floatMaker:   &types.Float64Maker{},
-		funcsOrigins: make(map[string]string),
-		contracts:    make(map[types.Type]struct{}),
+		output:         w,
+		Stderr:         os.Stderr,
+		intMaker:       &types.Int64Maker{},
+		floatMaker:     &types.Float64Maker{},
+		funcsOrigins:   make(map[string]string),
+		typeOrigins:    make(map[types.Type]string),
+		typeDocs:       make(map[types.Type]string),
+		contracts:      make(map[types.Type]struct{}),
+		convertCache:   make(map[[2]types.Type]convertResult),
+		usedModules:    make(map[string]string),
+		usedPlugins:    make(map[string]string),
+		modules:        make(map[string]*module),
+		namespaces:     make(map[string]*namespace),
+		libraries:      make(map[string]bool),
+		libraryFiles:   make(map[string]bool),
+		nativeBindings: make(map[string]string),
+		inlined:        make(map[*types.Sexpr]string),
 	}
 	i.funcs = map[string]types.Function{
 		"int.plus":      EvalerFunc("+", FPlus, AnyArgs, types.TypeInt),
@@ -65,6 +144,9 @@ func NewInterpreter(w io.Writer) *Interpret {
 		"=":             EvalerFunc("=", FEq, TwoArgs, types.TypeBool),
 		"not":           EvalerFunc("not", FNot, i.OneBoolArg, types.TypeBool),
 		"print":         EvalerFunc("print", i.FPrint, AnyArgs, types.TypeAny),
+		"eprint":        EvalerFunc("eprint", i.FEprint, AnyArgs, types.TypeAny),
+		"exit":          EvalerFunc("exit", i.FExit, AnyArgs, types.TypeUnknown),
+		"error":         EvalerFunc("error", FError, AnyArgs, types.TypeUnknown),
 		"native.head":   EvalerFunc("native.head", FHead, AnyArgs, types.TypeAny),
 		"native.tail":   EvalerFunc("native.tail", FTail, AnyArgs, types.TypeList),
 		"append":        EvalerFunc("append", FAppend, i.AppenderArgs, types.TypeList),
@@ -80,7 +162,14 @@ func NewInterpreter(w io.Writer) *Interpret {
 		"inttofloat":    EvalerFunc("inttofloat", FIntToFloat, AnyArgs, types.TypeFloat),
 		"open":          EvalerFunc("open", FOpen, i.StrArg, types.TypeStr),
 		"type":          EvalerFunc("type", FType, SingleArg, types.TypeStr),
+		"doc":           EvalerFunc("doc", i.FDoc, SingleArg, types.TypeStr),
 		"parse":         EvalerFunc("parse", i.FParse, i.StrArg, types.TypeList),
+		"assert=":       EvalerFunc("assert=", i.FAssertEq, TwoArgs, types.TypeBool),
+		"assert-error":  EvalerFunc("assert-error", i.FAssertError, AnyArgs, types.TypeBool),
+		"assert-type":   EvalerFunc("assert-type", i.FAssertType, TwoArgs, types.TypeBool),
+		"qc.forall":     EvalerFunc("forall", i.FForall, AnyArgs, types.TypeBool),
+		"cli.parse":     EvalerFunc("cli.parse", i.FCliParse, AnyArgs, types.TypeList),
+		"cli.get":       EvalerFunc("cli.get", FCliGet, TwoArgs, types.TypeAny),
 	}
 	i.types = map[types.Type]types.Type{
 		types.TypeUnknown: "",
@@ -108,12 +197,17 @@ func (i *Interpret) UseBigInt(v bool) {
 }
 
 func (i *Interpret) loadLibrary(name string) error {
+	if i.libraries[name] {
+		return nil
+	}
+	i.libraries[name] = true
 	foundFiles := false
 	prefix := fmt.Sprintf("library/%s/", name)
 	for _, file := range library.AssetNames() {
 		if !strings.HasPrefix(file, prefix) {
 			continue
 		}
+		i.libraryFiles[file] = true
 		err := func() error {
 			data := library.MustAsset(file)
 			if err := i.parse(file, bytes.NewReader(data)); err != nil {
@@ -142,6 +236,25 @@ func (i *Interpret) ParseFloat(token string) (types.Float, bool) {
 
 func (i *Interpret) parse(file string, input io.Reader) error {
 	parser := NewParser(input, i)
+	parser.file = file
+	i.parsing = append(i.parsing, file)
+	defer func() { i.parsing = i.parsing[:len(i.parsing)-1] }()
+	// top-level expressions of the file in mainBody
+	var own []int
+	// Header of the file contains "use" and "export" forms.
+	// Pragmas are applied as soon as they are read, modules used in the header
+	// are loaded at the end of the header, so they are affected by all pragmas.
+	header := true
+	var imports []*types.Sexpr
+	endHeader := func() error {
+		header = false
+		for _, se := range imports {
+			if err := i.use(file, se.List[1:]); err != nil {
+				return errorAtCol(file, se.Line, se.Col, err)
+			}
+		}
+		return nil
+	}
 L:
 	for {
 		val, err := parser.NextExpr(false)
@@ -149,15 +262,27 @@ L:
 			break L
 		}
 		if err != nil {
-			return err
+			return errorAt(file, parser.line, err)
+		}
+		if header && !isHeaderForm(val) {
+			if err := endHeader(); err != nil {
+				return err
+			}
+		}
+		if i.quickcheck {
+			expanded, err := i.expandForall(*val)
+			if err != nil {
+				return errorAt(file, parser.line, err)
+			}
+			val = &expanded
 		}
 		switch a := val.E.(type) {
 		case *types.Sexpr:
 			if a.Quoted {
-				return fmt.Errorf("Unexpected quoted s-expression: %v", a)
+				return errorAtCol(file, a.Line, a.Col, fmt.Errorf("Unexpected quoted s-expression: %v", a))
 			}
 			if a.Length() == 0 {
-				return fmt.Errorf("Unexpected empty s-expression on top-level: %v", a)
+				return errorAtCol(file, a.Line, a.Col, fmt.Errorf("Unexpected empty s-expression on top-level: %v", a))
 			}
 			head, _ := a.Head()
 			if name, ok := head.E.(types.Ident); ok {
@@ -169,32 +294,74 @@ L:
 					}
 					tail, _ := a.Tail()
 					if err := i.defineFunc(file, tail.(*types.Sexpr), memo); err != nil {
-						return err
+						return errorAtCol(file, a.Line, a.Col, err)
 					}
 					continue L
 				case "use":
 					tail, _ := a.Tail()
+					if isPragma(tail.(*types.Sexpr).List) {
+						if !header {
+							return errorAtCol(file, a.Line, a.Col, fmt.Errorf("Pragma %v should be placed before definitions and expressions", literal(a)))
+						}
+					} else if header {
+						imports = append(imports, a)
+						continue L
+					}
 					if err := i.use(file, tail.(*types.Sexpr).List); err != nil {
-						return err
+						return errorAtCol(file, a.Line, a.Col, err)
+					}
+					continue L
+				case "export":
+					tail, _ := a.Tail()
+					if err := i.defineExports(file, tail.(*types.Sexpr).List); err != nil {
+						return errorAtCol(file, a.Line, a.Col, err)
+					}
+					continue L
+				case "const":
+					tail, _ := a.Tail()
+					if err := i.defineConst(file, a.Line, tail.(*types.Sexpr).List); err != nil {
+						return errorAtCol(file, a.Line, a.Col, err)
 					}
 					continue L
 				case "deftype":
 					tail, _ := a.Tail()
-					if err := i.defineType(tail.(*types.Sexpr).List); err != nil {
-						return err
+					if err := i.defineType(file, tail.(*types.Sexpr).List); err != nil {
+						return errorAtCol(file, a.Line, a.Col, err)
 					}
 					continue L
 				case "contract":
 					tail, _ := a.Tail()
 					if err := i.defineContract(tail.(*types.Sexpr).List); err != nil {
-						return err
+						return errorAtCol(file, a.Line, a.Col, err)
+					}
+					continue L
+				case "deftest":
+					tail, _ := a.Tail()
+					if err := i.defineTest(file, tail.(*types.Sexpr)); err != nil {
+						return errorAtCol(file, a.Line, a.Col, err)
 					}
 					continue L
 				}
 			}
 		}
+		own = append(own, len(i.mainBody))
 		i.mainBody = append(i.mainBody, *val)
 	}
+	if header {
+		if err := endHeader(); err != nil {
+			return err
+		}
+	}
+	body := make([]types.Value, len(own))
+	for n, idx := range own {
+		body[n] = i.mainBody[idx]
+	}
+	if err := i.resolveNames(file, body); err != nil {
+		return errorAt(file, 0, err)
+	}
+	for n, idx := range own {
+		i.mainBody[idx] = body[n]
+	}
 	return nil
 }
 
@@ -202,35 +369,105 @@ func (i *Interpret) Parse(file string, input io.Reader) error {
 	if err := i.loadLibrary("builtin"); err != nil {
 		return err
 	}
+	i.root = filepath.Dir(file)
+	if i.embeddedModules == nil {
+		m, err := findManifest(filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		i.manifest = m
+	}
 
 	if err := i.parse(file, input); err != nil {
 		return err
 	}
+	if err := i.evalConsts(); err != nil {
+		return err
+	}
 
 	i.main = NewFuncInterpret(i, "__main__")
 	if err := i.main.AddImpl(types.Ident("__main_args"), i.mainBody, false, types.TypeAny); err != nil {
 		return err
 	}
+	i.main.bodies[0].file = file
 	return nil
 }
 
-// type-checking
-func (i *Interpret) Check() []error {
-	return i.CheckReturnTypes()
+// posError is an error at the position of the source file.
+// It has the message of the original error, the position is used by tools (see "spil lsp").
+type posError struct {
+	File string
+	Line int
+	// column is 0 if unknown
+	Col int
+	Err error
+}
+
+func (e *posError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *posError) Unwrap() error {
+	return e.Err
+}
+
+// errorAt attaches position to the error unless it already has one.
+func errorAt(file string, line int, err error) error {
+	return errorAtCol(file, line, 0, err)
+}
+
+// errorAtCol is errorAt with the column of the position.
+func errorAtCol(file string, line, col int, err error) error {
+	var pe *posError
+	if err == nil || line == 0 || errors.As(err, &pe) {
+		return err
+	}
+	return &posError{File: file, Line: line, Col: col, Err: err}
+}
 
+// Check makes type checking of the program.
+// Warnings are problems which do not prevent the program from running, e.g. calls of unknown functions.
+func (i *Interpret) Check() (errs, warnings []error) {
+	i.warnings = nil
+	errs = i.CheckReturnTypes()
+	return errs, i.warnings
 }
 
 func (i *Interpret) Run() error {
+	var args []string
+	if fargs := flag.Args(); len(fargs) > 0 {
+		args = fargs[1:]
+	}
+	return i.RunArgs(args)
+}
+
+// RunArgs runs main function with specified command line arguments.
+// Errors of lazy lists evaluation are raised as panics (see LazyList.Empty), they are returned as errors.
+func (i *Interpret) RunArgs(args []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+		if i.exit != nil {
+			err = i.exit
+		}
+	}()
+	i.args = args
 	stdin := NewLazyInput(os.Stdin)
 	i.main.capturedVars["__stdin"] = &types.Value{E: stdin, T: types.TypeStr}
-	params := []types.Value{}
-	fargs := flag.Args()
-	if len(fargs) > 0 {
-		for _, arg := range fargs[1:] {
-			params = append(params, types.Value{E: types.Str(arg), T: types.TypeStr})
-		}
+	params := make([]types.Value, 0, len(args))
+	for _, arg := range args {
+		params = append(params, types.Value{E: types.Str(arg), T: types.TypeStr})
+	}
+	if i.eachLine {
+		err = i.runLines(stdin, params)
+	} else {
+		_, err = i.main.Eval(params)
 	}
-	_, err := i.main.Eval(params)
 	return err
 }
 
@@ -245,6 +482,10 @@ func (i *Interpret) defineFunc(file string, se *types.Sexpr, memo bool) error {
 	}
 
 	fname := string(name)
+	if m, ok := i.modules[file]; ok {
+		m.funcs[fname] = true
+		fname = m.name + "." + fname
+	}
 	if f1, ok := i.funcsOrigins[fname]; ok && f1 != file {
 		return fmt.Errorf("cannot define function '%v' in file %v: it is already defined in %v", fname, file, f1)
 	}
@@ -261,26 +502,109 @@ func (i *Interpret) defineFunc(file string, se *types.Sexpr, memo bool) error {
 		fi = NewFuncInterpret(i, fname)
 		i.funcs[fname] = fi
 	}
+	body := se.List[2:]
+	doc, body := docString(body)
 	bodyIndex := 2
 	returnType := types.TypeUnknown
 	// Check if return type is specified
-	if identType, ok := se.List[2].E.(types.Ident); ok {
+	if identType, ok := body[0].E.(types.Ident); ok {
 		returnType, ok = types.ParseType(string(identType))
 		if ok {
 			if _, err := i.parseType(string(identType)); err != nil {
 				return fmt.Errorf("%v: %v", fname, err)
 			}
 			bodyIndex++
+			if doc == "" {
+				// docstring after the return type
+				var rest []types.Value
+				doc, rest = docString(body[1:])
+				body = append(body[:1:1], rest...)
+			}
 		}
 	}
 	// TODO
-	if err := fi.AddImpl(se.List[1].E, se.List[2:], memo, returnType); err != nil {
+	if err := fi.AddImpl(se.List[1].E, body, memo, returnType); err != nil {
 		return err
 	}
+	impl := fi.bodies[len(fi.bodies)-1]
+	impl.file, impl.line, impl.col, impl.doc = file, se.Line, se.Col, doc
 	i.funcsOrigins[fname] = file
 	return nil
 }
 
+// docString splits off the docstring: a string followed by the function body.
+func docString(body []types.Value) (string, []types.Value) {
+	if len(body) == 0 {
+		return "", body
+	}
+	s, ok := body[0].E.(types.Str)
+	if !ok {
+		return "", body
+	}
+	for _, st := range body[1:] {
+		if id, ok := st.E.(types.Ident); ok {
+			if _, ok := types.ParseType(string(id)); ok {
+				continue
+			}
+		}
+		return string(s), body[1:]
+	}
+	// the string is the result of the function
+	return "", body
+}
+
+// (deftest name body...)
+func (i *Interpret) defineTest(file string, se *types.Sexpr) error {
+	args := se.List
+	if len(args) < 1 {
+		return fmt.Errorf("deftest expects test name")
+	}
+	name, ok := args[0].E.(types.Ident)
+	if !ok {
+		return fmt.Errorf("deftest expects identifier as test name, found %v", args[0])
+	}
+	// test name should not match names of functions called in tail position
+	fname := "deftest " + string(name)
+	for _, t := range i.tests {
+		if t.name == fname {
+			return fmt.Errorf("Test %v is already defined", name)
+		}
+	}
+	fi := NewFuncInterpret(i, fname)
+	if err := fi.AddImpl(&types.Sexpr{}, args[1:], false, types.TypeUnknown); err != nil {
+		return err
+	}
+	fi.bodies[0].file, fi.bodies[0].line, fi.bodies[0].col = file, se.Line, se.Col
+	i.tests = append(i.tests, fi)
+	return nil
+}
+
+// isHeaderForm returns true for "use" and "export" forms.
+func isHeaderForm(v *types.Value) bool {
+	se, ok := v.E.(*types.Sexpr)
+	if !ok || se.Quoted || se.Length() == 0 {
+		return false
+	}
+	head, ok := se.List[0].E.(types.Ident)
+	return ok && (head == "use" || head == "export")
+}
+
+// isPragma returns true if "use" changes the interpreter rather than imports a module.
+func isPragma(args []types.Value) bool {
+	if len(args) == 0 {
+		return false
+	}
+	name, ok := args[0].E.(types.Ident)
+	if !ok {
+		return false
+	}
+	switch name {
+	case "bigmath", "strict", "std", "cli", "quickcheck", "plugin":
+		return true
+	}
+	return false
+}
+
 func (i *Interpret) use(file string, args []types.Value) error {
 	if len(args) < 1 {
 		return fmt.Errorf("'use' expects arguments, none found.")
@@ -288,17 +612,19 @@ func (i *Interpret) use(file string, args []types.Value) error {
 	module := args[0]
 	switch a := module.E.(type) {
 	case types.Str:
-		return i.useModule(string(a))
+		return i.useModule(file, string(a), args[1:])
 	case types.Ident:
 		switch string(a) {
 		case "bigmath":
 			i.UseBigInt(true)
-		case "std":
-			if err := i.loadLibrary("std"); err != nil {
+		case "std", "cli":
+			if err := i.loadLibrary(string(a)); err != nil {
 				return err
 			}
 		case "strict":
 			i.strictTypes = true
+		case "quickcheck":
+			return i.useQuickcheck(args[1:])
 		case "plugin":
 			if len(args) < 2 {
 				return fmt.Errorf("'use plugin' expects argument, none found")
@@ -308,6 +634,15 @@ func (i *Interpret) use(file string, args []types.Value) error {
 				return fmt.Errorf("'use plugin' expects string argument, found: %v", args[2])
 			}
 			return i.usePlugin(file, string(name))
+		case "pkg":
+			if len(args) < 2 {
+				return fmt.Errorf("'use pkg' expects package name, none found")
+			}
+			name, ok := args[1].E.(types.Str)
+			if !ok {
+				return fmt.Errorf("'use pkg' expects string argument, found: %v", args[1])
+			}
+			return i.usePackage(file, string(name), args[2:])
 		default:
 			return fmt.Errorf("Unexpected argument to 'use': %v", string(a))
 		}
@@ -316,8 +651,11 @@ func (i *Interpret) use(file string, args []types.Value) error {
 	return fmt.Errorf("Unexpected argument type to 'use': %v (%T)", module, module)
 }
 
-func (in *Interpret) useModule(name string) error {
-	includeDirs := append([]string{"."}, in.IncludeDirs...)
+func (in *Interpret) useModule(file, name string, opts []types.Value) error {
+	if in.embeddedModules != nil {
+		return in.useEmbeddedModule(file, name, opts)
+	}
+	includeDirs := in.moduleDirs(file)
 	for _, d := range includeDirs {
 		filename := filepath.Join(d, name)
 		f, err := os.Open(filename)
@@ -327,21 +665,85 @@ func (in *Interpret) useModule(name string) error {
 		defer f.Close()
 		fpath, err := filepath.Abs(filename)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Cannot detect absolute path for %v: %v\n", filename, err)
+			fmt.Fprintf(in.Stderr, "Cannot detect absolute path for %v: %v\n", filename, err)
 			fpath = filename
 		}
-		return in.parse(fpath, f)
+		in.usedModules[in.rootPath(fpath)] = fpath
+		return in.loadModule(file, fpath, f, opts)
 	}
 	return fmt.Errorf("Module %v not found in %v", name, includeDirs)
 }
 
+// useEmbeddedModule loads module from the bundle.
+// It is searched relative to the using file first, then in directories the bundle was made with.
+func (in *Interpret) useEmbeddedModule(file, name string, opts []types.Value) error {
+	dirs := append([]string{path.Dir(file)}, in.embeddedDirs...)
+	for _, d := range dirs {
+		key := path.Join(d, name)
+		if data, ok := in.embeddedModules[key]; ok {
+			return in.loadModule(file, key, bytes.NewReader(data), opts)
+		}
+	}
+	return fmt.Errorf("Module %v not found in the bundle", name)
+}
+
+// rootPath returns slash-separated path of the file relative to the directory of the entry file.
+func (in *Interpret) rootPath(file string) string {
+	root, err := filepath.Abs(in.root)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// loadModule parses the module if it is not loaded yet and imports it into the file.
+func (in *Interpret) loadModule(file, fpath string, r io.Reader, opts []types.Value) error {
+	m, err := in.parseModule(fpath, r, nil)
+	if err != nil {
+		return err
+	}
+	return in.importModule(file, m, opts)
+}
+
+// parseModule parses the module if it is not loaded yet.
+// init is called for the new module before parsing.
+func (in *Interpret) parseModule(fpath string, r io.Reader, init func(m *module) error) (*module, error) {
+	for idx, f := range in.parsing {
+		if f == fpath {
+			chain := append(append([]string{}, in.parsing[idx:]...), fpath)
+			return nil, fmt.Errorf("Import cycle: %v", strings.Join(chain, " -> "))
+		}
+	}
+	if m, ok := in.modules[fpath]; ok {
+		return m, nil
+	}
+	m := in.newModule(fpath)
+	if init != nil {
+		if err := init(m); err != nil {
+			return nil, err
+		}
+	}
+	if err := in.parse(fpath, r); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (in *Interpret) usePlugin(file, name string) (err error) {
 	var (
 		plug     *plugin.Plugin
 		filename string
 	)
 	fdir := filepath.Dir(file)
-	for _, dir := range []string{fdir, in.PluginDir} {
+	dirs := []string{fdir, in.PluginDir}
+	if in.manifest != nil {
+		dirs = append(dirs, in.manifest.plugins...)
+	}
+	for _, dir := range dirs {
 		// search "someplug" in "$dir/someplug/someplug.so"
 		filename = filepath.Join(dir, name, name+".so")
 		plug, err = plugin.Open(filename)
@@ -354,8 +756,9 @@ func (in *Interpret) usePlugin(file, name string) (err error) {
 		break
 	}
 	if plug == nil {
-		return fmt.Errorf("Plugin '%v' not found in directories: %v, %v", name, fdir, in.PluginDir)
+		return fmt.Errorf("Plugin '%v' not found in directories: %v", name, strings.Join(dirs, ", "))
 	}
+	in.usedPlugins[name] = filename
 
 	sym, err := plug.Lookup("Types")
 	if err != nil {
@@ -383,9 +786,9 @@ func (in *Interpret) usePlugin(file, name string) (err error) {
 	return nil
 }
 
-// (new-type) (old-type)
-func (in *Interpret) defineType(args []types.Value) error {
-	if len(args) != 2 {
+// (new-type) (old-type) ["docstring"]
+func (in *Interpret) defineType(file string, args []types.Value) error {
+	if len(args) != 2 && len(args) != 3 {
 		return fmt.Errorf("'deftype' expected two arguments, found: %v", args)
 	}
 	newId, ok := args[0].E.(types.Ident)
@@ -414,6 +817,14 @@ func (in *Interpret) defineType(args []types.Value) error {
 		return fmt.Errorf("Basic type does not exist: %v", oldType)
 	}
 	in.types[newType] = oldType
+	in.typeOrigins[newType] = file
+	if len(args) == 3 {
+		doc, ok := args[2].E.(types.Str)
+		if !ok {
+			return fmt.Errorf("deftype expects docstring as third argument, found: %v", args[2])
+		}
+		in.typeDocs[newType] = string(doc)
+	}
 	return nil
 }
 
@@ -472,18 +883,63 @@ func (in *Interpret) canConvertType(from, to types.Type) (bool, error) {
 		}
 		from = parent
 	}
-	panic("Unreachable return")
+}
+
+// updateTypeCached works like FuncRuntime.updateType but caches type conversion checks.
+// Types cannot be defined after parsing so the cache is never invalidated.
+func (in *Interpret) updateTypeCached(oldT, newT types.Type) (types.Type, error) {
+	if oldT == types.TypeUnknown {
+		return newT, nil
+	}
+	key := [2]types.Type{oldT, newT}
+	res, ok := in.convertCache[key]
+	if !ok {
+		res.ok, res.err = in.canConvertType(oldT, newT)
+		in.convertCache[key] = res
+	}
+	if res.err != nil {
+		return types.TypeUnknown, res.err
+	}
+	if res.ok {
+		return oldT, nil
+	}
+	return newT, nil
 }
 
 func (in *Interpret) FPrint(args []types.Value) (*types.Value, error) {
+	if err := printValues(in.output, args); err != nil {
+		return nil, err
+	}
+	return &types.Value{E: types.QEmpty, T: types.TypeList}, nil
+}
+
+// printBufferSize is the size of output lines written at once by print.
+const printBufferSize = 4096
+
+// printValues prints values separated with spaces and new line.
+// Short lines are written at once, so nothing is printed if evaluation of a lazy list fails,
+// longer ones (e.g. infinite lazy lists) are written as they are evaluated.
+func printValues(w io.Writer, args []types.Value) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	b := bufio.NewWriterSize(w, printBufferSize)
 	for i, e := range args {
 		if i > 0 {
-			fmt.Fprintf(in.output, " ")
+			fmt.Fprintf(b, " ")
 		}
-		e.E.Print(in.output)
+		e.E.Print(b)
 	}
-	fmt.Fprintf(in.output, "\n")
-	return &types.Value{E: types.QEmpty, T: types.TypeList}, nil
+	fmt.Fprintf(b, "\n")
+	// write errors are ignored like in the rest of output functions
+	b.Flush()
+	return nil
 }
 
 // convert string into int
@@ -615,13 +1071,6 @@ func (in *Interpret) DeleteLambda(name string) {
 	}
 }
 
-func (in *Interpret) Stat() {
-	fmt.Fprintf(os.Stderr, "Functions:\n")
-	for fname, _ := range in.funcs {
-		fmt.Fprintf(os.Stderr, "%v\n", fname)
-	}
-}
-
 func (i *Interpret) CheckReturnTypes() (errs []error) {
 	mainArgs := map[string]types.Type{
 		"__stdin": types.TypeStr,
@@ -630,10 +1079,19 @@ func (i *Interpret) CheckReturnTypes() (errs []error) {
 	for i := 1; i <= 9; i++ {
 		mainArgs[fmt.Sprintf("_%d", i)] = types.TypeStr
 	}
+	if i.eachLine {
+		mainArgs["line"] = types.TypeStr
+		mainArgs["nr"] = types.TypeInt
+	}
 	_, err := i.evalBodyType("__main__", i.mainBody, mainArgs, nil)
 	if err != nil {
 		errs = append(errs, err)
 	}
+	for _, t := range i.tests {
+		if _, err := i.evalBodyType(t.name, t.bodies[0].body, map[string]types.Type{}, nil); err != nil {
+			errs = append(errs, inFunc(t.name, errorAt(t.bodies[0].file, t.bodies[0].line, err)))
+		}
+	}
 	for _, fn := range i.funcs {
 		fi, ok := fn.(*FuncInterpret)
 		if !ok {
@@ -644,26 +1102,26 @@ func (i *Interpret) CheckReturnTypes() (errs []error) {
 		for _, impl := range fi.bodies {
 			if i.strictTypes {
 				if impl.returnType == types.TypeUnknown {
-					err := fmt.Errorf("%v : %v: return type should be specified in strict mode", i.funcsOrigins[fi.name], fi.name)
-					errs = append(errs, err)
+					err := withCode(codeStrictTypes, fmt.Errorf("%v : %v: return type should be specified in strict mode", i.funcsOrigins[fi.name], fi.name))
+					errs = append(errs, inFunc(fi.name, errorAtCol(impl.file, impl.line, impl.col, err)))
 				}
 				if impl.argfmt.Wildcard == "" {
 					for _, a := range impl.argfmt.Args {
 						if a.T == types.TypeUnknown {
-							err := fmt.Errorf("%v : %v: arument type should be specified in strict mode: %v", i.funcsOrigins[fi.name], fi.name, a.Name)
-							errs = append(errs, err)
+							err := withCode(codeStrictTypes, fmt.Errorf("%v : %v: arument type should be specified in strict mode: %v", i.funcsOrigins[fi.name], fi.name, a.Name))
+							errs = append(errs, inFunc(fi.name, errorAtCol(impl.file, impl.line, impl.col, err)))
 						}
 					}
 				}
 			}
 			t, err := i.evalBodyType(fi.name, impl.body, impl.argfmt.Values(), nil)
 			if err != nil {
-				errs = append(errs, err)
+				errs = append(errs, inFunc(fi.name, errorAtCol(impl.file, impl.line, impl.col, err)))
 			}
 			if impl.returnType != types.TypeUnknown && !i.IsGeneric(impl.returnType) {
 				if ok, err := i.canConvertType(t, impl.returnType); !ok || err != nil {
-					err := fmt.Errorf("Incorrect return value in function %v(%v): expected %v actual %v (%v)", fi.name, impl.argfmt, impl.returnType, t, err)
-					errs = append(errs, err)
+					err := withCode(codeCannotCast, fmt.Errorf("Incorrect return value in function %v(%v): expected %v actual %v (%v)", fi.name, impl.argfmt, impl.returnType, t, err))
+					errs = append(errs, inFunc(fi.name, errorAtCol(impl.file, impl.line, impl.col, err)))
 				}
 			}
 		}
@@ -724,12 +1182,12 @@ L:
 				for i, arg := range a.List[1:] {
 					_, err := in.exprType(fname, arg, vars)
 					if err != nil {
-						return u, fmt.Errorf("%v: incorrect argument to print at posision %v: %v", fname, i, err)
+						return u, fmt.Errorf("%v: incorrect argument to print at posision %v: %w", fname, i, err)
 					}
 				}
 			default:
 				if _, err := in.exprType(fname, stt, vars); err != nil {
-					return u, fmt.Errorf("%v: %v", fname, err)
+					return u, fmt.Errorf("%v: %w", fname, err)
 				}
 			}
 		}
@@ -754,6 +1212,11 @@ var reArg = regexp.MustCompile(`^_[0-9]+$`)
 
 func (i *Interpret) exprType(fname string, e types.Value, vars map[string]types.Type) (result types.Type, err error) {
 	const u = types.TypeUnknown
+	if se, ok := e.E.(*types.Sexpr); ok {
+		defer func() {
+			err = errorAtCol(se.File, se.Line, se.Col, err)
+		}()
+	}
 	switch a := e.E.(type) {
 	case types.Int, types.Float, types.Str, types.Bool:
 		return e.T, nil
@@ -812,7 +1275,7 @@ func (i *Interpret) exprType(fname string, e types.Value, vars map[string]types.
 			}
 			fi, ok := i.funcs[string(a.List[1].E.(types.Ident))]
 			if !ok {
-				return u, fmt.Errorf("%v: unknown function supplied to apply: %v", fname, a.List[1])
+				return u, withCode(codeUnknownFunction, fmt.Errorf("%v: unknown function supplied to apply: %v", fname, a.List[1]))
 			}
 			if returnTyper, ok := fi.(ReturnTyper); ok {
 				return returnTyper.ReturnType(), nil
@@ -866,24 +1329,24 @@ func (i *Interpret) exprType(fname string, e types.Value, vars map[string]types.
 						switch a := item.E.(type) {
 						case types.Int:
 							if ok, err := i.canConvertType(types.TypeInt, types.Type(args[idx])); !ok || err != nil {
-								return u, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeInt)
+								return u, withCode(codeCannotCast, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeInt))
 							}
 						case types.Str:
 							if ok, err := i.canConvertType(types.TypeStr, types.Type(args[idx])); !ok || err != nil {
-								return u, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeStr)
+								return u, withCode(codeCannotCast, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeStr))
 							}
 						case types.Bool:
 							if ok, err := i.canConvertType(types.TypeBool, types.Type(args[idx])); !ok || err != nil {
-								return u, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeBool)
+								return u, withCode(codeCannotCast, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeBool))
 							}
 						case *types.Sexpr:
 							if a.Empty() || a.Quoted {
 								if ok, err := i.canConvertType(types.TypeList, types.Type(args[idx])); !ok || err != nil {
-									return u, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeList)
+									return u, withCode(codeCannotCast, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeList))
 								}
 							} else if a.Lambda {
 								if ok, err := i.canConvertType(types.TypeFunc, types.Type(args[idx])); !ok || err != nil {
-									return u, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeFunc)
+									return u, withCode(codeCannotCast, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), types.TypeFunc))
 								}
 							} else {
 								itemType, err := i.exprType(fname, item, vars)
@@ -892,7 +1355,7 @@ func (i *Interpret) exprType(fname string, e types.Value, vars map[string]types.
 								}
 								if !i.IsGeneric(itemType) {
 									if ok, err := i.canConvertType(itemType, types.Type(args[idx])); !ok || err != nil {
-										return u, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), itemType)
+										return u, withCode(codeCannotCast, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), itemType))
 									}
 								}
 							}
@@ -903,7 +1366,7 @@ func (i *Interpret) exprType(fname string, e types.Value, vars map[string]types.
 							}
 							if !i.IsGeneric(itemType) {
 								if ok, err := i.canConvertType(itemType, types.Type(args[idx])); !ok || err != nil {
-									return u, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), itemType)
+									return u, withCode(codeCannotCast, fmt.Errorf("%v: cannot use %v as argument %d to %v: expected %v, found %v", fname, item, idx, name, types.Type(args[idx]), itemType))
 								}
 							}
 						default:
@@ -916,7 +1379,8 @@ func (i *Interpret) exprType(fname string, e types.Value, vars map[string]types.
 			}
 			f, ok := i.funcs[name]
 			if !ok {
-				fmt.Fprintf(os.Stderr, "%v: cannot detect return type of function %v\n", fname, name)
+				err := withCode(codeUnknownFunction, fmt.Errorf("%v: cannot detect return type of function %v", fname, name))
+				i.warnings = append(i.warnings, inFunc(fname, errorAtCol(a.File, a.Line, a.Col, err)))
 				return types.TypeAny, nil
 			}
 
@@ -957,7 +1421,7 @@ func (i *Interpret) exprType(fname string, e types.Value, vars map[string]types.
 			if binder, ok := f.(Binder); ok {
 				t, err := binder.TryBindAll(params)
 				if err != nil {
-					return u, fmt.Errorf("%v: %v", fname, err)
+					return u, fmt.Errorf("%v: %w", fname, err)
 				}
 
 				return t, nil
@@ -966,7 +1430,7 @@ func (i *Interpret) exprType(fname string, e types.Value, vars map[string]types.
 			return types.TypeUnknown, nil
 		}
 	}
-	fmt.Fprintf(os.Stderr, "Unexpected return. (TypeAny)\n")
+	fmt.Fprintf(i.Stderr, "Unexpected return. (TypeAny)\n")
 	return types.TypeAny, nil
 }
 
@@ -997,7 +1461,7 @@ func (in *Interpret) toParent(from, parent types.Type) (types.Type, error) {
 			// generic
 			continue
 		}
-		binds[string('a'+i)] = p
+		binds[string(rune('a'+i))] = p
 	}
 	f := from.Canonical()
 	for {
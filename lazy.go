@@ -64,12 +64,12 @@ func (l *LazyList) Print(w io.Writer) {
 
 		val, err := ll.Head()
 		if err != nil {
-			panic(fmt.Errorf("Head() failed: %v", err))
+			panic(fmt.Errorf("Head() failed: %w", err))
 		}
 		val.E.Print(w)
 		ll, err = ll.Tail()
 		if err != nil {
-			panic(fmt.Errorf("Tail() failed: %v", err))
+			panic(fmt.Errorf("Tail() failed: %w", err))
 		}
 	}
 	io.WriteString(w, ")")
@@ -93,9 +93,12 @@ func (l *LazyList) Head() (*types.Value, error) {
 }
 
 func (l *LazyList) next() (err error) {
+	if fi, ok := l.iter.(*FuncInterpret); ok && fi.interpret.prof != nil {
+		fi.interpret.prof.forced(fi)
+	}
 	expr, err := l.iter.Eval(l.state)
 	if err != nil {
-		return fmt.Errorf("LazyList: Eval(%v) failed: %v", l.state, err)
+		return fmt.Errorf("LazyList: Eval(%v) failed: %w", l.state, err)
 	}
 	res, ok := expr.E.(*types.Sexpr)
 	if !ok {
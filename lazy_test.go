@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -116,3 +117,26 @@ func TestLazyListFiniteString(t *testing.T) {
 		t.Errorf("Incorrect string representation of LazyList: expected %q, actual %q", exp, act)
 	}
 }
+
+var errOutputLimit = errors.New("output limit reached")
+
+// limitWriter stops the program after the limit of output is reached.
+type limitWriter struct {
+	n, limit int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.n += len(p); w.n > w.limit {
+		panic(errOutputLimit)
+	}
+	return len(p), nil
+}
+
+func TestPrintInfiniteLazyList(t *testing.T) {
+	w := &limitWriter{limit: 3 * printBufferSize}
+	in := NewInterpreter(w)
+	err := run(in, "main.lisp", strings.NewReader("(def inc (n) (+ n 1))\n(print (gen inc 0))"), true)
+	if !errors.Is(err, errOutputLimit) {
+		t.Errorf("Expected output limit to be reached, found %v", err)
+	}
+}
@@ -1,8 +1,8 @@
 (contract :a)
 
-(def head (l:list[a]) :a (native.head l) :a)
+(def head (l:list[a]) :a "Returns the first element of the list." (native.head l) :a)
  
-(def tail (l:list[a]) :list[a] (native.tail l) :list[a])
+(def tail (l:list[a]) :list[a] "Returns the list without its first element." (native.tail l) :list[a])
 
 ; (def append (l:list[a] x:a) :list[a] (native.append l x) :list[a])
 
@@ -1,19 +1,19 @@
 ; int operations
-(def + (args:args[int]) :int (apply int.plus args) :int)
-(def - (args:args[int]) :int (apply int.minus args) :int)
-(def * (args:args[int]) :int (apply int.mult args) :int)
-(def / (args:args[int]) :int (apply int.div args) :int)
+(def + (args:args[int]) :int "Sum of the numbers." (apply int.plus args) :int)
+(def - (args:args[int]) :int "Subtracts the rest of the numbers from the first one." (apply int.minus args) :int)
+(def * (args:args[int]) :int "Product of the numbers." (apply int.mult args) :int)
+(def / (args:args[int]) :int "Divides the first number by the rest of the numbers." (apply int.div args) :int)
 
 ; float operations
-(def + (args:args[float]) :float (apply float.plus args) :float)
-(def - (args:args[float]) :float (apply float.minus args) :float)
-(def * (args:args[float]) :float (apply float.mult args) :float)
-(def / (args:args[float]) :float (apply float.div args) :float)
+(def + (args:args[float]) :float "Sum of the numbers." (apply float.plus args) :float)
+(def - (args:args[float]) :float "Subtracts the rest of the numbers from the first one." (apply float.minus args) :float)
+(def * (args:args[float]) :float "Product of the numbers." (apply float.mult args) :float)
+(def / (args:args[float]) :float "Divides the first number by the rest of the numbers." (apply float.div args) :float)
 
 ; convert to int
-(def int (s:str) :int (strtoint s))
-(def int (f:float) :int (floattoint f))
+(def int (s:str) :int "Converts the value to integer." (strtoint s))
+(def int (f:float) :int "Converts the value to integer." (floattoint f))
 
 ; convert to float
-(def float (s:str) :float (strtofloat s))
-(def float (x:int) :float (inttofloat x))
+(def float (s:str) :float "Converts the value to float." (strtofloat s))
+(def float (x:int) :float "Converts the value to float." (inttofloat x))
@@ -1,17 +1,17 @@
 ;; compare integers
-(def < (a:int b:int) :bool (int.less a b))
-(def > (a:int b:int) :bool (int.less b a))
-(def <= (a:int b:int) :bool (not (int.less b a)))
-(def >= (a:int b:int) :bool (not (int.less a b)))
+(def < (a:int b:int) :bool "Checks that a is less than b." (int.less a b))
+(def > (a:int b:int) :bool "Checks that a is greater than b." (int.less b a))
+(def <= (a:int b:int) :bool "Checks that a is less than or equal to b." (not (int.less b a)))
+(def >= (a:int b:int) :bool "Checks that a is greater than or equal to b." (not (int.less a b)))
 
 ;; compare strings
-(def < (a:str b:str) :bool (str.less a b))
-(def > (a:str b:str) :bool (str.less b a))
-(def <= (a:str b:str) :bool (not (str.less b a)))
-(def >= (a:str b:str) :bool (not (str.less a b)))
+(def < (a:str b:str) :bool "Checks that a is less than b." (str.less a b))
+(def > (a:str b:str) :bool "Checks that a is greater than b." (str.less b a))
+(def <= (a:str b:str) :bool "Checks that a is less than or equal to b." (not (str.less b a)))
+(def >= (a:str b:str) :bool "Checks that a is greater than or equal to b." (not (str.less a b)))
 
 ;; compare floats
-(def < (a:float b:float) :bool (float.less a b))
-(def > (a:float b:float) :bool (float.less b a))
-(def <= (a:float b:float) :bool (not (float.less b a)))
-(def >= (a:float b:float) :bool (not (float.less a b)))
+(def < (a:float b:float) :bool "Checks that a is less than b." (float.less a b))
+(def > (a:float b:float) :bool "Checks that a is greater than b." (float.less b a))
+(def <= (a:float b:float) :bool "Checks that a is less than or equal to b." (not (float.less b a)))
+(def >= (a:float b:float) :bool "Checks that a is greater than or equal to b." (not (float.less a b)))
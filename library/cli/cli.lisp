@@ -0,0 +1,6 @@
+;; command line parsing (cli.parse and cli.get are builtin)
+(def cli.int (opts:list name:str) :int "Returns parsed :int flag or argument." (do (cli.get opts name) :int))
+(def cli.float (opts:list name:str) :float "Returns parsed :float flag or argument." (do (cli.get opts name) :float))
+(def cli.str (opts:list name:str) :str "Returns parsed :str flag or argument." (do (cli.get opts name) :str))
+(def cli.bool (opts:list name:str) :bool "Returns parsed :bool flag or argument." (do (cli.get opts name) :bool))
+(def cli.rest (opts:list name:str) :list "Returns list of remaining arguments." (do (cli.get opts name) :list))
@@ -3,6 +3,7 @@
 // library/builtin/list.lisp
 // library/builtin/numbers.lisp
 // library/builtin/order.lisp
+// library/cli/cli.lisp
 // library/std/builtin.lisp
 // library/std/math.lisp
 // library/std/numeric.lisp
@@ -74,7 +75,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _libraryBuiltinListLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x8d\xc1\x0a\xc2\x30\x10\x44\xef\xf9\x8a\x39\x26\x17\x3f\x20\x7e\x8a\x78\x18\xdb\x54\x03\xcb\x5a\xda\x45\xda\xbf\x17\xb7\xa5\x56\x10\xf1\x36\xec\xbc\x79\x1b\x9b\xbb\xda\xc0\xc6\x90\x99\x42\x88\x6d\xe9\x70\x2b\x6c\x11\x25\x4b\x1d\xed\xc4\x73\x42\x26\xa2\xd2\xea\xa3\x1c\xbc\x93\xe4\x34\x16\xdc\x58\xe5\x13\x5f\xd3\x36\x72\x42\xde\x45\x0a\xe1\x08\xdf\xb2\xef\x8b\xee\x9f\x61\xca\xfc\x62\x58\x39\xc1\xf4\xaf\xe5\xb2\x81\x3a\xff\xf4\xe8\xbc\x33\x75\xaf\x1b\x38\x5c\xc7\xa5\xf6\x98\xc2\x33\x00\x00\xff\xff\xa3\xe0\x51\xa8\x26\x01\x00\x00")
+var _libraryBuiltinListLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\xcf\x41\x6e\x86\x20\x10\x05\xe0\x3d\xa7\x78\x71\x05\x1b\x0f\x40\x6f\xd1\x6d\xd3\xc5\x54\x07\x25\xa1\x68\x60\x6c\xf5\xf6\x0d\x68\x5b\xdc\xfc\xf9\x77\x64\xf2\xde\xf7\x82\x1e\x96\x28\x89\x06\x81\x25\xa3\x94\x1e\xd9\x61\x66\x1a\xa1\x83\x0d\x3e\xcb\x1b\xbd\x1b\x58\x42\xf7\xca\xb2\xa5\x98\x21\x33\xc3\xf9\x94\x05\x1c\xf8\x93\xa3\x60\x71\xf5\x58\xd2\x7d\x07\x1d\x49\xfc\x17\xf7\x15\x09\xa5\x6b\x14\x4e\x57\xc8\x87\xbb\x7b\xbd\xee\x7a\x39\xe2\xdb\xcb\xbc\x6c\x02\x2f\xf9\x3e\xd7\x4c\x54\x2f\xfc\x33\x46\xa9\x17\xd4\x25\x5a\x57\x8e\xed\x1f\xb0\x5b\x6a\xf6\x7e\x85\x2b\x17\xb0\x3f\xab\x7c\xfc\x05\xe3\xf1\xd0\x89\x47\x23\xb9\x02\x80\xd2\x94\xcf\x36\x28\x4d\xd9\xa8\x9f\x01\x00\x6c\x21\x3a\x55\x7d\x01\x00\x00")
 
 func libraryBuiltinListLispBytes() ([]byte, error) {
 	return bindataRead(
@@ -94,7 +95,7 @@ func libraryBuiltinListLisp() (*asset, error) {
 	return a, nil
 }
 
-var _libraryBuiltinNumbersLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x91\x4d\x8e\x83\x30\x0c\x85\xf7\x39\x85\x97\x84\xd1\x0c\x7b\x38\xca\x68\x16\xd1\x40\xaa\x48\x69\x12\x25\x06\xd1\xdb\x57\xce\x0f\x0a\x2d\x2a\x6c\x90\x8d\xdf\xfb\x8c\x1f\x03\x28\x83\x60\xdd\xe4\x05\x2a\x6b\x02\x6b\xc6\x49\xc2\x17\x34\xc2\xdf\x42\x4f\x8f\x5f\x65\xf0\x8f\x43\x4f\xba\x46\x38\xa7\x1f\x64\xf9\x71\x7a\x0e\x40\xf3\x34\xe2\xc9\xf8\x7d\x6e\xbc\x2b\x73\xe4\x6c\x2f\x38\x67\x8d\xef\xc6\xee\xdc\x38\xaa\x65\xe7\x63\x03\x48\x6d\xc5\xc9\xdd\x51\x42\xb4\xa4\xcd\xbc\xd8\xec\xae\x8f\x6f\x8e\xee\xff\x04\xd8\xa5\x50\x13\xda\xcb\x84\x2a\x8d\x1a\xd0\x5d\x05\x54\xa9\x64\x3f\x1b\xe0\xdf\x9a\x65\xf2\x08\x68\x29\xb9\x44\x8c\x69\x86\x3e\xa0\x2f\xd1\x06\xf4\x68\xa9\x0a\x9c\x57\x1a\x99\x41\x59\x15\x9b\xa4\x93\xfc\x95\x1e\x87\xc9\x9b\xbf\xad\x6c\x28\x2d\xed\x48\xf5\xb6\x25\x8f\xd6\xf8\x1b\x37\xa5\x32\x58\x94\x2b\xe7\xec\x19\x00\x00\xff\xff\x7e\xc8\xab\x4e\xd3\x02\x00\x00")
+var _libraryBuiltinNumbersLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xa4\x93\xc1\x6e\xfa\x30\x0c\xc6\xef\x7d\x0a\x8b\x53\xcb\x5f\x7f\xb8\xc3\x71\x7b\x80\x49\x3b\x4e\x3b\x04\x9a\xb0\x48\x6d\x52\x39\x4e\x05\x6f\x3f\xd9\x09\xa3\x05\x5a\x90\xb8\xa0\x04\xdb\xbf\xef\x33\x1f\xd9\x82\x75\x04\xbe\xd3\xa8\xc8\x7a\x17\x8a\xb2\xd6\x06\xfe\x41\xa9\xf0\x10\x36\xfc\xf1\x65\x1d\x7d\x57\xb0\xe1\xbe\xc5\x67\x6c\xc1\x1b\xa0\x1f\x0d\x2e\xb6\x3b\x8d\x61\xb5\x80\x52\x75\x5d\x73\x62\xd0\xaa\x6b\x62\x00\x9e\x4a\x03\x55\xc2\xfd\x9f\xc6\xed\x08\xd5\x9e\x82\x10\x51\x07\xba\xa2\x83\x41\xdf\x4a\xd1\x58\xe4\xaa\xd3\x63\xc1\xd6\xba\x7b\x8a\xcb\x29\xc5\x0f\xf4\x75\xdc\xd3\xec\x12\x6d\x6c\xe8\x16\xb9\x9e\x42\xbe\xdb\xde\xd6\x3a\x0c\x5c\x26\xf3\xb0\x3b\x4d\xad\x35\xd6\xab\x6d\x3f\x92\x2b\xb6\x60\x1a\xaf\x1e\xc4\x22\x2d\x1c\x8c\x1c\xe6\xa3\x91\x96\x51\x38\xf2\xcd\xbd\x78\x6e\xb1\xaf\x44\x24\xb4\x71\x48\x43\xe5\xe5\x9c\xf2\xa3\xa8\x32\x7b\x10\xd6\x10\xbd\x9e\x43\xbf\x14\x99\x30\x86\xa1\x65\xd9\x62\x0b\x7b\xef\x7a\x8d\x04\xe4\xf9\x35\x24\x23\xfc\x6e\xca\xb0\x09\x84\xe7\x3f\xcc\x5b\xea\x4a\xf2\xbd\x6a\xa2\xce\x03\xfa\xa0\x91\xf7\x0b\x84\xe4\x79\x2e\x54\x79\x1b\xbe\x94\x26\x2b\x3d\x8b\x91\xee\x04\x32\xd5\xb5\x3f\x29\x26\xb8\x1c\x2f\x1e\xf3\x6f\x74\x1f\x2f\xc5\x3f\x8f\x72\xbb\xb8\xcc\xa0\x23\xfb\x7b\x1a\x64\x1d\x9d\x41\xc7\xaa\x2a\x7e\x07\x00\xff\xe6\x3c\x62\x91\x04\x00\x00")
 
 func libraryBuiltinNumbersLispBytes() ([]byte, error) {
 	return bindataRead(
@@ -114,7 +115,7 @@ func libraryBuiltinNumbersLisp() (*asset, error) {
 	return a, nil
 }
 
-var _libraryBuiltinOrderLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x8f\x41\x0e\x83\x20\x10\x45\xf7\x9e\xe2\x2f\x65\xd3\x03\xa8\xed\x5d\x98\x16\x0d\x89\x85\x86\x99\xfb\xa7\x11\xab\x11\x21\xc5\xcd\x18\xc9\x7b\x93\x79\x7d\x8f\xa7\x7f\x7f\x74\x30\xb0\x4e\xcc\x64\x02\x37\xed\xcb\x8c\x18\xd0\xea\xce\x3a\x01\x2d\x53\xa1\x23\xef\x67\xb4\xd6\xc9\x6d\x36\xcc\xd0\x20\xa5\x56\xf4\x51\x41\x09\x7a\x43\x87\x7b\x99\x75\x5e\xce\xc2\xb6\xfc\x92\x11\xaf\x51\x4d\x73\xc8\x61\x09\xd6\x4d\xc7\x1a\x96\x00\x5a\xe6\xbe\x84\x25\x94\x6b\xfe\xa0\x59\x4d\xce\xc6\xdb\x52\x21\xa9\xa9\x19\x85\x9a\x71\xf6\x5a\x8e\x31\xf1\x01\xb4\x7e\xf7\x3d\xf1\xaf\x9c\x54\x15\xb2\xb0\xb2\x11\x4f\x3d\x6b\x49\xde\x35\xef\x17\xf9\x0d\x00\x00\xff\xff\x92\x31\xbc\xbe\x81\x02\x00\x00")
+var _libraryBuiltinOrderLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x90\x41\x6e\x83\x30\x10\x45\xf7\x9c\xe2\x2b\x2b\xbc\xc9\x01\x48\xe8\xa6\x27\x19\xa7\x13\x62\x95\xda\xed\xcc\xf4\xfe\x55\x8d\xa8\x68\xb0\x84\x61\x03\xc2\x42\xef\x3f\xbf\xcb\x05\xb7\xf4\xf1\x49\xc2\x08\xd1\x78\x60\xd1\xa6\x7d\xe3\x3b\xae\x68\xa9\x0b\xd1\xe0\x7f\x9f\x0e\x9d\x4f\x69\xc4\xe9\xf5\xc1\xb7\x77\x85\x3d\xc8\x40\x08\x8a\x91\x35\x7f\x46\xf8\xf3\x09\x6d\x88\x76\xce\x47\x04\xef\xdc\x84\x7a\xa9\x44\x0d\xc2\x64\x2c\x25\x9a\x07\xcd\xb4\x6b\xbf\xdb\x2c\x09\xf8\xeb\x9b\x46\x58\x9a\x2c\x63\xb2\x67\xf8\xec\xda\x1f\x91\xdd\x18\xc8\x2d\x5c\xd3\x2c\x62\xab\x49\x88\xc3\xb2\xb5\x9a\xc0\x77\x6a\x52\x73\xa3\x3c\xa2\x26\xe5\xd6\x15\xa8\x75\xeb\x3f\xda\xaa\xf5\x2e\xb3\x72\x8a\xff\xf0\xd9\xb5\x3f\x22\xbb\x31\x50\x68\x7d\x1f\x13\xd9\x32\x75\x3e\x80\x9f\xde\x35\x97\xca\x3b\xf9\xef\x72\xf0\x4a\xe0\x3a\xfa\x82\xb9\xca\xbe\xdb\xb2\x5c\xe6\x79\x62\xf6\xee\x8f\x8a\x6f\xce\x10\xbc\x73\xae\xf9\x19\x00\x27\x3b\x67\xd1\x5b\x04\x00\x00")
 
 func libraryBuiltinOrderLispBytes() ([]byte, error) {
 	return bindataRead(
@@ -134,7 +135,27 @@ func libraryBuiltinOrderLisp() (*asset, error) {
 	return a, nil
 }
 
-var _libraryStdBuiltinLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd4\x56\x4d\x6e\xdc\x3c\x0c\x5d\xdb\xa7\xe0\x97\xcd\x48\xf8\x9a\x20\x69\x77\x63\x64\xd9\x53\x04\x41\xa1\xd8\x72\x2c\x54\x96\x0d\x89\x93\x62\x7a\xfa\x82\x94\x64\xcb\xf3\xd3\xb4\xdd\x14\xcd\x22\x90\xc4\x47\x99\x7c\x7c\xa4\xa6\x69\x20\xa0\x72\x9d\xf2\x1d\x58\x13\x66\xe8\x0f\xae\x45\x33\xb9\x50\xd7\x4d\x03\x56\x7d\x3f\x42\x6f\x2c\x6a\x5f\x8b\x4e\xf7\x69\x0d\x62\xf6\xba\xdb\x13\xf6\x49\x7d\x78\x99\x26\xfb\x0c\x36\xe0\xde\x9a\x80\x4f\xea\x59\x42\x5e\xd5\x15\x88\xa0\xb1\xae\x00\xd8\x95\x17\xc2\xaa\xf1\xa5\x53\x75\x55\x81\x30\x3d\x08\x3d\xce\x78\x84\x2f\x0f\x92\x4e\x00\x76\x22\x2d\xd8\x48\x1f\x02\x31\x68\xd5\x11\x82\x2c\x15\x08\xba\x7d\x3d\x04\x81\xca\xd8\xc2\x1c\xb4\xed\x8b\x43\xfa\xa3\x40\x5e\xb5\xe3\x20\x28\xd4\x35\x44\x59\x97\x99\xed\xfe\xd9\xd4\x76\x97\x73\x5b\xaa\x38\xaa\x39\x26\x3a\xaa\x19\x44\xef\x38\xc5\x25\xb5\xe4\x53\x26\x65\xa8\xe8\xbf\x95\x54\x8c\xbd\x77\x45\x52\xdb\x58\x73\x15\xe8\x6a\x8e\x34\x93\x3f\xaa\x79\xf7\x97\x83\xda\x6d\xa2\x6a\x1a\x40\xf5\x55\x43\x6f\x7c\x40\x70\xf0\xa6\xec\x41\x07\xe8\xfd\x34\x02\xc7\xc4\x61\x33\x44\xb8\xbd\x71\xf8\xbe\x48\x2e\x86\xde\x4d\x29\xcc\xa0\x11\x5a\xb7\x95\xc3\x72\x6e\xd3\x79\x11\x77\xa1\xa3\xc9\x83\x78\x24\xe7\x7b\x99\x79\x68\x6d\x12\x4c\xe4\x61\xab\xab\xd6\xca\xbc\xbf\x25\xb7\x45\x66\xe4\x75\x5e\xa7\x08\x75\x91\x99\x52\x5a\x0d\x94\x24\x44\xe5\x09\xde\xf1\x86\xbe\x2d\xe5\x16\x75\xcf\x06\xd5\xb6\x92\xff\x5d\xb8\x22\x1a\xe3\x35\xe2\x16\x8a\xe8\xe2\xfd\x6a\x9e\xb5\xeb\x08\x95\xb2\xe1\xb0\x64\x52\x3a\xbb\x69\xab\x47\xed\xb0\xa8\x16\x7c\x1b\x8c\xd5\xd0\x4e\xae\x33\x34\xdc\xc0\x04\x40\x7f\xd0\x6b\x15\x6f\x23\x62\x6d\xfe\x3f\x12\x21\x55\x62\x11\x22\x08\x37\xe1\x59\x97\xcb\x2b\x02\xbd\xd0\xf1\x57\x1a\x86\xf2\xec\xfc\x34\xbf\xa3\x4d\x86\x10\xe1\x65\x16\x60\x65\x69\x4d\xca\xdd\x20\x44\x34\x6d\xa9\x97\xa9\x27\xd8\xb6\xf0\xfb\x53\x56\x09\xfa\x2b\xac\x36\x64\xa6\x30\x6e\xf0\x38\x6b\x96\xc0\x23\xdc\x80\xc8\x3b\x26\xe1\x04\x94\x0b\x5f\x20\x4b\x31\xd4\xa9\x1c\xa7\xfc\x2f\x56\xa0\x65\xac\x60\x11\x66\x44\x2e\x5a\xdb\x8a\xca\xe1\x90\x13\x5f\x99\xbe\x23\xf3\xe7\x4c\x87\x3b\x8c\xda\xab\xcc\x44\x40\xe5\x51\x77\x11\xfc\x00\xe2\x3f\x79\x97\xe5\x4e\x77\x9d\x4c\x0d\x09\x7b\xe5\x8e\xb9\xcd\x37\x25\x48\x51\x5f\xf3\x8c\xf3\x46\x81\x70\x0a\xcd\x9b\xbe\x23\x48\x6a\xc6\xbd\xa2\x0c\xd2\xeb\x46\x5a\x01\x71\xee\x85\x03\x3c\x24\x9e\x19\x19\x34\x15\xf4\x0a\xf2\x63\x89\xc4\xc1\xf8\xee\xda\x9d\x9f\x4a\xb9\x7a\xdd\x1d\xda\xa4\x8b\xb8\x5e\x87\xfd\x4e\xf0\x2c\xa0\xf4\x13\x09\x3c\x19\x2e\x62\xf3\x97\x4e\x1c\x44\xc2\xd1\x90\x2f\x46\xc5\x32\xf3\x79\x4b\xb7\xca\xf2\x41\x6c\x27\xd7\xaa\xd4\x2c\x71\xcd\x35\x0d\x85\x32\xbd\xc6\x83\x77\x30\xb9\x65\xa8\x80\x42\xc0\x41\x03\x9a\x51\xa7\x91\x90\xc6\x41\x55\x8e\x83\x8a\x0d\x03\x88\xc8\x7b\x7e\xbf\xf9\x14\xc9\x8b\x39\x5e\x8e\xd7\x07\x6c\x88\xe3\xba\x7c\xd3\x90\x8f\xaa\x34\xc9\xab\xf4\x13\xa0\x98\x1a\x98\xdb\x14\xd3\x78\xa9\xb6\x53\x65\x58\xc6\x3d\xa3\x06\x19\x81\x97\xa6\x7c\xe2\x8b\x68\x58\x7a\x9f\x37\x2b\x75\xda\xbd\xe2\x10\x59\x8b\xeb\x55\x00\x12\x58\x99\x59\x89\xc9\x1c\x75\x90\xa4\x7f\xcd\x65\xc5\xc2\xfd\x39\x3a\x6b\xc4\xb8\xec\x50\xbe\x1e\xa7\x77\x9e\x40\xf3\xdd\xa5\x34\xfe\xe7\x07\x84\xdf\xd1\x1f\x01\x00\x00\xff\xff\x20\x86\xe0\x92\x02\x0b\x00\x00")
+var _libraryCliCliLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\xd2\x41\x8a\xc3\x30\x0c\x05\xd0\x7d\x4f\x21\xba\x8a\x37\x3d\x40\x7a\x8b\xb9\x81\xdb\x28\x41\x60\xcb\x45\x52\xee\x3f\x48\x66\x86\x40\x70\x21\x4b\xe9\xa3\xff\x42\xf0\xf3\x09\xef\x56\x6b\xe6\x05\x0a\x31\xc2\x27\x8b\x12\x6f\x30\xbd\x0b\x3d\x7c\x40\xf0\xcc\xa7\x0d\x0d\xb2\x20\xbc\x76\x2a\x46\x9c\x6e\xd3\x82\x6b\x24\xc4\x06\x53\xfb\x98\xce\x85\xd4\x80\x73\xc5\x59\x4d\x12\xcc\x9e\xdc\x7f\xd0\x76\x61\x8d\x6e\x5c\xfa\x72\x2d\x79\x83\x26\x90\x65\xdb\x2b\xb2\x3d\xee\x30\x2d\xad\xb3\x0e\x79\x5b\x14\xf5\x92\x74\xd0\xd6\xd2\xf2\xc8\xeb\xd9\x49\xec\xeb\x2b\x66\x5c\x1c\x55\x35\x19\x98\x9e\x9c\x44\x5f\x5e\xf1\xfc\xf3\x0f\xda\xab\xb5\x32\xe0\x22\x3a\x79\xb1\xbd\x02\xfa\xc1\x51\x14\xd4\xd1\x4f\x8d\xf9\x5f\x8c\xa9\xad\x20\x58\x33\xb1\xbf\x95\x3f\x4e\xbf\x79\x85\xd4\x52\xba\xfd\x0e\x00\xf6\xba\x9e\x17\x70\x02\x00\x00")
+
+func libraryCliCliLispBytes() ([]byte, error) {
+	return bindataRead(
+		_libraryCliCliLisp,
+		"library/cli/cli.lisp",
+	)
+}
+
+func libraryCliCliLisp() (*asset, error) {
+	bytes, err := libraryCliCliLispBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "library/cli/cli.lisp", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _libraryStdBuiltinLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xcc\x56\x4d\x6f\xe4\x36\x0c\x3d\xdb\xbf\x82\x9d\xcb\x48\x68\x13\x24\xed\x6d\x82\xbd\xb5\x45\x0f\x3d\xf5\xba\x58\x14\x8a\x4d\xc7\xc2\x6a\x24\x43\xe2\x6c\x30\xfd\xf5\x05\xf5\x61\xcb\xf3\x91\x2f\xa0\xc5\x5e\x12\x0f\x45\x3d\x3f\x3e\x3e\x51\x7e\x78\x80\x40\xca\xf6\xca\xf7\x60\x74\x98\x60\x38\xd8\x8e\xb4\xb3\xa1\x6d\x45\x8f\x03\x0c\xda\x10\x7a\x10\x93\xc7\x7e\xc7\x8b\x9f\xd5\x4f\x8f\xce\x99\x2f\x60\x02\xed\x8c\x0e\xf4\x59\x7d\x91\x50\x9e\xda\x06\x36\x7f\xaa\x7f\x8e\x0c\x46\xe0\x06\x40\x83\x7b\xb4\x14\xf8\xd9\x04\x82\xc1\x79\x78\x1e\x75\x37\x02\x23\x82\x0e\x40\xfe\x80\xb7\x9b\xb6\x01\x11\x90\xda\x06\x20\xbe\x33\x3e\x08\xa3\xf6\x8f\xbd\x6a\x9b\x06\x84\x1e\x40\xe0\x7e\xa2\x23\xfc\x7d\x2f\x39\x02\xb0\x15\xf9\x21\x2e\x46\x3c\x31\xa2\xea\x39\x83\x57\x1a\x10\x91\xc6\x1c\x04\x41\x4a\x9b\x6a\x39\xa0\x19\xaa\xa0\x94\x52\x32\x91\x27\xb4\x91\x04\xd7\xb8\xd4\x26\x57\x92\x6c\xdf\xa5\xc9\x1f\x2a\x8c\xea\xd1\x20\x98\xf7\x8b\xc3\xc2\x20\x3c\xa1\xdd\xca\xef\x4f\xa7\xed\x65\xa1\x92\x52\x7b\x35\x81\x18\x6c\xd4\x68\xd6\x26\xe7\x9d\x39\xc5\x63\x38\x98\xa4\xc5\x60\x41\x4d\x93\xd1\xd8\x03\xb9\x53\x95\xd6\x1a\x68\x42\xff\x3e\x0d\x98\x24\xb3\xaa\x34\x58\x97\x56\x1c\xc0\xd0\xfc\x42\x59\x1a\xbf\x57\xd3\xf6\xc5\x7a\x2e\x77\xf9\xad\x85\x5d\xed\xf3\x7f\x57\xe3\xf6\xbc\x48\x52\x5f\x11\x84\xdd\x69\x4b\xd7\xed\xbc\x6a\x1c\x8d\x08\x83\xf6\x81\xc0\x7e\xa0\x57\xbd\xcb\x9c\x03\x12\x74\x35\xe3\x3a\x6e\x72\xbc\x2a\x22\x2f\xb3\xa5\x9d\x07\xf1\x89\x37\xdf\xc9\x22\x4a\x67\xb2\x77\xb7\xe2\xdc\xe2\x9d\x91\xe5\xf7\x0d\x6f\x9b\x1d\xcf\xbb\xce\x3d\x90\x52\x2d\x17\x24\x17\x1d\x64\xdb\x3e\x40\x2d\x59\x5c\x67\xa0\xaf\x98\x92\x79\x40\x49\xb9\xce\xba\x8b\x0b\xaa\xeb\x64\xfc\x73\x01\x22\xc6\x33\x8c\xb8\x81\x8a\x5d\xc2\x57\xd3\x84\xb6\xe7\xac\x5c\x0d\x87\x99\x72\xd5\xc0\x9b\xe7\x51\x1b\xac\x26\xd4\xab\xa7\x8f\x9b\x68\x50\xf5\xda\x3e\xbd\x71\x2c\xbd\xd1\xa3\xce\x57\x3e\x05\x61\x1d\x9d\x8d\x20\x79\xc5\xbf\x25\xe1\xa2\x75\x57\xce\x4d\x95\xf7\xde\x4d\x51\xe1\xba\x52\xd8\xfc\xea\xdd\x14\xae\xba\x94\xe3\x9c\x77\xbb\x01\x23\x6b\x9c\x7c\x04\x3e\x88\x25\x12\xc8\xba\x7f\x72\x3e\x65\xbc\xfa\xa6\x26\x2d\x2f\xfc\x40\x77\x1e\x18\x9c\xab\xd8\xd0\x71\xc2\xd8\xcb\x4f\xb0\x01\x51\x7e\x49\x79\x9e\x54\x2c\x55\x65\xd6\x36\x6b\x73\x5b\x4f\xfb\x38\xaf\x02\x6f\x8e\xff\x45\x55\x64\xa4\xb6\xb8\x38\x0a\x51\xbc\x6f\x69\x3c\x1d\x38\x12\x76\xca\x1e\x33\xf4\x5a\xca\xfc\xa2\x6b\x3b\xd3\xa8\x52\xec\xef\xbf\x90\x0e\xde\x26\xf1\xf8\x1d\x59\xb8\x55\xa3\xe0\xb7\xa2\xa6\xf2\x08\xf6\xb0\x7f\x44\x66\x1a\x48\x79\x62\xb1\x07\xef\xf6\x70\x0f\xe2\x87\x3c\x92\xad\x22\xfd\x0d\x6f\x19\x2e\x9f\xf7\x9d\x9a\xfd\x97\x2c\x01\xe2\x84\xcb\x9a\x49\x4a\xba\xc4\x65\x03\x82\x71\xef\x73\x67\x22\x64\xc0\xce\xd9\xfe\x15\xc8\x9c\xf4\x02\xe6\xcf\x35\x26\x8d\xda\xf7\xaf\xd1\x4c\x49\x2f\x40\xfe\x92\x21\x73\xed\x1e\xfb\x43\x87\xcb\xed\xb8\x15\x71\xc0\x71\x1b\x19\xdc\x1e\xb9\x23\xbf\x3b\xd3\x67\x33\xeb\x40\x3b\xe8\x94\x31\x81\xf7\xcc\x2f\x8a\xb3\x8f\x1d\x8d\xdf\xd0\x1f\x97\xb0\xed\xc1\x57\xec\x8c\x0a\x94\xef\xd5\xd8\x17\xde\x76\x99\x47\x29\xf2\x7f\x24\x23\x32\x87\xc1\x56\x8e\xaf\x6e\x63\xd6\x8d\xe9\x54\x33\xbb\x73\xb6\x53\x14\xf5\x0d\x27\x03\x3a\x2d\x21\x1b\xcf\xd9\xba\x11\x21\x1f\xf1\xa4\x0b\x38\x8b\x0b\x43\x8a\xc4\x48\xef\x31\xcf\xe8\x3c\x9f\x9b\x7a\x3e\x37\xf1\x6a\x1d\x41\x24\x4b\x96\xaf\xbd\x18\x25\xde\x15\x5d\x35\x87\x97\x0f\x8e\x91\xc7\x74\x93\xef\xde\x14\xa2\x18\x6a\xf2\x65\xdb\xe4\x0f\xc6\x6a\x8c\x53\x19\x82\x94\xe7\x7d\xb3\x1e\xf3\xe3\x7c\x23\xc7\xac\x51\x02\x5d\xbb\x88\xb3\x8a\xac\xd5\x3c\x59\xe3\x8f\x4a\x50\x83\xf6\x89\xc6\xc5\xe3\x12\xe2\x34\x5f\x59\x3c\x9d\xf6\xd5\x77\xb8\xb6\xb3\xbc\xb7\x9b\xf9\xb4\x67\x30\xee\xdb\x7c\x61\x5f\x79\x81\x58\x72\xe1\xee\x3c\xbb\x9c\x0a\x6d\xcb\x86\xfa\x23\xe0\x14\xf3\x24\xb5\x60\xd7\xa6\xfa\x11\x54\xd7\xc1\xbd\x94\xb2\xfd\x77\x00\x31\xc0\x74\xbd\xcb\x0d\x00\x00")
 
 func libraryStdBuiltinLispBytes() ([]byte, error) {
 	return bindataRead(
@@ -154,7 +175,7 @@ func libraryStdBuiltinLisp() (*asset, error) {
 	return a, nil
 }
 
-var _libraryStdMathLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd2\x48\x49\x4d\x53\x28\xce\xcc\x53\xd0\xa8\xb0\x4a\xcb\xc9\x4f\x2c\xd1\x54\x80\xd0\x0a\x1a\xb9\x89\x25\x19\x7a\x20\xa9\x0a\x4d\x4d\x2e\xb0\xba\xe4\xfc\x62\x5c\xea\x40\x52\x20\x75\x80\x00\x00\x00\xff\xff\x92\xcc\x9b\x6a\x50\x00\x00\x00")
+var _libraryStdMathLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x7c\x00\x83\xff\x28\x64\x65\x66\x20\x73\x69\x6e\x20\x28\x78\x3a\x66\x6c\x6f\x61\x74\x29\x20\x3a\x66\x6c\x6f\x61\x74\x20\x22\x53\x69\x6e\x65\x20\x6f\x66\x20\x78\x20\x72\x61\x64\x69\x61\x6e\x73\x2e\x22\x20\x28\x6d\x61\x74\x68\x2e\x73\x69\x6e\x20\x78\x29\x29\x0a\x28\x64\x65\x66\x20\x63\x6f\x73\x20\x28\x78\x3a\x66\x6c\x6f\x61\x74\x29\x20\x3a\x66\x6c\x6f\x61\x74\x20\x22\x43\x6f\x73\x69\x6e\x65\x20\x6f\x66\x20\x78\x20\x72\x61\x64\x69\x61\x6e\x73\x2e\x22\x20\x28\x6d\x61\x74\x68\x2e\x63\x6f\x73\x20\x78\x29\x29\x0a\x03\x00\x28\x37\x6f\x1a\x7c\x00\x00\x00")
 
 func libraryStdMathLispBytes() ([]byte, error) {
 	return bindataRead(
@@ -174,7 +195,7 @@ func libraryStdMathLisp() (*asset, error) {
 	return a, nil
 }
 
-var _libraryStdNumericLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb2\x56\xd0\x56\x30\xe4\xd2\x48\x49\x4d\x53\xc8\xcc\x4b\x56\xd0\xc8\xb3\xca\xcc\x2b\xd1\x54\x00\x91\x0a\x1a\xda\x0a\x79\x0a\x86\x9a\x9a\x5c\x5c\xd6\x0a\xba\x30\x55\x29\xa9\xe8\xaa\x74\xa1\xaa\x00\x01\x00\x00\xff\xff\xc4\xc9\x6b\x92\x4b\x00\x00\x00")
+var _libraryStdNumericLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x61\x00\x9e\xff\x28\x64\x65\x66\x20\x69\x6e\x63\x20\x28\x6e\x3a\x69\x6e\x74\x29\x20\x3a\x69\x6e\x74\x20\x22\x52\x65\x74\x75\x72\x6e\x73\x20\x6e\x20\x2b\x20\x31\x2e\x22\x20\x28\x2b\x20\x6e\x20\x31\x29\x29\x0a\x0a\x28\x64\x65\x66\x20\x64\x65\x63\x20\x28\x6e\x3a\x69\x6e\x74\x29\x20\x3a\x69\x6e\x74\x20\x22\x52\x65\x74\x75\x72\x6e\x73\x20\x6e\x20\x2d\x20\x31\x2e\x22\x20\x28\x2d\x20\x6e\x20\x31\x29\x29\x0a\x03\x00\x42\x91\xb8\xdc\x61\x00\x00\x00")
 
 func libraryStdNumericLispBytes() ([]byte, error) {
 	return bindataRead(
@@ -194,7 +215,7 @@ func libraryStdNumericLisp() (*asset, error) {
 	return a, nil
 }
 
-var _libraryStdStringLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x91\xcb\x6e\xc3\x20\x10\x45\xd7\xe6\x2b\xae\xb2\x31\xb3\xc8\xa2\x5b\x47\xfd\x92\xb6\xaa\x28\xc6\x29\x12\x02\x64\xa6\xea\xe3\xeb\x2b\x26\x4e\x65\xa7\xce\x6b\x83\xb1\xe6\xe8\xcc\x5c\x66\xb7\x43\xc9\xc1\x33\x0a\x8f\x3e\xee\xe1\x23\x27\x7c\xa6\xb1\x2f\x4a\xf7\x6e\x40\x74\x5f\xbc\x9d\x6a\xba\xb8\xdc\x0d\x1f\xd1\x56\xb8\x2b\x3c\x12\xba\xe0\x0b\x43\xcf\xa9\xe2\x72\xad\x63\xb3\x21\xba\xe4\x68\x35\x55\x66\x52\xb4\xfa\x3a\x6d\xac\x5d\x74\x95\xd3\x58\x7b\xb5\xd5\x34\xee\x89\x40\x35\x15\x61\xf8\xb2\xad\x33\x6b\x39\xde\x9d\xe9\x2b\x4f\x84\xee\x2d\xa5\x40\x47\x8a\x03\x74\x9f\xa0\xd9\xf8\x80\x83\x44\xb0\x5a\xf7\xc3\x24\x51\x0d\x20\xbf\xfa\xf1\x38\x98\x6a\x9a\xff\xef\xc3\xa1\x96\x0f\xb5\xbf\x14\x1c\xc4\x86\x55\x5c\x7a\x9b\x9c\x5d\xec\x05\x5e\x0c\x2a\x1f\x22\xa5\xd4\xea\x3a\x83\xf9\xf9\x86\xb4\x49\xc3\x7c\xb7\x72\x85\x5e\x2e\xf3\xa9\xf0\xf8\x02\xe8\xbd\x8b\xc0\xf3\x72\x94\x6c\xac\xc3\xeb\x03\xe1\x04\xa7\x99\xaf\x5d\x17\x56\x5f\x7b\xbb\xef\x86\x20\xc1\x47\x37\x05\x91\xeb\x1d\x41\x5c\x0a\x17\x62\x88\xed\x8e\x18\x67\x6d\xbf\x01\x00\x00\xff\xff\xad\x4e\xe2\x32\x5c\x03\x00\x00")
+var _libraryStdStringLisp = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x91\xcd\x4e\xc3\x30\x10\x84\xcf\xf1\x53\x8c\x72\x89\x7d\x28\x12\xd7\x54\x3c\x05\x47\x40\xc8\x4d\x36\xad\x25\xcb\x8e\x62\x23\x7e\x9e\x1e\xed\xd6\xad\x48\x69\x1b\x40\x9c\x7c\xd8\xd9\x99\xcf\xb3\xeb\x35\xd2\xe8\x5d\x46\xca\x93\x0b\x5b\xb8\x90\x23\x5e\xe3\xd4\x27\xa5\x7b\x1a\x10\xe8\x2d\xaf\xca\x4c\x27\x1a\xdb\xe1\x25\x74\x2c\x6e\x53\x9e\x0c\x5a\xef\x52\x86\xfe\xaa\x4a\x34\xf2\x1c\x75\x6d\xcc\x35\x8f\x46\x1b\xd6\x14\x8b\x46\x2f\xab\x6d\xd7\xcd\x52\x65\xd1\x76\xdd\x62\x54\xc1\x3d\x31\x50\x15\x4b\x32\x5c\x5a\x31\x33\x67\x41\xef\xc8\xf6\x8c\x6f\x0c\xda\x4d\x8c\xde\x1c\x54\xd9\x43\xf7\x11\x3a\x5b\xe7\x45\x00\xb1\x92\xb9\x1b\x8a\x89\xaa\x00\x68\x37\x40\xdf\x1d\xc0\x54\x55\x7d\xef\x27\x7b\x1e\xef\x67\xc7\x5f\x64\x2f\x6e\x38\x2b\x97\x6c\x3b\x8e\x14\x7a\x11\xcf\x40\xe5\x31\x46\xa9\x7d\x83\x72\x3e\xe8\xf9\x91\x1e\x52\x9e\x9e\x54\x85\xfa\x9e\xcf\x9d\x66\xf7\xf6\xf6\xe3\x1d\x2c\x42\x2c\xdb\x37\x35\xff\x6b\x4b\x01\x8f\x73\x9a\xd1\x76\x84\xe7\x5b\x83\x13\xe7\xd2\xbf\x2c\x37\xbf\xc9\xde\xd9\xb4\xb3\x1b\x4f\x67\x20\xb8\x78\xc2\x96\x42\x63\x8e\x3c\xcd\xcf\x81\xf6\x44\xde\x05\xfa\x7b\x19\xb2\x7d\xa9\x0c\x8a\xfe\x4a\x15\xb2\xfa\x0f\x55\x1c\x3e\xb0\x58\xc5\x45\x9c\xcf\x01\x00\x70\x1b\x35\x10\xe4\x03\x00\x00")
 
 func libraryStdStringLispBytes() ([]byte, error) {
 	return bindataRead(
@@ -269,6 +290,7 @@ var _bindata = map[string]func() (*asset, error){
 	"library/builtin/list.lisp": libraryBuiltinListLisp,
 	"library/builtin/numbers.lisp": libraryBuiltinNumbersLisp,
 	"library/builtin/order.lisp": libraryBuiltinOrderLisp,
+	"library/cli/cli.lisp": libraryCliCliLisp,
 	"library/std/builtin.lisp": libraryStdBuiltinLisp,
 	"library/std/math.lisp": libraryStdMathLisp,
 	"library/std/numeric.lisp": libraryStdNumericLisp,
@@ -321,6 +343,9 @@ var _bintree = &bintree{nil, map[string]*bintree{
 			"numbers.lisp": &bintree{libraryBuiltinNumbersLisp, map[string]*bintree{}},
 			"order.lisp": &bintree{libraryBuiltinOrderLisp, map[string]*bintree{}},
 		}},
+		"cli": &bintree{nil, map[string]*bintree{
+			"cli.lisp": &bintree{libraryCliCliLisp, map[string]*bintree{}},
+		}},
 		"std": &bintree{nil, map[string]*bintree{
 			"builtin.lisp": &bintree{libraryStdBuiltinLisp, map[string]*bintree{}},
 			"math.lisp": &bintree{libraryStdMathLisp, map[string]*bintree{}},
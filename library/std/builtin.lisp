@@ -1,7 +1,7 @@
 ;; standard lisp functions
 
-;; lazy filter
 (def filter (pred:func[a,bool] lst:list[a]) :list[a]
+	 "Lazy list of elements of lst for which pred is true."
 	 (set
 	   filt
 	   (lambda
@@ -13,6 +13,7 @@
 	 (gen filt lst) :list[a])
 
 (def filter' (pred:func[a,bool] lst:list[a]) :list[a]
+	 "Hashable lazy list of elements of lst for which pred is true (see gen')."
 	 (set
 	   filt
 	   (lambda
@@ -24,8 +25,8 @@
 	 (gen' filt lst) :list[a])
 
 
-;; lazy map
 (def map (fn:func lst:list) :list
+	 "Lazy list of results of fn applied to elements of lst."
 	 (set
 	   iter
 	   (lambda
@@ -35,6 +36,7 @@
 	 (gen iter lst))
 
 (def map' (fn:func lst:list) :list
+	 "Hashable lazy list of results of fn applied to elements of lst (see gen')."
 	 (set
 	   iter
 	   (lambda
@@ -43,8 +45,8 @@
 		   (list (fn (head _1)) (tail _1)))))
 	 (gen' iter lst))
 
-;; take first n values from list
 (def take (n:int lst:list[a]) :list[a]
+	 "Lazy list of the first n elements of lst."
 	 (set
 	   iter
 	   (lambda
@@ -61,8 +63,8 @@
 ; (def take (n lst acc) (take (- n 1) (tail lst) (append acc (head lst))))
 
 
-;; take elements from list while condition is true
 (def take-while (pred:func lst:list) :list
+	 "Lazy list of the leading elements of lst for which pred is true."
 	 (set
 	   iter
 	   (lambda
@@ -72,12 +74,11 @@
 	 (gen iter lst))
 
 
-;; drop first n values from list
-(def drop (0 l:list) :list l)
-(def drop (n:int l:list) :list (drop (- n 1) (tail l)))
+(def drop (0 l:list) :list "Drops the first n elements of the list." l)
+(def drop (n:int l:list) :list "Drops the first n elements of the list." (drop (- n 1) (tail l)))
 
-;; drop elements while condition is true
 (def drop-while (pred:func lst:list) :list
+	 "Drops the leading elements of lst for which pred is true."
 	 ; (print "type lst = " (type lst))
 	 ; (print "type head lst = " (type (head lst)))
 	 (if (not (pred (head lst)))
@@ -85,24 +86,27 @@
 	   (drop-while pred (tail lst))))
 
 
-;; take nth element from list.
-;; Elements numeration is started from 1 (!).
 ; (def nth (n:int lst:list) :any (head (drop (- n 1) lst)))
-(def nth (n:int lst:list[a]) :a (native.nth n lst) :a)
+(def nth (n:int lst:list[a]) :a
+	 "Returns the nth element of the list. Elements are numbered starting from 1 (!)."
+	 (native.nth n lst) :a)
 
 
-(def first  (lst:list[a]) :a (nth 1 lst))
-(def second (lst:list[a]) :a (nth 2 lst))
-(def third  (lst:list[a]) :a (nth 3 lst))
+(def first  (lst:list[a]) :a "Returns the first element of the list." (nth 1 lst))
+(def second (lst:list[a]) :a "Returns the second element of the list." (nth 2 lst))
+(def third  (lst:list[a]) :a "Returns the third element of the list." (nth 3 lst))
 
 
-;; reduce
-(def reduce (fn:func '() acc:any) :any acc)
-(def reduce (fn:func lst:list acc:any) :any (reduce fn (tail lst) (fn (head lst) acc)))
+(def reduce (fn:func '() acc:any) :any
+	 "Folds the list: calls (fn element acc) for every element and returns the last result."
+	 acc)
+(def reduce (fn:func lst:list acc:any) :any
+	 "Folds the list: calls (fn element acc) for every element and returns the last result."
+	 (reduce fn (tail lst) (fn (head lst) acc)))
 
 
-;; lazy concat
 (def concat lists :list
+	 "Lazy concatenation of the lists."
 	 ; return one element at the time
 	 (set iter
 		  (lambda
@@ -116,8 +120,7 @@
 	 (gen iter (list (head lists) (tail lists))))
 
 
-;; length
-(def length (lst:list) :int (native.length lst))
+(def length (lst:list) :int "Returns the number of elements in the list." (native.length lst))
 ; (def length (lst:list) :int (length lst 0))
 ; (def length ('() acc:int) :int acc)
 ; (def length (lst:list acc:int) :int (length (tail lst) (+ acc 1)))
@@ -1,2 +1,2 @@
-(def sin (x:float) :float (math.sin x))
-(def cos (x:float) :float (math.cos x))
+(def sin (x:float) :float "Sine of x radians." (math.sin x))
+(def cos (x:float) :float "Cosine of x radians." (math.cos x))
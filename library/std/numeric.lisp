@@ -1,5 +1,3 @@
-; + 1
-(def inc (n:int) :int (+ n 1))
+(def inc (n:int) :int "Returns n + 1." (+ n 1))
 
-; - 1
-(def dec (n:int) :int (- n 1))
+(def dec (n:int) :int "Returns n - 1." (- n 1))
@@ -12,10 +12,16 @@
 	   (next-string sep tl (do (append acc (head str)) :str))))
 
 
-;; split string into lazy list of words
-(def words (str:str) :list[str]  (gen  \(next-string space _1) str) :list[str])
-(def words' (str:str) :list[str] (gen' \(next-string space _1) str) :list[str])
+(def words (str:str) :list[str]
+	 "Splits string into lazy list of words."
+	 (gen \(next-string space _1) str) :list[str])
+(def words' (str:str) :list[str]
+	 "Splits string into hashable lazy list of words (see gen')."
+	 (gen' \(next-string space _1) str) :list[str])
 
-;; split string into lazy list of lines
-(def lines (str:str) :list[str]  (gen  \(next-string eol _1) str) :list[str])
-(def lines' (str:str) :list[str] (gen' \(next-string eol _1) str) :list[str])
+(def lines (str:str) :list[str]
+	 "Splits string into lazy list of lines."
+	 (gen \(next-string eol _1) str) :list[str])
+(def lines' (str:str) :list[str]
+	 "Splits string into hashable lazy list of lines (see gen')."
+	 (gen' \(next-string eol _1) str) :list[str])
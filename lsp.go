@@ -0,0 +1,671 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// "spil lsp" serves Language Server Protocol (https://microsoft.github.io/language-server-protocol/) on stdin/stdout.
+//
+// Documents are parsed and type checked when they are opened or saved, errors are published as diagnostics.
+// Hover, go-to-definition and completion use the last successfully parsed version of the document.
+
+func lspCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "Usage: spil lsp\n")
+		return 2
+	}
+	if err := newLspServer(os.Stdin, os.Stdout).serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type lspMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *lspError       `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspSymbol struct {
+	Name           string   `json:"name"`
+	Detail         string   `json:"detail,omitempty"`
+	Kind           int      `json:"kind"`
+	Range          lspRange `json:"range"`
+	SelectionRange lspRange `json:"selectionRange"`
+}
+
+type lspCompletion struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Kinds of symbols and completion items.
+const (
+	lspSymbolClass      = 5
+	lspSymbolFunction   = 12
+	lspCompleteFunction = 3
+	lspCompleteClass    = 7
+	lspCompleteKeyword  = 14
+)
+
+// Special forms and top-level statements.
+var lspKeywords = []string{
+	"and", "apply", "contract", "def", "def'", "deftest", "deftype", "do",
+	"gen", "gen'", "if", "lambda", "or", "set", "set'", "use",
+}
+
+var errLspMethod = errors.New("method not found")
+
+type lspDocument struct {
+	path string
+	text string
+	// last successfully parsed program
+	in *Interpret
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspPositionParams struct {
+	TextDocument lspTextDocument `json:"textDocument"`
+	Position     lspPosition     `json:"position"`
+}
+
+type lspServer struct {
+	r    *bufio.Reader
+	w    io.Writer
+	docs map[string]*lspDocument
+}
+
+func newLspServer(r io.Reader, w io.Writer) *lspServer {
+	return &lspServer{
+		r:    bufio.NewReader(r),
+		w:    w,
+		docs: make(map[string]*lspDocument),
+	}
+}
+
+func (s *lspServer) send(m *lspMessage) {
+	m.JSONRPC = "2.0"
+	data, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	writeMessage(s.w, data)
+}
+
+func (s *lspServer) respond(req *lspMessage, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		panic(err)
+	}
+	s.send(&lspMessage{ID: req.ID, Result: data})
+}
+
+func (s *lspServer) notify(method string, params interface{}) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	s.send(&lspMessage{Method: method, Params: data})
+}
+
+func (s *lspServer) serve() error {
+	for {
+		data, err := readMessage(s.r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		req := &lspMessage{}
+		if err := json.Unmarshal(data, req); err != nil {
+			return fmt.Errorf("lsp: incorrect message: %v", err)
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, err := s.handle(req)
+		if req.ID == nil {
+			// notification
+			continue
+		}
+		if err != nil {
+			code := -32603 // internal error
+			if errors.Is(err, errLspMethod) {
+				code = -32601
+			}
+			s.send(&lspMessage{ID: req.ID, Error: &lspError{Code: code, Message: err.Error()}})
+		} else {
+			s.respond(req, result)
+		}
+	}
+}
+
+func (s *lspServer) handle(req *lspMessage) (result interface{}, err error) {
+	var params struct {
+		lspPositionParams
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+		Text *string `json:"text"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+	}
+	uri := params.TextDocument.URI
+	doc := s.docs[uri]
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					// full text of the document is sent on change
+					"change": 1,
+					"save":   map[string]interface{}{"includeText": true},
+				},
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"completionProvider":     map[string]interface{}{},
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]interface{}{"name": "spil", "version": version},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		path, err := uriPath(uri)
+		if err != nil {
+			return nil, err
+		}
+		doc = &lspDocument{path: path, text: params.TextDocument.Text}
+		s.docs[uri] = doc
+		s.analyze(uri, doc)
+	case "textDocument/didChange":
+		if doc != nil && len(params.ContentChanges) > 0 {
+			doc.text = params.ContentChanges[len(params.ContentChanges)-1].Text
+		}
+	case "textDocument/didSave":
+		if doc != nil {
+			if params.Text != nil {
+				doc.text = *params.Text
+			}
+			s.analyze(uri, doc)
+		}
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": []lspDiagnostic{}})
+	case "textDocument/hover":
+		if doc == nil || doc.in == nil {
+			return nil, nil
+		}
+		text := doc.hover(params.Position)
+		if text == "" {
+			return nil, nil
+		}
+		return map[string]interface{}{"contents": map[string]interface{}{"kind": "markdown", "value": text}}, nil
+	case "textDocument/definition":
+		if doc == nil || doc.in == nil {
+			return nil, nil
+		}
+		return doc.definition(params.Position), nil
+	case "textDocument/completion":
+		return doc.completion(), nil
+	case "textDocument/documentSymbol":
+		if doc == nil {
+			return []lspSymbol{}, nil
+		}
+		return doc.symbols(), nil
+	default:
+		if req.ID != nil {
+			return nil, fmt.Errorf("%w: %v", errLspMethod, req.Method)
+		}
+	}
+	return nil, nil
+}
+
+func uriPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported URI: %v", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+func pathURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// analyze parses and checks the document and publishes diagnostics.
+func (s *lspServer) analyze(uri string, doc *lspDocument) {
+	in := NewInterpreter(ioutil.Discard)
+	in.IncludeDirs = searchDirs(pluginDir)
+	var errs, warnings []error
+	err := lspSafely(func() error {
+		return in.Parse(doc.path, strings.NewReader(doc.text))
+	})
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		doc.in = in
+		err := lspSafely(func() error {
+			errs, warnings = in.Check()
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	diags := []lspDiagnostic{}
+	for _, err := range errs {
+		diags = append(diags, doc.diagnostic(err, 1))
+	}
+	for _, w := range warnings {
+		diags = append(diags, doc.diagnostic(w, 2))
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": diags})
+}
+
+// diagnostic converts error into diagnostic with severity 1 (error) or 2 (warning).
+func (doc *lspDocument) diagnostic(err error, severity int) lspDiagnostic {
+	msg, line := err.Error(), 0
+	var pe *posError
+	if errors.As(err, &pe) {
+		if pe.File == doc.path {
+			line = pe.Line
+		} else {
+			msg = fmt.Sprintf("%v:%d: %v", displayName(pe.File), pe.Line, msg)
+		}
+	}
+	return lspDiagnostic{Range: doc.lineRange(line), Severity: severity, Source: "spil", Message: msg}
+}
+
+// lspSafely turns panics of the interpreter into errors.
+func lspSafely(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return f()
+}
+
+// lineRange returns range of the line (1-based, 0 means the first line).
+func (d *lspDocument) lineRange(line int) lspRange {
+	if line > 0 {
+		line--
+	}
+	lines := strings.Split(d.text, "\n")
+	end := 0
+	if line < len(lines) {
+		end = len([]rune(strings.TrimRight(lines[line], "\r")))
+	}
+	return lspRange{Start: lspPosition{Line: line}, End: lspPosition{Line: line, Character: end}}
+}
+
+// wordAt returns identifier at the position.
+func (d *lspDocument) wordAt(pos lspPosition) string {
+	lines := strings.Split(d.text, "\n")
+	if pos.Line >= len(lines) {
+		return ""
+	}
+	line := []rune(lines[pos.Line])
+	isDelim := func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+	}
+	start, end := pos.Character, pos.Character
+	if start > len(line) {
+		return ""
+	}
+	for start > 0 && !isDelim(line[start-1]) {
+		start--
+	}
+	for end < len(line) && !isDelim(line[end]) {
+		end++
+	}
+	word := strings.TrimLeft(string(line[start:end]), `'\`)
+	if i := strings.Index(word, ":"); i > 0 {
+		// typed parameter: n:int
+		word = word[:i]
+	}
+	return word
+}
+
+// lspClause is a function clause or a statement of the main function containing the position.
+type lspClause struct {
+	fname string
+	impl  *FuncImpl
+	body  []types.Value
+	vars  map[string]types.Type
+	// line where variable is defined
+	defs map[string]int
+}
+
+func (d *lspDocument) funcs() []*FuncInterpret {
+	in := d.in
+	fis := []*FuncInterpret{in.main}
+	for _, fn := range in.funcs {
+		if fi, ok := fn.(*FuncInterpret); ok {
+			fis = append(fis, fi)
+		}
+	}
+	return append(fis, in.tests...)
+}
+
+// clauseAt finds top-level form containing the line (1-based).
+// Forms are ordered by their first lines, so the form ends where the next one starts.
+func (d *lspDocument) clauseAt(line int) *lspClause {
+	var found *lspClause
+	start := 0
+	consider := func(l int, c *lspClause) {
+		if l > start && l <= line {
+			start, found = l, c
+		}
+	}
+	for _, fi := range d.funcs() {
+		for _, impl := range fi.bodies {
+			if impl.file != d.path {
+				continue
+			}
+			if fi != d.in.main {
+				consider(impl.line, &lspClause{fname: fi.name, impl: impl, body: impl.body})
+				continue
+			}
+			for _, st := range impl.body {
+				if se, ok := st.E.(*types.Sexpr); ok {
+					consider(se.Line, &lspClause{fname: fi.name, impl: impl, body: impl.body})
+				}
+			}
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	found.vars = make(map[string]types.Type)
+	found.defs = make(map[string]int)
+	if found.impl.argfmt != nil && found.fname != "__main__" {
+		for name, t := range found.impl.argfmt.Values() {
+			found.vars[name] = t
+			found.defs[name] = found.impl.line
+		}
+	}
+	d.collectVars(found, found.body)
+	return found
+}
+
+// collectVars finds types of variables defined with set.
+func (d *lspDocument) collectVars(c *lspClause, body []types.Value) {
+	for _, st := range body {
+		se, ok := st.E.(*types.Sexpr)
+		if !ok || se.Quoted || se.Empty() {
+			continue
+		}
+		head, _ := se.List[0].E.(types.Ident)
+		if (head == "set" || head == "set'") && len(se.List) >= 3 {
+			name, ok := se.List[1].E.(types.Ident)
+			if !ok {
+				continue
+			}
+			t := types.TypeUnknown
+			if len(se.List) > 3 {
+				if id, ok := se.List[3].E.(types.Ident); ok {
+					t, _ = types.ParseType(string(id))
+				}
+			} else {
+				lspSafely(func() error {
+					t, _ = d.in.exprType(c.fname, se.List[2], c.vars)
+					return nil
+				})
+			}
+			c.vars[string(name)] = t
+			c.defs[string(name)] = se.Line
+		} else if head == "do" {
+			d.collectVars(c, se.List[1:])
+		}
+	}
+}
+
+// findCall finds s-expression on the line with the specified head.
+func findCall(body []types.Value, line int, head string) *types.Sexpr {
+	for _, st := range body {
+		se, ok := st.E.(*types.Sexpr)
+		if !ok || se.Quoted || se.Empty() {
+			continue
+		}
+		if h, ok := se.List[0].E.(types.Ident); ok && se.Line == line && string(h) == head {
+			return se
+		}
+		if res := findCall(se.List, line, head); res != nil {
+			return res
+		}
+	}
+	return nil
+}
+
+func (d *lspDocument) hover(pos lspPosition) string {
+	word := d.wordAt(pos)
+	if word == "" {
+		return ""
+	}
+	var sections []string
+	if c := d.clauseAt(pos.Line + 1); c != nil {
+		if t, ok := c.vars[word]; ok {
+			sections = append(sections, fmt.Sprintf("```spil\n%v %v\n```", word, t))
+		} else if se := findCall(c.body, pos.Line+1, word); se != nil && !isSpecialForm(word) {
+			var t types.Type
+			err := lspSafely(func() (err error) {
+				t, err = d.in.exprType(c.fname, types.Value{E: se, T: types.TypeUnknown}, c.vars)
+				return err
+			})
+			if err == nil && t != types.TypeUnknown {
+				sections = append(sections, fmt.Sprintf("Expression type: `%v`", t))
+			}
+		}
+	}
+	if sig := d.signature(d.in.globalName(d.path, word)); sig != "" {
+		sections = append(sections, sig)
+	}
+	if t, ok := types.ParseType(word); ok {
+		if e, ok := d.in.typeDoc(t); ok {
+			sections = append(sections, markdownEntry(e))
+		}
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+func isSpecialForm(word string) bool {
+	for _, k := range lspKeywords {
+		if k == word {
+			return true
+		}
+	}
+	return false
+}
+
+// signature describes all clauses of the function and its docs.
+func (d *lspDocument) signature(name string) string {
+	e, ok := d.in.funcDoc(name)
+	if !ok {
+		return ""
+	}
+	return markdownEntry(e)
+}
+
+func markdownEntry(e *docEntry) string {
+	return strings.Join(append([]string{fmt.Sprintf("```spil\n%v\n```", strings.Join(e.Signature, "\n"))}, e.Docs...), "\n\n")
+}
+
+func (d *lspDocument) definition(pos lspPosition) []lspLocation {
+	word := d.wordAt(pos)
+	res := []lspLocation{}
+	if c := d.clauseAt(pos.Line + 1); c != nil {
+		if line, ok := c.defs[word]; ok {
+			return append(res, lspLocation{URI: pathURI(d.path), Range: d.lineRange(line)})
+		}
+	}
+	word = d.in.globalName(d.path, word)
+	fi, ok := d.in.funcs[word].(*FuncInterpret)
+	if !ok || strings.HasPrefix(word, "__") {
+		return res
+	}
+	file := d.in.funcsOrigins[word]
+	if file == "" || strings.HasPrefix(file, "library/") {
+		// builtin library is embedded into the executable
+		return res
+	}
+	for _, impl := range fi.bodies {
+		l := lspPosition{Line: impl.line - 1}
+		res = append(res, lspLocation{URI: pathURI(impl.file), Range: lspRange{Start: l, End: l}})
+	}
+	return res
+}
+
+func (d *lspDocument) completion() []lspCompletion {
+	res := []lspCompletion{}
+	for _, k := range lspKeywords {
+		res = append(res, lspCompletion{Label: k, Kind: lspCompleteKeyword})
+	}
+	if d == nil || d.in == nil {
+		return res
+	}
+	var names []string
+	for name := range d.in.funcs {
+		if !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	if ns, ok := d.in.namespaces[d.path]; ok {
+		// functions imported without qualifier
+		for name := range ns.names {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		detail := ""
+		if fi, ok := d.in.funcs[d.in.globalName(d.path, name)].(*FuncInterpret); ok {
+			detail = name + " " + argfmtString(fi.bodies[0].argfmt)
+		}
+		res = append(res, lspCompletion{Label: name, Kind: lspCompleteFunction, Detail: detail})
+	}
+	var tps []string
+	for t := range d.in.types {
+		tps = append(tps, t.String())
+	}
+	sort.Strings(tps)
+	for _, t := range tps {
+		res = append(res, lspCompletion{Label: t, Kind: lspCompleteClass})
+	}
+	return res
+}
+
+// symbols returns functions and types defined in the document.
+// The document is parsed again, so symbols are available even if it is not correct.
+func (d *lspDocument) symbols() []lspSymbol {
+	res := []lspSymbol{}
+	p := NewParser(strings.NewReader(d.text), defaultNumberParser{})
+	for {
+		v, err := p.NextExpr(false)
+		if err != nil {
+			break
+		}
+		se, ok := v.E.(*types.Sexpr)
+		if !ok || se.Length() < 2 {
+			continue
+		}
+		head, _ := se.List[0].E.(types.Ident)
+		name, ok := se.List[1].E.(types.Ident)
+		if !ok {
+			continue
+		}
+		r := d.lineRange(se.Line)
+		switch head {
+		case "def", "def'", "func", "func'":
+			detail := ""
+			if se.Length() > 2 {
+				detail = sourceString(se.List[2])
+			}
+			res = append(res, lspSymbol{Name: string(name), Detail: detail, Kind: lspSymbolFunction, Range: r, SelectionRange: r})
+		case "deftype":
+			res = append(res, lspSymbol{Name: string(name), Kind: lspSymbolClass, Range: r, SelectionRange: r})
+		}
+	}
+	return res
+}
+
+// sourceString returns value as it is written in the source code.
+func sourceString(v types.Value) string {
+	switch a := v.E.(type) {
+	case types.Ident:
+		return string(a)
+	case *types.Sexpr:
+		items := make([]string, 0, len(a.List))
+		for _, item := range a.List {
+			items = append(items, sourceString(item))
+		}
+		open := "("
+		if a.Quoted {
+			open = "'("
+		} else if a.Lambda {
+			open = `\(`
+		}
+		return open + strings.Join(items, " ") + ")"
+	}
+	b := &strings.Builder{}
+	printLiteral(b, v.E)
+	return b.String()
+}
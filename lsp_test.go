@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type lspClient struct {
+	t  *testing.T
+	w  io.Writer
+	r  *bufio.Reader
+	id int
+}
+
+func (c *lspClient) send(method string, params interface{}, withID bool) {
+	m := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if withID {
+		c.id++
+		m["id"] = c.id
+	}
+	data, _ := json.Marshal(m)
+	writeMessage(c.w, data)
+}
+
+// call sends request and decodes its result into res.
+func (c *lspClient) call(method string, params interface{}, res interface{}) {
+	c.send(method, params, true)
+	for {
+		m := c.read()
+		if string(m.ID) != fmt.Sprint(c.id) {
+			continue
+		}
+		if m.Error != nil {
+			c.t.Fatalf("%v failed: %v", method, m.Error.Message)
+		}
+		if err := json.Unmarshal(m.Result, res); err != nil {
+			c.t.Fatalf("Cannot decode result of %v: %v", method, err)
+		}
+		return
+	}
+}
+
+func (c *lspClient) read() *lspMessage {
+	data, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("Cannot read message: %v", err)
+	}
+	m := &lspMessage{}
+	if err := json.Unmarshal(data, m); err != nil {
+		c.t.Fatalf("Incorrect message: %v", err)
+	}
+	return m
+}
+
+func (c *lspClient) diagnostics() []lspDiagnostic {
+	for {
+		m := c.read()
+		if m.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params struct {
+			Diagnostics []lspDiagnostic `json:"diagnostics"`
+		}
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			c.t.Fatalf("Incorrect diagnostics: %v", err)
+		}
+		return params.Diagnostics
+	}
+}
+
+func TestLsp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spil-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	module := `(def double (x:int) :int
+	(* x 2))
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "mod.lisp"), []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "prog.lisp")
+	uri := pathURI(file)
+	code := `(use "mod.lisp")
+(deftype :age :int)
+(def inc (n:int) :int
+	(set m (double n))
+	(+ m 1))
+(print (inc 2))
+`
+
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- newLspServer(reqR, respW).serve()
+		respW.Close()
+	}()
+	c := &lspClient{t: t, w: reqW, r: bufio.NewReader(respR)}
+	var init map[string]interface{}
+	c.call("initialize", map[string]interface{}{}, &init)
+	if _, ok := init["capabilities"]; !ok {
+		t.Errorf("No capabilities in initialize result: %v", init)
+	}
+
+	// document with an error
+	bad := strings.Replace(code, "(+ m 1)", `(+ m "one")`, 1)
+	c.send("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri, "text": bad}}, false)
+	diags := c.diagnostics()
+	if len(diags) != 1 || diags[0].Range.Start.Line != 4 || diags[0].Severity != 1 {
+		t.Errorf("Incorrect diagnostics: %+v", diags)
+	}
+	// document with a warning
+	warn := strings.Replace(code, "(+ m 1)", "(undefined m)", 1)
+	c.send("textDocument/didSave", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}, "text": warn}, false)
+	diags = c.diagnostics()
+	if last := len(diags) - 1; last < 0 || diags[last].Range.Start.Line != 4 || diags[last].Severity != 2 {
+		t.Errorf("Warning not found in diagnostics: %+v", diags)
+	}
+	c.send("textDocument/didSave", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}, "text": code}, false)
+	if diags := c.diagnostics(); len(diags) != 0 {
+		t.Errorf("Unexpected diagnostics: %+v", diags)
+	}
+
+	hoverTests := []struct {
+		line, char int
+		exp        string
+	}{
+		// variable
+		{4, 4, "m :int"},
+		// parameter
+		{3, 17, "n :int"},
+		// function call
+		{3, 10, "(def double (x:int) :int)"},
+		{5, 8, "Expression type: `:int`"},
+		// type
+		{1, 10, "(deftype :age :int)"},
+	}
+	for _, test := range hoverTests {
+		var hover struct {
+			Contents struct {
+				Value string `json:"value"`
+			} `json:"contents"`
+		}
+		c.call("textDocument/hover", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+			"position":     map[string]interface{}{"line": test.line, "character": test.char},
+		}, &hover)
+		if !strings.Contains(hover.Contents.Value, test.exp) {
+			t.Errorf("Hover at %d:%d: expected %q, found %q", test.line, test.char, test.exp, hover.Contents.Value)
+		}
+	}
+
+	var locs []lspLocation
+	c.call("textDocument/definition", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": 3, "character": 10},
+	}, &locs)
+	if len(locs) != 1 || locs[0].URI != pathURI(filepath.Join(dir, "mod.lisp")) || locs[0].Range.Start.Line != 0 {
+		t.Errorf("Incorrect definition of double: %+v", locs)
+	}
+	c.call("textDocument/definition", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": 4, "character": 4},
+	}, &locs)
+	if len(locs) != 1 || locs[0].URI != uri || locs[0].Range.Start.Line != 3 {
+		t.Errorf("Incorrect definition of m: %+v", locs)
+	}
+
+	var items []lspCompletion
+	c.call("textDocument/completion", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": 5, "character": 1},
+	}, &items)
+	found := make(map[string]int)
+	for _, item := range items {
+		found[item.Label] = item.Kind
+	}
+	for label, kind := range map[string]int{"inc": lspCompleteFunction, "double": lspCompleteFunction, "print": lspCompleteFunction, ":age": lspCompleteClass, "def": lspCompleteKeyword} {
+		if found[label] != kind {
+			t.Errorf("Completion %q of kind %d not found", label, kind)
+		}
+	}
+
+	var symbols []lspSymbol
+	c.call("textDocument/documentSymbol", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}}, &symbols)
+	var act []string
+	for _, s := range symbols {
+		act = append(act, fmt.Sprintf("%v %v %d %v", s.Kind, s.Name, s.Range.Start.Line, s.Detail))
+	}
+	exp := []string{"5 :age 1 ", "12 inc 2 (n:int)"}
+	if strings.Join(act, "|") != strings.Join(exp, "|") {
+		t.Errorf("Incorrect symbols:\nexpected %q,\n  actual %q", exp, act)
+	}
+
+	var res interface{}
+	c.call("shutdown", nil, &res)
+	c.send("exit", nil, false)
+	if err := <-done; err != nil {
+		t.Errorf("serve failed: %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var version = "0.1.2"
@@ -18,7 +19,15 @@ var (
 	stat      bool
 	check     bool
 	ver       bool
+	noVM      bool
+	noOpt     bool
 	pluginDir string
+	pprofFile string
+	evalSrc   string
+	eachLine  bool
+	printLine bool
+	// directories where modules are searched
+	includeDirs listFlag
 )
 
 func init() {
@@ -28,38 +37,92 @@ func init() {
 	flag.BoolVar(&bigint, "big", false, "use big math")
 	flag.BoolVar(&bigint, "b", false, "use big math (shorthand)")
 
-	flag.BoolVar(&stat, "stat", false, "dump statistics after program exit")
-	flag.BoolVar(&stat, "s", false, "dump statistics after program exit (shorthand)")
+	flag.BoolVar(&stat, "stat", false, "print profile of function calls after program exit")
+	flag.BoolVar(&stat, "s", false, "print profile of function calls after program exit (shorthand)")
+	flag.StringVar(&pprofFile, "pprof", "", "write profile of function calls in pprof format to file")
 
 	flag.BoolVar(&check, "check", false, "make parsing and typechecking only")
 	flag.BoolVar(&check, "c", false, "make parsing and typechecking only (shorthand)")
 
+	flag.BoolVar(&noVM, "no-vm", false, "evaluate functions with tree-walking interpreter instead of bytecode VM")
+	flag.BoolVar(&noOpt, "no-opt", false, "disable optimizations (constant folding, inlining)")
+
 	flag.StringVar(&pluginDir, "plugin-dir", "", "plugins directory")
 	flag.StringVar(&pluginDir, "p", "", "plugins directory (shorthand)")
+	flag.Var(&includeDirs, "I", "directory where modules are searched (repeatable)")
+
+	flag.StringVar(&evalSrc, "eval", "", "evaluate expressions with std library instead of file")
+	flag.StringVar(&evalSrc, "e", "", "evaluate expressions with std library instead of file (shorthand)")
+	flag.BoolVar(&eachLine, "n", false, "evaluate program for every line of stdin bound to variable line")
+	flag.BoolVar(&printLine, "print", false, "evaluate program for every line of stdin and print the result")
+
+	flag.StringVar(&diagFormat, "format", formatText, "output format of errors and warnings: text or json")
 
 	flag.BoolVar(&ver, "version", false, "show version")
 	flag.BoolVar(&ver, "v", false, "show version")
 }
 
 func doMain() int {
+	if b, err := openBundle(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	} else if b != nil {
+		return runBundle(b, os.Stdout, os.Args[1:])
+	}
+
 	flag.Parse()
+	// "spil -trace cmd ..." traces subcommands too
+	if !trace {
+		log.SetOutput(ioutil.Discard)
+	}
+	if cmd, ok := commands[flag.Arg(0)]; ok {
+		return cmd(flag.Args()[1:])
+	}
 	if ver {
 		showVersion()
 		return 0
 	}
-	if !trace {
-		log.SetOutput(ioutil.Discard)
+	if diagFormat != formatText && diagFormat != formatJSON {
+		fmt.Fprintf(os.Stderr, "Unknown output format: %q\n", diagFormat)
+		return 1
 	}
 
-	in := NewInterpreter(os.Stdout)
-	in.UseBigInt(bigint)
-	in.PluginDir = pluginDir
-	in.IncludeDirs = []string{in.PluginDir}
+	if evalSrc != "" {
+		return runSource("__eval__", strings.NewReader("(use std) "+evalSrc), flag.Args(), "")
+	}
+	var fname string
+	var args []string
+	if flag.NArg() >= 1 {
+		fname, args = flag.Arg(0), flag.Args()[1:]
+	}
+	return runProgram(fname, args, "")
+}
+
+// searchDirs returns directories where modules are searched: -I directories and the plugins directory if it is set.
+func searchDirs(plugins string) []string {
+	dirs := append([]string{}, includeDirs...)
+	if plugins != "" {
+		dirs = append(dirs, plugins)
+	}
+	return dirs
+}
 
+// programArgs returns arguments of the program: "spil prog.lisp -- args..."
+// passes everything after the separator to the program untouched.
+func programArgs(args []string) []string {
+	if len(args) > 0 && args[0] == "--" {
+		return args[1:]
+	}
+	return args
+}
+
+// runProgram runs program from file (or stdin if fname is empty).
+// Coverage profile is written into coverFile if it is not empty.
+func runProgram(fname string, args []string, coverFile string) int {
+	args = programArgs(args)
 	var file string
 	var input io.Reader
-	if len(flag.Args()) >= 1 {
-		fname := flag.Arg(0)
+	if fname != "" {
 		f, err := os.Open(fname)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -76,31 +139,102 @@ func doMain() int {
 		input = os.Stdin
 		file = "__stdin__"
 	}
+	return runSource(file, input, args, coverFile)
+}
+
+// runSource runs program read from input, file is used to report errors and resolve modules.
+func runSource(file string, input io.Reader, args []string, coverFile string) int {
+	in := NewInterpreter(os.Stdout)
+	in.UseBigInt(bigint)
+	in.PluginDir = pluginDir
+	in.IncludeDirs = searchDirs(in.PluginDir)
+	if eachLine || printLine {
+		in.EachLine(printLine)
+	}
 
 	if err := in.Parse(file, input); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+		report(os.Stderr, severityError, err)
 		return 1
 	}
 
-	if errs := in.Check(); len(errs) > 0 {
+	errs, warnings := in.Check()
+	for _, w := range warnings {
+		report(os.Stderr, severityWarning, w)
+	}
+	if len(errs) > 0 {
 		for _, err := range errs {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
+			report(os.Stderr, severityError, err)
 		}
 		return 1
 	}
 
+	// coverage is collected from unmodified source by tree-walking interpreter
+	if !noOpt && coverFile == "" {
+		for _, w := range in.Optimize() {
+			report(os.Stderr, severityWarning, w)
+		}
+	}
+
 	if check {
 		return 0
 	}
 
-	if err := in.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		return 1
+	if coverFile != "" {
+		in.EnableCoverage()
+	} else if !noVM {
+		in.Compile()
+	}
+
+	if stat || pprofFile != "" {
+		in.EnableProfiling()
+	}
+
+	code := in.exitStatus(in.RunArgs(args))
+	if coverFile != "" {
+		if err := writeCoverProfile(coverFile, in.CoverBlocks()); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			code = 1
+		}
 	}
 	if stat {
-		in.Stat()
+		in.Stat(os.Stderr)
+	}
+	if pprofFile != "" {
+		if err := writeProfileFile(in, pprofFile); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			code = 1
+		}
 	}
-	return 0
+	return code
+}
+
+func writeProfileFile(in *Interpret, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := in.WriteProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Subcommands: spil <command> args...
+var commands = map[string]func(args []string) int{
+	"build":  buildCommand,
+	"bundle": bundleCommand,
+	"test":   testCommand,
+	"golden": goldenCommand,
+	"run":    runCommand,
+	"cover":  coverCommand,
+	"debug":  debugCommand,
+	"lsp":    lspCommand,
+	"fmt":    fmtCommand,
+	"vet":    vetCommand,
+	"doc":    docCommand,
+	"pkg":    pkgCommand,
+	"watch":  watchCommand,
 }
 
 func main() {
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Project manifest "spil.mod" is searched in the directory of the program and its parents.
+// It declares directories where modules and plugins are searched:
+//
+//	(root "..")               ; project root, the directory of spil.mod by default
+//	(src "src" "lib")         ; source directories
+//	(plugins "plugins")       ; plugin directories
+//	(vendor "vendor/json")    ; vendored libraries
+//
+// Libraries installed with "spil pkg" also declare their name, version and main module:
+//
+//	(name "json")
+//	(version "1.2.0")
+//	(main "json.lisp")        ; "<name>.lisp" by default
+//	(native "len" "length")   ; package function bound to builtin function
+//
+// Relative paths are resolved against the directory of spil.mod.
+
+const manifestName = "spil.mod"
+
+type manifest struct {
+	file    string
+	root    string
+	src     []string
+	plugins []string
+	vendor  []string
+	// package description (see "spil pkg")
+	name    string
+	version string
+	main    string
+	// local name -> builtin function
+	natives map[string]string
+}
+
+// moduleDirs returns directories where modules are searched.
+func (m *manifest) moduleDirs() []string {
+	dirs := append([]string{m.root}, m.src...)
+	return append(dirs, m.vendor...)
+}
+
+// findManifest looks for spil.mod in dir and its parents, nil is returned if it is not found.
+func findManifest(dir string) (*manifest, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		file := filepath.Join(dir, manifestName)
+		f, err := os.Open(file)
+		if err == nil {
+			defer f.Close()
+			return parseManifest(file, f)
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func parseManifest(file string, r io.Reader) (*manifest, error) {
+	dir := filepath.Dir(file)
+	m := &manifest{file: file, root: dir}
+	ds, err := readDirectives(file, r)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range ds {
+		var paths []string
+		for _, arg := range d.args {
+			if !filepath.IsAbs(arg) {
+				arg = filepath.Join(dir, arg)
+			}
+			paths = append(paths, arg)
+		}
+		single := func() (string, error) {
+			if len(d.args) != 1 {
+				return "", fmt.Errorf("%v:%d: %v expects one argument", file, d.line, d.name)
+			}
+			return d.args[0], nil
+		}
+		switch d.name {
+		case "root":
+			if _, err := single(); err != nil {
+				return nil, err
+			}
+			m.root = paths[0]
+		case "src":
+			m.src = append(m.src, paths...)
+		case "plugins":
+			m.plugins = append(m.plugins, paths...)
+		case "vendor":
+			m.vendor = append(m.vendor, paths...)
+		case "name":
+			if m.name, err = single(); err != nil {
+				return nil, err
+			}
+		case "version":
+			if m.version, err = single(); err != nil {
+				return nil, err
+			}
+		case "main":
+			if m.main, err = single(); err != nil {
+				return nil, err
+			}
+		case "native":
+			if len(d.args) != 2 {
+				return nil, fmt.Errorf("%v:%d: native expects function name and builtin function", file, d.line)
+			}
+			if m.natives == nil {
+				m.natives = make(map[string]string)
+			}
+			m.natives[d.args[0]] = d.args[1]
+		default:
+			return nil, fmt.Errorf("%v:%d: unknown directive %v", file, d.line, d.name)
+		}
+	}
+	return m, nil
+}
+
+// directive is a line of spil.mod or spil.lock: (name "arg"...)
+type directive struct {
+	name string
+	args []string
+	line int
+}
+
+func readDirectives(file string, r io.Reader) ([]directive, error) {
+	var ds []directive
+	p := NewParser(r, defaultNumberParser{})
+	for {
+		v, err := p.NextExpr(false)
+		if err == io.EOF {
+			return ds, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v:%d: %v", file, p.line, err)
+		}
+		se, ok := v.E.(*types.Sexpr)
+		if !ok || se.Length() < 2 {
+			return nil, fmt.Errorf("%v:%d: expected (directive \"arg\"...), found %v", file, p.line, literal(v.E))
+		}
+		name, ok := se.List[0].E.(types.Ident)
+		if !ok {
+			return nil, fmt.Errorf("%v:%d: expected directive, found %v", file, se.Line, literal(se.List[0].E))
+		}
+		d := directive{name: string(name), line: se.Line}
+		for _, arg := range se.List[1:] {
+			s, ok := arg.E.(types.Str)
+			if !ok {
+				return nil, fmt.Errorf("%v:%d: expected string, found %v", file, se.Line, literal(arg.E))
+			}
+			d.args = append(d.args, string(s))
+		}
+		ds = append(ds, d)
+	}
+}
+
+// literal returns the value as it is written in the source.
+func literal(e types.Expr) string {
+	switch a := e.(type) {
+	case types.Ident:
+		return string(a)
+	case *types.Sexpr:
+		items := make([]string, len(a.List))
+		for n, v := range a.List {
+			items[n] = literal(v.E)
+		}
+		l := "(" + strings.Join(items, " ") + ")"
+		if a.Quoted {
+			l = "'" + l
+		}
+		return l
+	}
+	b := &strings.Builder{}
+	printLiteral(b, e)
+	return b.String()
+}
+
+// printLiteral writes value as it is written in the source code.
+func printLiteral(b *strings.Builder, e types.Expr) {
+	switch a := e.(type) {
+	case types.Str:
+		fmt.Fprintf(b, "%q", string(a))
+	case types.Bool:
+		if bool(a) {
+			b.WriteString("'T")
+		} else {
+			b.WriteString("'F")
+		}
+	case types.List:
+		if a.Empty() {
+			b.WriteString("'()")
+			return
+		}
+		a.Print(b)
+	default:
+		a.Print(b)
+	}
+}
+
+// moduleDirs returns directories where modules used by the file are searched:
+// the directory of the file, include directories, directories of the project
+// manifest and directories from SPILPATH environment variable.
+func (in *Interpret) moduleDirs(file string) []string {
+	dirs := append([]string{filepath.Dir(file)}, in.IncludeDirs...)
+	if in.manifest != nil {
+		dirs = append(dirs, in.manifest.moduleDirs()...)
+	}
+	if path := os.Getenv("SPILPATH"); path != "" {
+		dirs = append(dirs, filepath.SplitList(path)...)
+	}
+	return dirs
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestModuleSearchPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spil-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"project/spil.mod": `; project manifest
+(src "src")
+(vendor "vendor/json")`,
+		"project/src/util/strings.lisp": `(def shout (s) (append s "!"))`,
+		"project/vendor/json/json.lisp": `(def encode (s) (append "\"" s "\""))`,
+		"project/common.lisp":           `(def twice (s) (append s s))`,
+		"project/app/main.lisp": `(use "util/strings.lisp")
+(use "json.lisp")
+(use "common.lisp")
+(use "extra.lisp")
+(use "global.lisp")
+(print (shout "a") (encode "b") (twice "c") (extra "d") (global "e"))`,
+		"include/extra.lisp": `(def extra (s) (append "+" s))`,
+		"global/global.lisp": `(def global (s) (append "*" s))`,
+	}
+	for name, code := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("SPILPATH", os.Getenv("SPILPATH"))
+	os.Setenv("SPILPATH", filepath.Join(dir, "nowhere")+string(filepath.ListSeparator)+filepath.Join(dir, "global"))
+
+	main := filepath.Join(dir, "project/app/main.lisp")
+	f, err := os.Open(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout := &bytes.Buffer{}
+	in := NewInterpreter(stdout)
+	in.IncludeDirs = []string{filepath.Join(dir, "include")}
+	if err := run(in, main, f, true); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	exp := "a! \"b\" cc +d *e\n"
+	if act := stdout.String(); act != exp {
+		t.Errorf("Incorrect output: expected %q, actual %q", exp, act)
+	}
+	expDirs := []string{
+		filepath.Join(dir, "project/app"),
+		filepath.Join(dir, "include"),
+		filepath.Join(dir, "project"),
+		filepath.Join(dir, "project/src"),
+		filepath.Join(dir, "project/vendor/json"),
+		filepath.Join(dir, "nowhere"),
+		filepath.Join(dir, "global"),
+	}
+	if act := in.moduleDirs(main); !reflect.DeepEqual(act, expDirs) {
+		t.Errorf("Incorrect module directories:\nexpected %q,\n  actual %q", expDirs, act)
+	}
+}
+
+func TestSearchDirs(t *testing.T) {
+	defer func(dirs listFlag) { includeDirs = dirs }(includeDirs)
+	includeDirs = listFlag{"lib"}
+	if act, exp := searchDirs(""), []string{"lib"}; !reflect.DeepEqual(act, exp) {
+		t.Errorf("Incorrect search directories without plugins: expected %q, actual %q", exp, act)
+	}
+	if act, exp := searchDirs("plugins"), []string{"lib", "plugins"}; !reflect.DeepEqual(act, exp) {
+		t.Errorf("Incorrect search directories: expected %q, actual %q", exp, act)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		text string
+		exp  *manifest
+		err  string
+	}{
+		{
+			text: `(root "..")
+(src "src" "lib")
+(plugins "/opt/plugins")
+(vendor "vendor/a" "vendor/b")`,
+			exp: &manifest{
+				file:    "/p/q/spil.mod",
+				root:    "/p",
+				src:     []string{"/p/q/src", "/p/q/lib"},
+				plugins: []string{"/opt/plugins"},
+				vendor:  []string{"/p/q/vendor/a", "/p/q/vendor/b"},
+			},
+		},
+		{
+			text: `(name "json") (version "1.2.0") (main "src/json.lisp")`,
+			exp:  &manifest{file: "/p/q/spil.mod", root: "/p/q", name: "json", version: "1.2.0", main: "src/json.lisp"},
+		},
+		{
+			text: `(native "len" "length") (native "first" "native.head")`,
+			exp:  &manifest{file: "/p/q/spil.mod", root: "/p/q", natives: map[string]string{"len": "length", "first": "native.head"}},
+		},
+		{text: `(native "len")`, err: "/p/q/spil.mod:1: native expects function name and builtin function"},
+		{text: `(src src)`, err: "/p/q/spil.mod:1: expected string, found src"},
+		{text: "\n(source \"src\")", err: "/p/q/spil.mod:2: unknown directive source"},
+		{text: `(root "a" "b")`, err: "/p/q/spil.mod:1: root expects one argument"},
+	}
+	for _, test := range tests {
+		m, err := parseManifest("/p/q/spil.mod", strings.NewReader(test.text))
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("Expected error %q, found %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseManifest(%q) failed: %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.exp) {
+			t.Errorf("Incorrect manifest:\nexpected %+v,\n  actual %+v", test.exp, m)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Modules loaded with (use "file.lisp") have their own namespace.
+// Functions of the module are registered as "<module>.<name>", names in
+// function bodies are resolved into these global names when the file is parsed.
+
+type module struct {
+	// prefix of global names of module functions
+	name string
+	file string
+	// default qualifier used in the importing file
+	qualifier string
+	// local names of defined functions
+	funcs map[string]bool
+	// exported functions, nil means all functions are exported
+	exports map[string]bool
+}
+
+func (m *module) exported(name string) bool {
+	if !m.funcs[name] {
+		return false
+	}
+	return m.exports == nil || m.exports[name]
+}
+
+// namespace contains names imported into the file.
+type namespace struct {
+	// local name -> global name
+	names map[string]string
+	// where unqualified names are imported from
+	origins map[string]*module
+	// names imported from several modules by plain "use"
+	ambiguous map[string][]*module
+	// qualifier -> module
+	modules map[string]*module
+}
+
+func (in *Interpret) namespace(file string) *namespace {
+	ns, ok := in.namespaces[file]
+	if !ok {
+		ns = &namespace{
+			names:     make(map[string]string),
+			origins:   make(map[string]*module),
+			ambiguous: make(map[string][]*module),
+			modules:   make(map[string]*module),
+		}
+		in.namespaces[file] = ns
+	}
+	return ns
+}
+
+// newModule creates module with unique prefix of global names.
+func (in *Interpret) newModule(file string) *module {
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	name := base
+	for n := 2; ; n++ {
+		used := false
+		for _, m := range in.modules {
+			if m.name == name {
+				used = true
+				break
+			}
+		}
+		if !used {
+			break
+		}
+		name = fmt.Sprintf("%v%d", base, n)
+	}
+	m := &module{name: name, file: file, qualifier: base, funcs: make(map[string]bool)}
+	in.modules[file] = m
+	return m
+}
+
+// importModule makes functions of the module available in the file.
+// (use "file.lisp" [:as name] [:only (f g ...)])
+func (in *Interpret) importModule(file string, m *module, opts []types.Value) error {
+	qualifier := m.qualifier
+	var only []string
+	all := true
+	for len(opts) > 0 {
+		key, ok := opts[0].E.(types.Ident)
+		if !ok || len(opts) < 2 {
+			return fmt.Errorf("'use' expects :as or :only option, found: %v", opts[0])
+		}
+		switch key {
+		case ":as":
+			alias, ok := opts[1].E.(types.Ident)
+			if !ok {
+				return fmt.Errorf("'use :as' expects identifier, found: %v", opts[1])
+			}
+			qualifier = string(alias)
+			all = false
+		case ":only":
+			names, ok := opts[1].E.(*types.Sexpr)
+			if !ok {
+				return fmt.Errorf("'use :only' expects list of functions, found: %v", opts[1])
+			}
+			only = []string{}
+			for _, n := range names.List {
+				id, ok := n.E.(types.Ident)
+				if !ok {
+					return fmt.Errorf("'use :only' expects list of functions, found: %v", n)
+				}
+				only = append(only, string(id))
+			}
+			all = false
+		default:
+			return fmt.Errorf("'use' expects :as or :only option, found: %v", key)
+		}
+		opts = opts[2:]
+	}
+	ns := in.namespace(file)
+	if prev, ok := ns.modules[qualifier]; ok && prev != m {
+		return fmt.Errorf("Module name %v is already used by %v", qualifier, prev.file)
+	}
+	ns.modules[qualifier] = m
+	if all {
+		for name := range m.funcs {
+			if m.exported(name) {
+				only = append(only, name)
+			}
+		}
+	}
+	for _, name := range only {
+		if !m.exported(name) {
+			return fmt.Errorf("Function %v is not exported by module %v", name, m.file)
+		}
+		if prev, ok := ns.origins[name]; ok && prev != m {
+			if !all {
+				return fmt.Errorf("Function %v is already imported from %v", name, prev.file)
+			}
+			// it is an error to use the name without qualifier
+			ns.ambiguous[name] = []*module{prev, m}
+			delete(ns.names, name)
+			delete(ns.origins, name)
+			continue
+		}
+		if _, ok := ns.ambiguous[name]; ok {
+			ns.ambiguous[name] = append(ns.ambiguous[name], m)
+			continue
+		}
+		ns.names[name] = m.name + "." + name
+		ns.origins[name] = m
+	}
+	return nil
+}
+
+// (export f g ...)
+func (in *Interpret) defineExports(file string, args []types.Value) error {
+	m, ok := in.modules[file]
+	if !ok {
+		// the module is run as a program
+		return nil
+	}
+	if m.exports == nil {
+		m.exports = make(map[string]bool)
+	}
+	for _, arg := range args {
+		id, ok := arg.E.(types.Ident)
+		if !ok {
+			return fmt.Errorf("export expects function names, found: %v", arg)
+		}
+		m.exports[string(id)] = true
+	}
+	return nil
+}
+
+// resolveNames replaces names of module functions in definitions of the file with global names.
+// body contains top-level expressions of the file.
+func (in *Interpret) resolveNames(file string, body []types.Value) error {
+	m := in.modules[file]
+	ns := in.namespaces[file]
+	if m == nil && ns == nil {
+		return nil
+	}
+	names := make(map[string]string)
+	var qualifiers map[string]*module
+	if ns != nil {
+		for k, v := range ns.names {
+			names[k] = v
+		}
+		for q, mod := range ns.modules {
+			for name := range mod.funcs {
+				if mod.exported(name) {
+					names[q+"."+name] = mod.name + "." + name
+				}
+			}
+		}
+		qualifiers = ns.modules
+	}
+	if m != nil {
+		for name := range m.exports {
+			if !m.funcs[name] {
+				return fmt.Errorf("export: function %v is not defined in module", name)
+			}
+		}
+		// local functions shadow imported ones
+		for name := range m.funcs {
+			names[name] = m.name + "." + name
+		}
+	} else {
+		for name := range ns.names {
+			if in.funcsOrigins[name] == file {
+				delete(names, name)
+			}
+		}
+	}
+	r := &nameResolver{names: names, qualifiers: qualifiers, ambiguous: make(map[string][]*module)}
+	if ns != nil {
+		for name, ms := range ns.ambiguous {
+			if _, local := names[name]; !local && in.funcsOrigins[name] != file {
+				r.ambiguous[name] = ms
+			}
+		}
+	}
+	for _, fn := range in.funcs {
+		fi, ok := fn.(*FuncInterpret)
+		if !ok {
+			continue
+		}
+		for _, impl := range fi.bodies {
+			if impl.file == file {
+				if err := r.resolve(impl.argfmt, impl.body); err != nil {
+					return errorAt(file, impl.line, err)
+				}
+			}
+		}
+	}
+	for _, fi := range in.tests {
+		if impl := fi.bodies[0]; impl.file == file {
+			if err := r.resolve(nil, impl.body); err != nil {
+				return errorAt(file, impl.line, err)
+			}
+		}
+	}
+	return r.resolve(nil, body)
+}
+
+type nameResolver struct {
+	names      map[string]string
+	qualifiers map[string]*module
+	ambiguous  map[string][]*module
+	// parameters and variables of the current body
+	locals map[string]bool
+}
+
+func (r *nameResolver) resolve(argfmt *ArgFmt, body []types.Value) error {
+	r.locals = localNames(argfmt, body)
+	return r.values(body)
+}
+
+// localNames returns parameters of the function and variables set in its body.
+func localNames(argfmt *ArgFmt, body []types.Value) map[string]bool {
+	locals := make(map[string]bool)
+	if argfmt != nil {
+		for _, arg := range argfmt.Args {
+			locals[arg.Name] = true
+		}
+		locals[argfmt.Wildcard] = true
+	}
+	collectVars(locals, body)
+	return locals
+}
+
+// collectVars finds all variables set in the body.
+func collectVars(locals map[string]bool, body []types.Value) {
+	for _, v := range body {
+		se, ok := v.E.(*types.Sexpr)
+		if !ok || se.Quoted {
+			continue
+		}
+		if len(se.List) > 1 {
+			if head, ok := se.List[0].E.(types.Ident); ok && (head == "set" || head == "set'") {
+				if name, ok := se.List[1].E.(types.Ident); ok {
+					locals[string(name)] = true
+				}
+			}
+		}
+		collectVars(locals, se.List)
+	}
+}
+
+func (r *nameResolver) values(body []types.Value) error {
+	for i := range body {
+		switch a := body[i].E.(type) {
+		case types.Ident:
+			name := string(a)
+			if r.locals[name] {
+				continue
+			}
+			if global, ok := r.names[name]; ok {
+				body[i].E = types.Ident(global)
+				continue
+			}
+			if ms, ok := r.ambiguous[name]; ok {
+				files := make([]string, 0, len(ms))
+				for _, m := range ms {
+					files = append(files, m.file)
+				}
+				return fmt.Errorf("Function %v is imported from several modules (%v), use qualified name", name, strings.Join(files, ", "))
+			}
+			if dot := strings.LastIndex(name, "."); dot > 0 {
+				if m, ok := r.qualifiers[name[:dot]]; ok {
+					if m.funcs[name[dot+1:]] {
+						return fmt.Errorf("Function %v is not exported by module %v", name[dot+1:], m.file)
+					}
+					return fmt.Errorf("Function %v is not defined in module %v", name[dot+1:], m.file)
+				}
+			}
+		case *types.Sexpr:
+			if a.Quoted {
+				continue
+			}
+			if err := r.values(a.List); err != nil {
+				if a.Line > 0 {
+					return errorAt(a.File, a.Line, err)
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// globalName returns global name of the function which is referenced as name in the file.
+func (in *Interpret) globalName(file, name string) string {
+	if m, ok := in.modules[file]; ok && m.funcs[name] {
+		return m.name + "." + name
+	}
+	ns, ok := in.namespaces[file]
+	if !ok {
+		return name
+	}
+	if global, ok := ns.names[name]; ok {
+		return global
+	}
+	if dot := strings.LastIndex(name, "."); dot > 0 {
+		if m, ok := ns.modules[name[:dot]]; ok && m.exported(name[dot+1:]) {
+			return m.name + "." + name[dot+1:]
+		}
+	}
+	return name
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestModules(t *testing.T) {
+	modules := map[string]string{
+		"a.lisp": `(export greet)
+(def helper (x) (append "a:" x))
+(def greet (x) (helper x))`,
+		"b.lisp": `(def helper (x) (append "b:" x))
+(def greet-b (x:str) :str (helper x))
+(def twice (f x) (f (f x)))
+(def twice-helper (x) (twice helper x))`,
+		"c.lisp": `(def helper (x) (append "c:" x))`,
+		"lib/x.lisp": `(use std)
+(use "y.lisp")
+(def x-inc (n) (inc (y-inc n)))`,
+		"lib/y.lisp": `(use std)
+(def y-inc (n) (inc n))`,
+		"big.lisp":    `(def big () (* 4294967296 4294967296))`,
+		"cycle1.lisp": `(use "cycle2.lisp")`,
+		"cycle2.lisp": `(use "cycle1.lisp")`,
+	}
+	dir, err := ioutil.TempDir("", "spil-modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name string
+		code string
+		exp  string
+		err  string
+	}{
+		{
+			name: "unqualified",
+			code: `(use "a.lisp")
+(use "b.lisp")
+(print (greet "1") (greet-b "2") (twice-helper "3"))`,
+			exp: "a:1 b:2 b:b:3\n",
+		},
+		{
+			name: "qualified",
+			code: `(use "a.lisp")
+(use "b.lisp")
+(print (a.greet "1") (b.greet-b "2"))`,
+			exp: "a:1 b:2\n",
+		},
+		{
+			name: "local function with the same name",
+			code: `(use "b.lisp")
+(def helper (x) (append "main:" x))
+(set helper2 b.helper)
+(print (helper "1") (greet-b "2") (helper2 "3"))`,
+			exp: "main:1 b:2 b:3\n",
+		},
+		{
+			name: "as",
+			code: `(use "b.lisp" :as m)
+(def greet-b (x) x)
+(print (m.greet-b "1") (greet-b "2"))`,
+			exp: "b:1 2\n",
+		},
+		{
+			name: "only",
+			code: `(use "b.lisp" :only (greet-b))
+(def twice (x) x)
+(print (greet-b "1") (twice "2") (b.twice b.helper "3"))`,
+			exp: "b:1 2 b:b:3\n",
+		},
+		{
+			name: "not exported",
+			code: `(use "a.lisp")
+(print (a.helper "1"))`,
+			err: "Function helper is not exported by module",
+		},
+		{
+			name: "not exported in only",
+			code: `(use "a.lisp" :only (helper))`,
+			err:  "Function helper is not exported by module",
+		},
+		{
+			name: "unknown function",
+			code: `(use "a.lisp")
+(print (a.hello "1"))`,
+			err: "Function hello is not defined in module",
+		},
+		{
+			name: "function imported from several modules",
+			code: `(use "b.lisp")
+(use "c.lisp")
+(print (b.helper "1") (c.helper "2") (greet-b "3"))`,
+			exp: "b:1 c:2 b:3\n",
+		},
+		{
+			name: "ambiguous function",
+			code: `(use "b.lisp")
+(use "c.lisp")
+(print (helper "1"))`,
+			err: "Function helper is imported from several modules",
+		},
+		{
+			name: "function imported explicitly from several modules",
+			code: `(use "b.lisp" :only (helper))
+(use "c.lisp" :only (helper))`,
+			err: "Function helper is already imported from",
+		},
+		{
+			name: "repeated use",
+			code: `(use std)
+(use "lib/x.lisp")
+(use "lib/x.lisp" :as x2)
+(use "lib/y.lisp")
+(use std)
+(print (x-inc 1) (x2.x-inc 1) (y-inc 1))`,
+			exp: "3 3 2\n",
+		},
+		{
+			name: "import cycle",
+			code: `(use "cycle1.lisp")`,
+			err:  "cycle1.lisp -> " + filepath.Join(dir, "cycle2.lisp") + " -> " + filepath.Join(dir, "cycle1.lisp"),
+		},
+		{
+			name: "pragmas are applied before modules",
+			code: `(use "big.lisp")
+(use bigmath)
+(print (big))`,
+			exp: "18446744073709551616\n",
+		},
+		{
+			name: "pragma after definition",
+			code: `(use "a.lisp")
+(def f () 1)
+(use std)`,
+			err: "Pragma (use std) should be placed before definitions and expressions",
+		},
+		{
+			name: "module name is already used",
+			code: `(use "a.lisp" :only (greet))
+(use "b.lisp" :as a)`,
+			err: "Module name a is already used by",
+		},
+	}
+	for name, code := range modules {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			in := NewInterpreter(stdout)
+			err := run(in, filepath.Join(dir, "main.lisp"), strings.NewReader(test.code), true)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("Expected error %q, found %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if act := stdout.String(); act != test.exp {
+				t.Errorf("Incorrect output: expected %q, actual %q", test.exp, act)
+			}
+		})
+	}
+}
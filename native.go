@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Runtime support for programs translated into Go by "spil build" (see build.go).
+//
+// Generated functions work on the same frames as bytecode VM:
+// every instruction is translated into a call of corresponding vmFrame method
+// and jumps are translated into goto-statements.
+
+type goBody func(m *vmFrame) (*types.Value, error)
+
+// errTailCall is returned by generated function when the frame is bound to another clause.
+var errTailCall = errors.New("tail call")
+
+func (m *vmFrame) runNative() (*types.Value, error) {
+	for {
+		res, err := m.code.native(m)
+		if err != errTailCall {
+			return res, err
+		}
+	}
+}
+
+// addNative adds function implementation with generated body.
+// Body is nil unless the implementation is evaluated by the tree-walking interpreter.
+func (f *FuncInterpret) addNative(argfmt *ArgFmt, body []types.Value, memo bool, returnType types.Type, code *vmCode) {
+	impl := NewFuncImpl(argfmt, body, memo, returnType)
+	impl.code = code
+	f.bodies = append(f.bodies, impl)
+	f.compiled = code != nil
+}
+
+// linkNative resolves functions called by generated code.
+func (in *Interpret) linkNative() {
+	var link func(code *vmCode)
+	link = func(code *vmCode) {
+		if code == nil {
+			return
+		}
+		for i := range code.callees {
+			if c := &code.callees[i]; c.slot < 0 {
+				c.fn = in.funcs[c.name]
+			}
+		}
+		for _, l := range code.lambdas {
+			link(l.code)
+		}
+	}
+	for _, fn := range in.funcs {
+		if fi, ok := fn.(*FuncInterpret); ok {
+			for _, impl := range fi.bodies {
+				link(impl.code)
+			}
+		}
+	}
+	for _, impl := range in.main.bodies {
+		link(impl.code)
+	}
+}
+
+func (in *Interpret) mustInt(token string) types.Int {
+	v, ok := in.intMaker.ParseInt(token)
+	if !ok {
+		panic(fmt.Errorf("Cannot parse int: %v", token))
+	}
+	return v
+}
+
+func (in *Interpret) mustFloat(token string) types.Float {
+	v, ok := in.floatMaker.ParseFloat(token)
+	if !ok {
+		panic(fmt.Errorf("Cannot parse float: %v", token))
+	}
+	return v
+}
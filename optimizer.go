@@ -0,0 +1,430 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Optimizer rewrites bodies of functions before execution:
+// - folds calls of arithmetic and comparison functions with constant arguments;
+// - inlines small non-recursive functions;
+// - eliminates unreachable branches of if-statements with constant conditions.
+// It also reports function clauses which can never match.
+
+// Builtin functions which can be evaluated at compile time.
+var foldableFuncs = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "mod": true,
+	"<": true, ">": true, "<=": true, ">=": true,
+	"=": true, "not": true,
+}
+
+// Maximum size (number of atoms) of function body which can be inlined.
+const inlineMaxSize = 16
+
+// Maximum depth of nested inlining.
+const inlineMaxDepth = 4
+
+// Optimize should be called after type checking.
+// It returns warnings about unreachable function clauses.
+func (in *Interpret) Optimize() (warnings []error) {
+	o := &optimizer{
+		in:      in,
+		inlines: make(map[string]*inlineFunc),
+	}
+	for name, fn := range in.funcs {
+		if fi, ok := fn.(*FuncInterpret); ok {
+			if inl := o.inlineCandidate(fi); inl != nil {
+				o.inlines[name] = inl
+			}
+			warnings = append(warnings, in.unreachableClauses(fi)...)
+		}
+	}
+	for _, fn := range in.funcs {
+		if fi, ok := fn.(*FuncInterpret); ok {
+			o.optimizeFunc(fi)
+		}
+	}
+	for _, t := range in.tests {
+		o.optimizeFunc(t)
+	}
+	o.optimizeFunc(in.main)
+	in.mainBody = in.main.bodies[0].body
+	return warnings
+}
+
+type optimizer struct {
+	in      *Interpret
+	inlines map[string]*inlineFunc
+}
+
+type inlineFunc struct {
+	params []string
+	body   types.Value
+}
+
+// scope of the function being optimized
+type optScope struct {
+	fname string
+	// names of variables defined in the function
+	bound map[string]bool
+}
+
+func (o *optimizer) optimizeFunc(fi *FuncInterpret) {
+	for _, impl := range fi.bodies {
+		sc := &optScope{fname: fi.name, bound: make(map[string]bool)}
+		if impl.argfmt != nil {
+			for name := range impl.argfmt.Values() {
+				sc.bound[name] = true
+			}
+		}
+		collectBound(impl.body, sc.bound)
+		body := make([]types.Value, 0, len(impl.body))
+		for _, st := range impl.body {
+			body = append(body, o.optimize(sc, st, 0))
+		}
+		impl.body = body
+	}
+}
+
+// collectBound collects names of variables defined with set.
+func collectBound(st []types.Value, bound map[string]bool) {
+	for _, s := range st {
+		se, ok := s.E.(*types.Sexpr)
+		if !ok || se.Quoted {
+			continue
+		}
+		if len(se.List) >= 2 {
+			if head, ok := se.List[0].E.(types.Ident); ok && (head == "set" || head == "set'") {
+				if name, ok := se.List[1].E.(types.Ident); ok {
+					bound[string(name)] = true
+				}
+			}
+		}
+		collectBound(se.List, bound)
+	}
+}
+
+func (o *optimizer) optimize(sc *optScope, e types.Value, depth int) types.Value {
+	se, ok := e.E.(*types.Sexpr)
+	if !ok || se.Quoted || se.Empty() {
+		return e
+	}
+	if se.Lambda {
+		return types.Value{E: &types.Sexpr{List: o.optimizeList(sc, se.List, depth), Lambda: true, File: se.File, Line: se.Line, Col: se.Col}, T: e.T}
+	}
+	head, ok := se.List[0].E.(types.Ident)
+	if !ok {
+		return e
+	}
+	rebuild := func(list []types.Value) types.Value {
+		return types.Value{E: &types.Sexpr{List: list, File: se.File, Line: se.Line, Col: se.Col}, T: e.T}
+	}
+	switch name := string(head); name {
+	case "if":
+		if len(se.List) != 4 {
+			return e
+		}
+		list := o.optimizeList(sc, se.List, depth)
+		if cond, ok := list[1].E.(types.Bool); ok {
+			if bool(cond) {
+				return list[2]
+			}
+			return list[3]
+		}
+		return rebuild(list)
+	case "and", "or":
+		return o.optimizeLogic(sc, se, name == "and", depth)
+	case "set", "set'":
+		if len(se.List) < 3 {
+			return e
+		}
+		list := append([]types.Value{}, se.List...)
+		list[2] = o.optimize(sc, list[2], depth)
+		return rebuild(list)
+	case "apply":
+		if len(se.List) != 3 {
+			return e
+		}
+		list := append([]types.Value{}, se.List...)
+		list[2] = o.optimize(sc, list[2], depth)
+		return rebuild(list)
+	case "do", "lambda", "gen", "gen'":
+		return rebuild(o.optimizeList(sc, se.List, depth))
+	}
+	list := o.optimizeList(sc, se.List, depth)
+	if sc.bound[string(head)] {
+		// variable holding a function
+		return rebuild(list)
+	}
+	if res, ok := o.inline(sc, list, depth); ok {
+		return res
+	}
+	if res, ok := o.fold(list); ok {
+		return res
+	}
+	return rebuild(list)
+}
+
+// optimizeList optimizes every item of s-expression except the head.
+func (o *optimizer) optimizeList(sc *optScope, list []types.Value, depth int) []types.Value {
+	res := make([]types.Value, 0, len(list))
+	res = append(res, list[0])
+	for _, item := range list[1:] {
+		res = append(res, o.optimize(sc, item, depth))
+	}
+	return res
+}
+
+// Leading constant arguments of and/or are evaluated at compile time.
+func (o *optimizer) optimizeLogic(sc *optScope, se *types.Sexpr, isAnd bool, depth int) types.Value {
+	list := o.optimizeList(sc, se.List, depth)
+	args := list[1:]
+	for len(args) > 0 {
+		b, ok := args[0].E.(types.Bool)
+		if !ok {
+			break
+		}
+		if bool(b) != isAnd {
+			// result is known: false for "and", true for "or"
+			return types.Value{E: b, T: types.TypeBool}
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return types.Value{E: types.Bool(isAnd), T: types.TypeBool}
+	}
+	return types.Value{E: &types.Sexpr{List: append([]types.Value{list[0]}, args...), File: se.File, Line: se.Line, Col: se.Col}, T: types.TypeList}
+}
+
+func isLiteral(e types.Value) bool {
+	switch e.E.(type) {
+	case types.Int, types.Float, types.Str, types.Bool:
+		return true
+	}
+	return false
+}
+
+// fold evaluates call of pure builtin function with constant arguments.
+func (o *optimizer) fold(list []types.Value) (res types.Value, ok bool) {
+	name := string(list[0].E.(types.Ident))
+	if !foldableFuncs[name] {
+		return res, false
+	}
+	for _, arg := range list[1:] {
+		if !isLiteral(arg) {
+			return res, false
+		}
+	}
+	fn, ok := o.in.funcs[name]
+	if !ok {
+		return res, false
+	}
+	defer func() {
+		// e.g. division by zero: leave it to runtime
+		if r := recover(); r != nil {
+			log.Printf("cannot fold %v: %v", list, r)
+			ok = false
+		}
+	}()
+	v, err := fn.Eval(list[1:])
+	if err != nil || !isLiteral(*v) {
+		return res, false
+	}
+	return *v, true
+}
+
+// inlineCandidate checks if function is small enough and simple enough to be inlined:
+// it should have the only clause with untyped parameters and a single expression in its body.
+func (o *optimizer) inlineCandidate(fi *FuncInterpret) *inlineFunc {
+	if len(fi.bodies) != 1 {
+		return nil
+	}
+	impl := fi.bodies[0]
+	if impl.argfmt == nil || impl.argfmt.Wildcard != "" || impl.memo || impl.returnType != types.TypeUnknown || len(impl.body) != 1 {
+		return nil
+	}
+	inl := &inlineFunc{body: impl.body[0]}
+	seen := make(map[string]bool)
+	for _, arg := range impl.argfmt.Args {
+		if arg.V != nil || arg.T != types.TypeUnknown || arg.Name == "" || seen[arg.Name] {
+			return nil
+		}
+		seen[arg.Name] = true
+		inl.params = append(inl.params, arg.Name)
+	}
+	if _, ok := types.ParseType(identName(inl.body)); ok {
+		return nil
+	}
+	size := 0
+	simple := true
+	walkEvaluated(inl.body, func(v types.Value) {
+		size++
+		switch a := v.E.(type) {
+		case types.Ident:
+			n := string(a)
+			if n == fi.name || n == "self" || lambdaArgRe.MatchString(n) {
+				simple = false
+			}
+		case *types.Sexpr:
+			if a.Lambda {
+				simple = false
+			} else if len(a.List) > 0 {
+				switch identName(a.List[0]) {
+				case "lambda", "set", "set'":
+					simple = false
+				}
+			}
+		}
+	})
+	if !simple || size > inlineMaxSize {
+		return nil
+	}
+	return inl
+}
+
+func identName(v types.Value) string {
+	if id, ok := v.E.(types.Ident); ok {
+		return string(id)
+	}
+	return ""
+}
+
+// walkEvaluated visits all evaluated (non-quoted) nodes of expression.
+func walkEvaluated(v types.Value, fn func(types.Value)) {
+	fn(v)
+	if se, ok := v.E.(*types.Sexpr); ok && !se.Quoted {
+		for _, item := range se.List {
+			walkEvaluated(item, fn)
+		}
+	}
+}
+
+// inline replaces call of small function with its body.
+// Arguments should be constants or variables so they can be evaluated any number of times.
+func (o *optimizer) inline(sc *optScope, list []types.Value, depth int) (types.Value, bool) {
+	name := string(list[0].E.(types.Ident))
+	inl, ok := o.inlines[name]
+	if !ok || name == sc.fname || depth >= inlineMaxDepth || len(list)-1 != len(inl.params) {
+		return types.Value{}, false
+	}
+	args := make(map[string]types.Value)
+	for i, p := range inl.params {
+		arg := list[i+1]
+		switch a := arg.E.(type) {
+		case types.Int, types.Float, types.Str, types.Bool, types.Ident:
+		case *types.Sexpr:
+			if !a.Quoted {
+				return types.Value{}, false
+			}
+		default:
+			return types.Value{}, false
+		}
+		args[p] = arg
+	}
+	body, ok := substitute(inl.body, args, sc.bound)
+	if !ok {
+		return types.Value{}, false
+	}
+	res := o.optimize(sc, body, depth+1)
+	// expressions of functions inlined into this body are already recorded
+	walkEvaluated(res, func(v types.Value) {
+		if se, ok := v.E.(*types.Sexpr); ok && !se.Quoted {
+			if _, ok := o.in.inlined[se]; !ok {
+				o.in.inlined[se] = name
+			}
+		}
+	})
+	return res, true
+}
+
+// substitute replaces parameters with arguments.
+// It fails if names used by the body are shadowed by variables of the caller
+// or if non-identifier is substituted in place of called function.
+func substitute(v types.Value, args map[string]types.Value, bound map[string]bool) (types.Value, bool) {
+	switch a := v.E.(type) {
+	case types.Ident:
+		if arg, ok := args[string(a)]; ok {
+			return arg, true
+		}
+		return v, !bound[string(a)]
+	case *types.Sexpr:
+		if a.Quoted {
+			return v, true
+		}
+		list := make([]types.Value, 0, len(a.List))
+		for i, item := range a.List {
+			res, ok := substitute(item, args, bound)
+			if !ok {
+				return v, false
+			}
+			if _, isIdent := res.E.(types.Ident); i == 0 && !isIdent {
+				return v, false
+			}
+			list = append(list, res)
+		}
+		return types.Value{E: &types.Sexpr{List: list, File: a.File, Line: a.Line, Col: a.Col}, T: v.T}, true
+	}
+	return v, true
+}
+
+// unreachableClauses reports clauses of function which are shadowed by earlier clauses.
+func (in *Interpret) unreachableClauses(fi *FuncInterpret) (warnings []error) {
+	for j, later := range fi.bodies {
+		for i, earlier := range fi.bodies[:j] {
+			if in.subsumes(earlier.argfmt, later.argfmt) {
+				err := fmt.Errorf("%v: %v: clause %d %v can never match: clause %d %v matches first",
+					in.funcsOrigins[fi.name], fi.name, j+1, argfmtString(later.argfmt), i+1, argfmtString(earlier.argfmt))
+				warnings = append(warnings, inFunc(fi.name, errorAtCol(later.file, later.line, later.col, err)))
+				break
+			}
+		}
+	}
+	return
+}
+
+// subsumes checks if every list of parameters matching b also matches a.
+func (in *Interpret) subsumes(a, b *ArgFmt) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if a.Wildcard != "" {
+		return true
+	}
+	if b.Wildcard != "" || len(a.Args) != len(b.Args) {
+		return false
+	}
+	names := make(map[string]bool)
+	for i, aa := range a.Args {
+		ba := b.Args[i]
+		if aa.T.Basic() == "args" || ba.T.Basic() == "args" || in.IsGeneric(aa.T) {
+			return false
+		}
+		if aa.Name != "" {
+			if names[aa.Name] {
+				// repeated name requires equal values
+				return false
+			}
+			names[aa.Name] = true
+		}
+		if aa.V != nil {
+			if ba.V == nil || aa.T != ba.T || !types.Equal(aa.V, ba.V) {
+				return false
+			}
+			continue
+		}
+		at := in.UnaliasType(aa.T)
+		bt := in.UnaliasType(ba.T)
+		if at == types.TypeUnknown || at == types.TypeAny || at == bt {
+			continue
+		}
+		if bt == types.TypeUnknown || in.IsGeneric(bt) {
+			return false
+		}
+		if ok, err := in.canConvertType(bt, at); !ok || err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/avoronkov/spil/types"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		exp  string
+	}{
+		{
+			"constant folding",
+			`(print (+ 1 (* 2 3)) (< 1 2))`,
+			`(print 7 'T)`,
+		},
+		{
+			"division by zero is not folded",
+			`(print (/ 1 0))`,
+			`(print (/ 1 0))`,
+		},
+		{
+			"dead if branch",
+			`(print (if (> 2 1) "yes" (f 1)))`,
+			`(print "yes")`,
+		},
+		{
+			"and or",
+			`(set x 1) (print (and 'T (= x 1)) (or (= 1 2) 'T (= x 1)))`,
+			`(set x 1) (print (and (= x 1)) 'T)`,
+		},
+		{
+			"inline",
+			`(def sq (x) (* x x)) (set y 3) (print (sq y) (sq 4))`,
+			`(set y 3) (print (* y y) 16)`,
+		},
+		{
+			"do not inline recursive function",
+			`(def fact (n) (if (= n 0) 1 (* n (fact (- n 1))))) (print (fact 5))`,
+			`(print (fact 5))`,
+		},
+		{
+			"do not inline complex arguments",
+			`(def sq (x) (* x x)) (def num (n:int) n) (print (sq (num 2)))`,
+			`(print (sq (num 2)))`,
+		},
+		{
+			"do not inline shadowed names",
+			`(def inc2 (x) (+ x y)) (set y 2) (print (inc2 y))`,
+			`(set y 2) (print (inc2 y))`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := NewInterpreter(ioutil.Discard)
+			if err := in.Parse("__test__", strings.NewReader(test.code)); err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if warns := in.Optimize(); len(warns) > 0 {
+				t.Errorf("Unexpected warnings: %v", warns)
+			}
+			exp := NewInterpreter(ioutil.Discard)
+			if err := exp.Parse("__expected__", strings.NewReader(test.exp)); err != nil {
+				t.Fatalf("Parse() of expected code failed: %v", err)
+			}
+			if e, a := bodyString(exp.mainBody), bodyString(in.mainBody); e != a {
+				t.Errorf("Incorrect optimized code:\nexpected: %v\nactual:   %v", e, a)
+			}
+		})
+	}
+}
+
+func TestUnreachableClauses(t *testing.T) {
+	code := `(def f (0) "zero")
+(def f (n:int) "int")
+(def f (n) "any")
+(def f (1) "one")
+(def f (s:str) "str")
+(def g (a:any a:any) 'T)
+(def g (a:any b:any) 'F)
+(print (f 1) (g 1 2))`
+	in := NewInterpreter(ioutil.Discard)
+	if err := in.Parse("__test__", strings.NewReader(code)); err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	warns := in.Optimize()
+	exp := []string{
+		"__test__: f: clause 4 (1) can never match: clause 2 (n:int) matches first",
+		"__test__: f: clause 5 (s:str) can never match: clause 3 (n) matches first",
+	}
+	if len(warns) != len(exp) {
+		t.Fatalf("Expected %v warnings, found: %v", len(exp), warns)
+	}
+	for i, w := range warns {
+		if w.Error() != exp[i] {
+			t.Errorf("Incorrect warning:\nexpected: %v\nactual:   %v", exp[i], w)
+		}
+	}
+}
+
+func bodyString(body []types.Value) string {
+	items := make([]string, 0, len(body))
+	for _, st := range body {
+		items = append(items, fmt.Sprint(st.E))
+	}
+	return strings.Join(items, " ")
+}
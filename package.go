@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Packages are libraries installed by "spil pkg install" into "vendor/<name>"
+// directory of the project and recorded in the lock file "spil.lock":
+//
+//	(pkg "json" "1.2.0" "sha256:...")
+//
+// Installed package is used with (use pkg "json").
+
+const (
+	lockName   = "spil.lock"
+	vendorName = "vendor"
+)
+
+type lockEntry struct {
+	name     string
+	version  string
+	checksum string
+}
+
+func readLock(file string) ([]lockEntry, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ds, err := readDirectives(file, f)
+	if err != nil {
+		return nil, err
+	}
+	var entries []lockEntry
+	for _, d := range ds {
+		if d.name != "pkg" || len(d.args) != 3 {
+			return nil, fmt.Errorf("%v:%d: expected (pkg \"name\" \"version\" \"checksum\")", file, d.line)
+		}
+		entries = append(entries, lockEntry{name: d.args[0], version: d.args[1], checksum: d.args[2]})
+	}
+	return entries, nil
+}
+
+func writeLock(file string, entries []lockEntry) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "; Generated by \"spil pkg\", do not edit.\n")
+	for _, e := range entries {
+		fmt.Fprintf(b, "(pkg %q %q %q)\n", e.name, e.version, e.checksum)
+	}
+	return ioutil.WriteFile(file, b.Bytes(), 0644)
+}
+
+func findLockEntry(entries []lockEntry, name string) (lockEntry, bool) {
+	for _, e := range entries {
+		if e.name == name {
+			return e, true
+		}
+	}
+	return lockEntry{}, false
+}
+
+// packageChecksum returns hash of all files in the directory of installed package.
+func packageChecksum(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%x  %v\n", sha256.Sum256(data), filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// mainModule returns path of the entry module of the package relative to its directory.
+func (m *manifest) mainModule() string {
+	if m.main != "" {
+		return m.main
+	}
+	return m.name + ".lisp"
+}
+
+// (use pkg "name" [:as name] [:only (f g ...)])
+func (in *Interpret) usePackage(file, name string, opts []types.Value) error {
+	// bundled package files are "pkg:<name>/spil.mod" and "pkg:<name>/<main module>"
+	key := "pkg:" + name + "/"
+	if mdata, ok := in.embeddedModules[key+manifestName]; ok {
+		pm, err := parseManifest(key+manifestName, bytes.NewReader(mdata))
+		if err != nil {
+			return err
+		}
+		fpath := key + pm.mainModule()
+		return in.loadPackage(file, name, fpath, bytes.NewReader(in.embeddedModules[fpath]), pm, opts)
+	}
+	if in.manifest == nil {
+		return fmt.Errorf("Cannot use package %v: project manifest %v not found", name, manifestName)
+	}
+	entries, err := readLock(filepath.Join(in.manifest.root, lockName))
+	if err != nil {
+		return err
+	}
+	if _, ok := findLockEntry(entries, name); !ok {
+		return fmt.Errorf("Package %v is not installed (see \"spil pkg install\")", name)
+	}
+	dir := filepath.Join(in.manifest.root, vendorName, name)
+	mfile := filepath.Join(dir, manifestName)
+	mf, err := os.Open(mfile)
+	if err != nil {
+		return fmt.Errorf("Package %v is broken: %v", name, err)
+	}
+	defer mf.Close()
+	pm, err := parseManifest(mfile, mf)
+	if err != nil {
+		return err
+	}
+	fpath := filepath.Join(dir, pm.mainModule())
+	f, err := os.Open(fpath)
+	if err != nil {
+		return fmt.Errorf("Package %v is broken: %v", name, err)
+	}
+	defer f.Close()
+	in.usedModules[key+pm.mainModule()] = fpath
+	in.usedModules[key+manifestName] = mfile
+	return in.loadPackage(file, name, fpath, f, pm, opts)
+}
+
+func (in *Interpret) loadPackage(file, name, fpath string, r io.Reader, pm *manifest, opts []types.Value) error {
+	m, err := in.parseModule(fpath, r, func(m *module) error {
+		m.qualifier = name
+		// native bindings are functions of the package module
+		for local, builtin := range pm.natives {
+			fn, ok := in.funcs[builtin]
+			if !ok {
+				return fmt.Errorf("Package %v binds unknown builtin function %v", name, builtin)
+			}
+			if origin := in.funcsOrigins[builtin]; origin != "" && !strings.HasPrefix(origin, "library/") {
+				return fmt.Errorf("Package %v binds %v which is not a builtin function", name, builtin)
+			}
+			global := m.name + "." + local
+			in.funcs[global] = fn
+			if _, ok := fn.(*FuncInterpret); !ok {
+				in.nativeBindings[global] = builtin
+			}
+			in.funcsOrigins[global] = fpath
+			m.funcs[local] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return in.importModule(file, m, opts)
+}
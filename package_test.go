@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spil-pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"project/spil.mod": `(src "src")`,
+		"project/src/main.lisp": `(use pkg "json")
+(use pkg "text" :as t)
+(print (encode "a") (size '(1 2 3)) (t.shout "b"))`,
+		"json/spil.mod": `(name "json")
+(version "1.2.0")
+(native "size" "native.length")`,
+		"json/json.lisp":       `(use "quote.lisp") (def encode (s) (quote s))`,
+		"json/quote.lisp":      `(def quote (s) (append "\"" s "\""))`,
+		"json/README":          `not installed`,
+		"plugged/spil.mod":     `(name "plugged") (version "0.1")`,
+		"plugged/plugged.lisp": ``,
+		"plugged/native.so":    `binary`,
+	}
+	for name, code := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive := filepath.Join(dir, "text-0.3.tar.gz")
+	writeTarGz(t, archive, map[string]string{
+		"text-0.3/spil.mod":      `(name "text") (version "0.3") (main "src/text.lisp")`,
+		"text-0.3/src/text.lisp": `(def shout (s) (append s "!"))`,
+	})
+
+	root := filepath.Join(dir, "project")
+	main := filepath.Join(root, "src/main.lisp")
+	in := NewInterpreter(ioutil.Discard)
+	if err := run(in, main, strings.NewReader(files["project/src/main.lisp"]), true); err == nil ||
+		!strings.Contains(err.Error(), "Package json is not installed") {
+		t.Errorf("Expected error about not installed package, found %v", err)
+	}
+
+	if _, err := installPackage(root, filepath.Join(dir, "json")); err != nil {
+		t.Fatalf("install json failed: %v", err)
+	}
+	if _, err := installPackage(root, archive); err != nil {
+		t.Fatalf("install text failed: %v", err)
+	}
+	if _, err := installPackage(root, filepath.Join(dir, "plugged")); err == nil || !strings.Contains(err.Error(), "contains Go plugin native.so") {
+		t.Errorf("Expected error about Go plugin, found %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vendor/json/README")); !os.IsNotExist(err) {
+		t.Errorf("Only modules should be installed, found README: %v", err)
+	}
+
+	entries, err := readLock(filepath.Join(root, lockName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].name != "json" || entries[0].version != "1.2.0" ||
+		entries[1].name != "text" || entries[1].version != "0.3" || !strings.HasPrefix(entries[1].checksum, "sha256:") {
+		t.Errorf("Incorrect lock entries: %+v", entries)
+	}
+
+	stdout := &bytes.Buffer{}
+	in = NewInterpreter(stdout)
+	if err := run(in, main, strings.NewReader(files["project/src/main.lisp"]), true); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if exp, act := "\"a\" 3 b!\n", stdout.String(); act != exp {
+		t.Errorf("Incorrect output: expected %q, actual %q", exp, act)
+	}
+
+	if errs, err := verifyPackages(root); err != nil || len(errs) > 0 {
+		t.Errorf("verify failed: %v %v", errs, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "vendor/json/quote.lisp"), []byte(`(def quote (s) s)`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if errs, err := verifyPackages(root); err != nil || len(errs) != 1 || !strings.HasPrefix(errs[0], "json: checksum mismatch") {
+		t.Errorf("Expected checksum mismatch of json, found %v %v", errs, err)
+	}
+
+	if err := removePackage(root, "text"); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if entries, _ := readLock(filepath.Join(root, lockName)); len(entries) != 1 || entries[0].name != "json" {
+		t.Errorf("Incorrect lock entries after remove: %+v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vendor/text")); !os.IsNotExist(err) {
+		t.Errorf("Package directory is not removed: %v", err)
+	}
+}
+
+func writeTarGz(t *testing.T, file string, files map[string]string) {
+	b := &bytes.Buffer{}
+	z := gzip.NewWriter(b)
+	w := tar.NewWriter(z)
+	for name, data := range files {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
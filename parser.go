@@ -22,6 +22,13 @@ type NumberParser interface {
 type Parser struct {
 	scanner *bufio.Scanner
 	tokens  []string
+	// columns where tokens start
+	cols []int
+	// source file and number of the line tokens are read from
+	file string
+	line int
+	// column of the last read token
+	col int
 
 	numberParser NumberParser
 }
@@ -41,7 +48,7 @@ func (p *Parser) NextExpr(quoted bool) (*types.Value, error) {
 		return nil, err
 	}
 	if token == "(" || token == "'(" || token == "\\(" {
-		item, err := p.nextSexpr(token, quoted || token == "'(")
+		item, err := p.nextSexpr(token, quoted || token == "'(", p.line, p.col)
 		if err != nil {
 			return nil, err
 		}
@@ -50,7 +57,7 @@ func (p *Parser) NextExpr(quoted bool) (*types.Value, error) {
 	return p.tokenParam(token), nil
 }
 
-func (p *Parser) nextSexpr(leftBrace string, quoted bool) (*types.Value, error) {
+func (p *Parser) nextSexpr(leftBrace string, quoted bool, line, col int) (*types.Value, error) {
 	var list []types.Value
 	for {
 		token, err := p.nextToken()
@@ -64,7 +71,7 @@ func (p *Parser) nextSexpr(leftBrace string, quoted bool) (*types.Value, error)
 			break
 		}
 		if token == "(" || token == "'(" || token == "\\(" {
-			item, err := p.nextSexpr(token, quoted || token == "'(")
+			item, err := p.nextSexpr(token, quoted || token == "'(", p.line, p.col)
 			if err != nil {
 				return nil, err
 			}
@@ -79,6 +86,9 @@ func (p *Parser) nextSexpr(leftBrace string, quoted bool) (*types.Value, error)
 		List:   list,
 		Quoted: quoted || leftBrace == "'(",
 		Lambda: leftBrace == "\\(",
+		File:   p.file,
+		Line:   line,
+		Col:    col,
 	}, T: types.TypeList}, nil
 }
 
@@ -108,6 +118,8 @@ func (p *Parser) nextToken() (string, error) {
 	}
 	token := p.tokens[0]
 	p.tokens = p.tokens[1:]
+	p.col = p.cols[0]
+	p.cols = p.cols[1:]
 	return token, nil
 }
 
@@ -118,16 +130,45 @@ func (p *Parser) prepareTokens() error {
 		}
 		return io.EOF
 	}
-	line := strings.TrimSpace(p.scanner.Text())
+	p.line++
+	// executable scripts start with "#!/usr/bin/env spil"
+	if p.line == 1 && strings.HasPrefix(p.scanner.Text(), "#!") {
+		return p.prepareTokens()
+	}
+	text := p.scanner.Text()
+	line := strings.TrimSpace(text)
 	if line == "" || line[0] == '#' || line[0] == ';' {
 		return p.prepareTokens()
 	}
+	p.tokens, p.cols = tokenizeLineCols(line)
+	// columns are 1-based and counted from the beginning of untrimmed line
+	indent := len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace)) + 1
+	for i := range p.cols {
+		p.cols[i] += indent
+	}
+	return nil
+}
 
+// tokenizeLine splits trimmed non-comment line into tokens.
+func tokenizeLine(line string) []string {
+	tokens, _ := tokenizeLineCols(line)
+	return tokens
+}
+
+// tokenizeLineCols splits line into tokens and returns byte offsets where tokens start.
+func tokenizeLineCols(line string) (tokens []string, cols []int) {
 	var token string
-	var tokens []string
+	start := 0
+	push := func(tok string, col int) {
+		tokens = append(tokens, tok)
+		cols = append(cols, col)
+	}
 	inQuotes := false
 	backslash := false
-	for _, r := range line {
+	for i, r := range line {
+		if token == "" {
+			start = i
+		}
 		if backslash {
 			token += `\` + string(r)
 			backslash = false
@@ -138,7 +179,7 @@ func (p *Parser) prepareTokens() error {
 				token += string(r)
 				if r == '"' {
 					inQuotes = false
-					tokens = append(tokens, token)
+					push(token, start)
 					token = ""
 				}
 			}
@@ -149,35 +190,35 @@ func (p *Parser) prepareTokens() error {
 			if inQuotes {
 				token += string(r)
 			} else if token != "" {
-				tokens = append(tokens, token)
+				push(token, start)
 				token = ""
 			}
 		} else if r == '(' {
 			if token == "'" {
-				tokens = append(tokens, "'(")
+				push("'(", start)
 			} else if token == "\\" {
-				tokens = append(tokens, `\(`)
+				push(`\(`, start)
 			} else if token != "" {
-				tokens = append(tokens, token, "(")
+				push(token, start)
+				push("(", i)
 			} else {
-				tokens = append(tokens, "(")
+				push("(", i)
 			}
 			token = ""
 		} else if r == ')' {
 			if token != "" {
-				tokens = append(tokens, token)
+				push(token, start)
 				token = ""
 			}
-			tokens = append(tokens, ")")
+			push(")", i)
 		} else {
 			token += string(r)
 		}
 	}
 	if token != "" {
-		tokens = append(tokens, token)
+		push(token, start)
 	}
-	p.tokens = tokens
-	return nil
+	return tokens, cols
 }
 
 type defaultNumberParser struct{}
@@ -23,6 +23,7 @@ func TestNextToken(t *testing.T) {
 		{`"foo \" bar"`, []string{`"foo \" bar"`}},
 		{`(print "hello \"world\"" )`, []string{"(", "print", `"hello \"world\""`, ")"}},
 		{"(hello)\ntrue\n#vim ft=lisp", []string{"(", "hello", ")", "true"}},
+		{"#!/usr/bin/env spil -b\n(hello)", []string{"(", "hello", ")"}},
 		{`\(foo bar)`, []string{`\(`, "foo", "bar", ")"}},
 		{`"(set n (get-int) :int)"`, []string{`"(set n (get-int) :int)"`}},
 	}
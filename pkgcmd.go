@@ -0,0 +1,317 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// "spil pkg" installs libraries into the vendor directory of the project.
+
+func pkgCommand(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  spil pkg install <dir|archive.tar.gz>...  install packages into vendor/
+  spil pkg list                             list installed packages
+  spil pkg remove <name>...                 remove installed packages
+  spil pkg verify                           check installed packages against spil.lock
+`)
+	}
+	if len(args) < 1 {
+		usage()
+		return 2
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	m, err := findManifest(wd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if m == nil {
+		fmt.Fprintf(os.Stderr, "Project manifest %v not found, create it in the root directory of the project\n", manifestName)
+		return 1
+	}
+	root := m.root
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "install":
+		if len(args) == 0 {
+			usage()
+			return 2
+		}
+		for _, src := range args {
+			e, err := installPackage(root, src)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return 1
+			}
+			fmt.Printf("Installed %v %v\n", e.name, e.version)
+		}
+	case "list":
+		entries, err := readLock(filepath.Join(root, lockName))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		for _, e := range entries {
+			fmt.Printf("%v %v %v\n", e.name, e.version, e.checksum)
+		}
+	case "remove":
+		if len(args) == 0 {
+			usage()
+			return 2
+		}
+		for _, name := range args {
+			if err := removePackage(root, name); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return 1
+			}
+		}
+	case "verify":
+		errs, err := verifyPackages(root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+		}
+		if len(errs) > 0 {
+			return 1
+		}
+	default:
+		usage()
+		return 2
+	}
+	return 0
+}
+
+// installPackage copies package from directory or tar archive into vendor directory of the project.
+func installPackage(root, src string) (lockEntry, error) {
+	st, err := os.Stat(src)
+	if err != nil {
+		return lockEntry{}, err
+	}
+	dir := src
+	if !st.IsDir() {
+		tmp, err := ioutil.TempDir("", "spil-pkg")
+		if err != nil {
+			return lockEntry{}, err
+		}
+		defer os.RemoveAll(tmp)
+		if err := extractTar(src, tmp); err != nil {
+			return lockEntry{}, fmt.Errorf("Cannot extract %v: %v", src, err)
+		}
+		if dir, err = findPackageRoot(tmp); err != nil {
+			return lockEntry{}, fmt.Errorf("%v: %v", src, err)
+		}
+	}
+	mfile := filepath.Join(dir, manifestName)
+	f, err := os.Open(mfile)
+	if err != nil {
+		return lockEntry{}, fmt.Errorf("%v is not a package: %v", src, err)
+	}
+	pm, err := parseManifest(mfile, f)
+	f.Close()
+	if err != nil {
+		return lockEntry{}, err
+	}
+	if pm.name == "" || pm.version == "" {
+		return lockEntry{}, fmt.Errorf("%v: package name and version are required", mfile)
+	}
+	if strings.ContainsAny(pm.name, `/\:`) || pm.name == "." || pm.name == ".." {
+		return lockEntry{}, fmt.Errorf("%v: incorrect package name %q", mfile, pm.name)
+	}
+	if _, err := os.Stat(filepath.Join(dir, pm.mainModule())); err != nil {
+		return lockEntry{}, fmt.Errorf("Package %v: main module not found: %v", pm.name, err)
+	}
+
+	var files []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case filepath.Ext(path) == ".so":
+			return fmt.Errorf("Package %v contains Go plugin %v: only .lisp modules and native bindings are supported", pm.name, rel)
+		case filepath.Ext(path) == ".lisp" || rel == manifestName:
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return lockEntry{}, err
+	}
+
+	target := filepath.Join(root, vendorName, pm.name)
+	if err := os.RemoveAll(target); err != nil {
+		return lockEntry{}, err
+	}
+	for _, rel := range files {
+		if err := copyFile(filepath.Join(dir, rel), filepath.Join(target, rel)); err != nil {
+			return lockEntry{}, err
+		}
+	}
+	sum, err := packageChecksum(target)
+	if err != nil {
+		return lockEntry{}, err
+	}
+	e := lockEntry{name: pm.name, version: pm.version, checksum: sum}
+	lock := filepath.Join(root, lockName)
+	entries, err := readLock(lock)
+	if err != nil {
+		return lockEntry{}, err
+	}
+	var updated []lockEntry
+	for _, old := range entries {
+		if old.name != e.name {
+			updated = append(updated, old)
+		}
+	}
+	return e, writeLock(lock, append(updated, e))
+}
+
+func removePackage(root, name string) error {
+	lock := filepath.Join(root, lockName)
+	entries, err := readLock(lock)
+	if err != nil {
+		return err
+	}
+	if _, ok := findLockEntry(entries, name); !ok {
+		return fmt.Errorf("Package %v is not installed", name)
+	}
+	if err := os.RemoveAll(filepath.Join(root, vendorName, name)); err != nil {
+		return err
+	}
+	var updated []lockEntry
+	for _, e := range entries {
+		if e.name != name {
+			updated = append(updated, e)
+		}
+	}
+	return writeLock(lock, updated)
+}
+
+// verifyPackages returns descriptions of installed packages which do not match the lock file.
+func verifyPackages(root string) ([]string, error) {
+	entries, err := readLock(filepath.Join(root, lockName))
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for _, e := range entries {
+		dir := filepath.Join(root, vendorName, e.name)
+		if _, err := os.Stat(dir); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: not installed", e.name))
+			continue
+		}
+		sum, err := packageChecksum(dir)
+		if err != nil {
+			return nil, err
+		}
+		if sum != e.checksum {
+			errs = append(errs, fmt.Sprintf("%v: checksum mismatch: expected %v, found %v", e.name, e.checksum, sum))
+		}
+	}
+	return errs, nil
+}
+
+// findPackageRoot returns the least nested directory containing spil.mod.
+func findPackageRoot(dir string) (string, error) {
+	queue := []string{dir}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		if _, err := os.Stat(filepath.Join(d, manifestName)); err == nil {
+			return d, nil
+		}
+		infos, err := ioutil.ReadDir(d)
+		if err != nil {
+			return "", err
+		}
+		for _, info := range infos {
+			if info.IsDir() {
+				queue = append(queue, filepath.Join(d, info.Name()))
+			}
+		}
+	}
+	return "", fmt.Errorf("%v not found", manifestName)
+}
+
+// extractTar extracts .tar, .tar.gz or .tgz archive into the directory.
+func extractTar(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(archive, ".gz") || strings.HasSuffix(archive, ".tgz") {
+		z, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		r = z
+	}
+	t := tar.NewReader(r)
+	for {
+		hdr, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("incorrect file name in archive: %v", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(filepath.Join(dir, name), t); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func copyFile(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeFile(dst, f)
+}
+
+func writeFile(file string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// Profile in pprof format (github.com/google/pprof/proto/profile.proto)
+// with spil functions as frames, so it can be analyzed with "go tool pprof".
+// Every call stack is written as a sample with number of calls and self time.
+
+// Field numbers of profile.proto messages.
+const (
+	pprofSampleType    = 1
+	pprofSample        = 2
+	pprofLocation      = 4
+	pprofFunction      = 5
+	pprofStringTable   = 6
+	pprofTimeNanos     = 9
+	pprofDurationNanos = 10
+	pprofPeriodType    = 11
+	pprofPeriod        = 12
+)
+
+// protoBuffer encodes protobuf messages.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	b.data = append(b.data, buf[:n]...)
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) uint64(field int, x uint64) {
+	b.key(field, 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) message(field int, m *protoBuffer) {
+	b.bytes(field, m.data)
+}
+
+func (b *protoBuffer) packed(field int, xs []uint64) {
+	p := &protoBuffer{}
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.bytes(field, p.data)
+}
+
+// WriteProfile writes collected profile in gzipped pprof format.
+func (in *Interpret) WriteProfile(w io.Writer) error {
+	p := in.prof
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) uint64 {
+		if i, ok := strs[s]; ok {
+			return uint64(i)
+		}
+		strs[s] = len(table)
+		table = append(table, s)
+		return uint64(len(table) - 1)
+	}
+	valueType := func(typ, unit string) *protoBuffer {
+		m := &protoBuffer{}
+		m.uint64(1, str(typ))
+		m.uint64(2, str(unit))
+		return m
+	}
+
+	b := &protoBuffer{}
+	b.message(pprofSampleType, valueType("calls", "count"))
+	b.message(pprofSampleType, valueType("time", "nanoseconds"))
+
+	var walk func(n *stackNode, stack []uint64)
+	walk = func(n *stackNode, stack []uint64) {
+		if n.fn != nil {
+			// leaf goes first
+			stack = append([]uint64{uint64(n.fn.id)}, stack...)
+			s := &protoBuffer{}
+			s.packed(1, stack)
+			s.packed(2, []uint64{uint64(n.calls), uint64(n.self)})
+			b.message(pprofSample, s)
+		}
+		for _, fp := range p.order {
+			if c, ok := n.children[fp]; ok {
+				walk(c, stack)
+			}
+		}
+	}
+	walk(p.root, nil)
+
+	for _, fp := range p.order {
+		// location and function have the same id
+		line := &protoBuffer{}
+		line.uint64(1, uint64(fp.id))
+		line.int64(2, int64(fp.Line))
+		loc := &protoBuffer{}
+		loc.uint64(1, uint64(fp.id))
+		loc.message(4, line)
+		b.message(pprofLocation, loc)
+
+		fn := &protoBuffer{}
+		fn.uint64(1, uint64(fp.id))
+		fn.uint64(2, str(fp.Name))
+		fn.uint64(3, str(fp.Name))
+		fn.uint64(4, str(fp.File))
+		fn.int64(5, int64(fp.Line))
+		b.message(pprofFunction, fn)
+	}
+	b.int64(pprofTimeNanos, p.start.UnixNano())
+	b.int64(pprofDurationNanos, int64(time.Since(p.start)))
+	b.message(pprofPeriodType, valueType("calls", "count"))
+	b.int64(pprofPeriod, 1)
+	// string table should be the last as strings are added above
+	for _, s := range table {
+		b.bytes(pprofStringTable, []byte(s))
+	}
+
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(b.data); err != nil {
+		return err
+	}
+	return z.Close()
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Profiler of spil functions (see "spil -stat" and "spil -pprof").
+//
+// FuncInterpret.Eval enters and leaves frames, bind (both tree-walking and VM) reports matched clauses,
+// tail-call iterations and memo hits, LazyList reports forcing of elements.
+// Time of tail-call iterations is attributed to the clause matched on the function entry.
+
+type profiler struct {
+	start time.Time
+	funcs map[*FuncInterpret]*funcProfile
+	// lambdas created at the same place share the profile
+	byName map[string]*funcProfile
+	order  []*funcProfile
+	stack  []*profFrame
+	// root of the tree of call stacks
+	root *stackNode
+}
+
+type funcProfile struct {
+	id   int
+	Name string
+	File string
+	Line int
+
+	Calls      int
+	TailCalls  int
+	MemoHits   int
+	MemoMisses int
+	Forced     int
+	Self       time.Duration
+	Cum        time.Duration
+	Clauses    []*clauseProfile
+	// number of active frames, cumulative time is counted for the outermost one
+	depth int
+}
+
+type clauseProfile struct {
+	Name  string
+	Calls int
+	Self  time.Duration
+	Cum   time.Duration
+	depth int
+}
+
+type profFrame struct {
+	fn       *funcProfile
+	clause   *clauseProfile
+	start    time.Time
+	children time.Duration
+	node     *stackNode
+}
+
+// stackNode is a call stack: its function and the caller's node.
+type stackNode struct {
+	fn       *funcProfile
+	parent   *stackNode
+	children map[*funcProfile]*stackNode
+	calls    int64
+	self     time.Duration
+}
+
+// EnableProfiling starts collecting profile of function calls.
+func (in *Interpret) EnableProfiling() {
+	in.prof = &profiler{
+		start:  time.Now(),
+		funcs:  make(map[*FuncInterpret]*funcProfile),
+		byName: make(map[string]*funcProfile),
+		root:   &stackNode{children: make(map[*funcProfile]*stackNode)},
+	}
+}
+
+func (p *profiler) function(fi *FuncInterpret) *funcProfile {
+	if fp, ok := p.funcs[fi]; ok {
+		return fp
+	}
+	name, file, line := fi.position()
+	fp, ok := p.byName[name]
+	if !ok {
+		fp = &funcProfile{id: len(p.order) + 1, Name: name, File: file, Line: line}
+		p.byName[name] = fp
+		p.order = append(p.order, fp)
+	}
+	for len(fp.Clauses) < len(fi.bodies) {
+		fp.Clauses = append(fp.Clauses, &clauseProfile{Name: argfmtString(fi.bodies[len(fp.Clauses)].argfmt)})
+	}
+	p.funcs[fi] = fp
+	return fp
+}
+
+func (p *profiler) enter(fi *FuncInterpret) {
+	fp := p.function(fi)
+	fp.Calls++
+	fp.depth++
+	parent := p.root
+	if len(p.stack) > 0 {
+		parent = p.stack[len(p.stack)-1].node
+	}
+	node, ok := parent.children[fp]
+	if !ok {
+		node = &stackNode{fn: fp, parent: parent, children: make(map[*funcProfile]*stackNode)}
+		parent.children[fp] = node
+	}
+	node.calls++
+	p.stack = append(p.stack, &profFrame{fn: fp, start: time.Now(), node: node})
+}
+
+func (p *profiler) leave() {
+	fr := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	elapsed := time.Since(fr.start)
+	self := elapsed - fr.children
+	fr.fn.Self += self
+	fr.node.self += self
+	fr.fn.depth--
+	if fr.fn.depth == 0 {
+		fr.fn.Cum += elapsed
+	}
+	if c := fr.clause; c != nil {
+		c.Self += self
+		c.depth--
+		if c.depth == 0 {
+			c.Cum += elapsed
+		}
+	}
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].children += elapsed
+	}
+}
+
+// bound is called when clause idx of function is matched.
+func (p *profiler) bound(fi *FuncInterpret, idx int) {
+	if len(p.stack) == 0 {
+		return
+	}
+	fr := p.stack[len(p.stack)-1]
+	fp := p.function(fi)
+	if fr.fn != fp {
+		return
+	}
+	c := fp.Clauses[idx]
+	c.Calls++
+	if fr.clause != nil {
+		fp.TailCalls++
+		return
+	}
+	fr.clause = c
+	c.depth++
+}
+
+func (p *profiler) memo(fi *FuncInterpret, hit bool) {
+	fp := p.function(fi)
+	if hit {
+		fp.MemoHits++
+	} else {
+		fp.MemoMisses++
+	}
+}
+
+func (p *profiler) forced(fi *FuncInterpret) {
+	p.function(fi).Forced++
+}
+
+// Stat prints profile of function calls sorted by self time.
+func (in *Interpret) Stat(w io.Writer) {
+	p := in.prof
+	if p == nil {
+		return
+	}
+	fps := append([]*funcProfile{}, p.order...)
+	sort.SliceStable(fps, func(i, j int) bool {
+		return fps[i].Self > fps[j].Self
+	})
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Calls\tTail calls\tSelf\tSelf%%\tCum\tMemo hit/miss\tForced\t  Function\n")
+	total := time.Since(p.start)
+	for _, fp := range fps {
+		if fp.Calls == 0 && fp.Forced == 0 {
+			continue
+		}
+		memo := ""
+		if fp.MemoHits+fp.MemoMisses > 0 {
+			memo = fmt.Sprintf("%d/%d", fp.MemoHits, fp.MemoMisses)
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%v\t%.1f%%\t%v\t%v\t%d\t  %v\n",
+			fp.Calls, fp.TailCalls, fp.Self.Round(time.Microsecond), percentOf(fp.Self, total),
+			fp.Cum.Round(time.Microsecond), memo, fp.Forced, fp.Name)
+		if len(fp.Clauses) < 2 {
+			continue
+		}
+		for _, c := range fp.Clauses {
+			fmt.Fprintf(tw, "%d\t\t%v\t%.1f%%\t%v\t\t\t    %v\n",
+				c.Calls, c.Self.Round(time.Microsecond), percentOf(c.Self, total), c.Cum.Round(time.Microsecond), c.Name)
+		}
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "Total time: %v\n", total.Round(time.Microsecond))
+}
+
+func percentOf(d, total time.Duration) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(d) / float64(total)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	code := `(def sum (acc 0) acc)
+(def sum (acc n) (sum (+ acc n) (- n 1)))
+(def' fib (n) :int (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2)))))
+(def nat (n) (gen \(list _1 (+ _1 1)) n))
+(print (sum 0 10) (fib 10) (head (tail (tail (nat 1)))))
+`
+	for _, vm := range []bool{false, true} {
+		in := NewInterpreter(ioutil.Discard)
+		if err := in.Parse("prog.lisp", strings.NewReader(code)); err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if err, _ := in.Check(); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if vm {
+			in.Compile()
+		}
+		in.EnableProfiling()
+		if err := in.RunArgs(nil); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		sum := in.prof.byName["sum"]
+		if sum.Calls != 1 || sum.TailCalls != 10 || sum.Clauses[0].Calls != 1 || sum.Clauses[1].Calls != 10 {
+			t.Errorf("vm=%v: incorrect profile of sum: calls %d, tail calls %d, clauses %d/%d",
+				vm, sum.Calls, sum.TailCalls, sum.Clauses[0].Calls, sum.Clauses[1].Calls)
+		}
+		fib := in.prof.byName["fib"]
+		if fib.MemoMisses != 11 || fib.MemoHits != 8 {
+			t.Errorf("vm=%v: incorrect memo hit/miss of fib: %d/%d", vm, fib.MemoHits, fib.MemoMisses)
+		}
+		lambda := in.prof.byName["lambda prog.lisp:4"]
+		if lambda == nil || lambda.Forced != 3 {
+			t.Errorf("vm=%v: incorrect profile of lambda: %+v", vm, lambda)
+		}
+
+		stat := &bytes.Buffer{}
+		in.Stat(stat)
+		for _, s := range []string{"Tail calls", "  sum\n", "    (acc 0)\n", "8/11", "Total time: "} {
+			if !strings.Contains(stat.String(), s) {
+				t.Errorf("vm=%v: %q not found in stat:\n%v", vm, s, stat)
+			}
+		}
+
+		prof := &bytes.Buffer{}
+		if err := in.WriteProfile(prof); err != nil {
+			t.Fatalf("WriteProfile failed: %v", err)
+		}
+		z, err := gzip.NewReader(prof)
+		if err != nil {
+			t.Fatalf("Incorrect gzip data: %v", err)
+		}
+		data, err := ioutil.ReadAll(z)
+		if err != nil {
+			t.Fatalf("Incorrect gzip data: %v", err)
+		}
+		for _, s := range []string{"calls", "nanoseconds", "fib", "prog.lisp"} {
+			if !bytes.Contains(data, []byte(s)) {
+				t.Errorf("vm=%v: %q not found in profile", vm, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Property-based testing enabled with (use quickcheck).
+//
+// (forall (x:int lst:list[int]) property...) is rewritten at parse time into
+// (qc.forall '(x:int lst:list[int]) (lambda (set x _1 :int) (set lst _2 :list[int]) property...)),
+// so the property can use variables of the enclosing function.
+
+const (
+	quickcheckTests   = 100
+	quickcheckMaxSize = 100
+	quickcheckShrinks = 1000
+	quickcheckDepth   = 3
+)
+
+// quickcheckSeedEnv overrides the seed used to generate values.
+const quickcheckSeedEnv = "QUICKCHECK_SEED"
+
+// (use quickcheck [:seed N])
+func (in *Interpret) useQuickcheck(args []types.Value) error {
+	in.quickcheck = true
+	if len(args) == 0 {
+		return nil
+	}
+	if len(args) != 2 || args[0].E != types.Ident(":seed") {
+		return fmt.Errorf("'use quickcheck' expects optional ':seed N', found: %v", args)
+	}
+	seed, ok := args[1].E.(types.Int)
+	if !ok {
+		return fmt.Errorf("'use quickcheck' expects integer seed, found: %v", args[1])
+	}
+	in.quickcheckSeed = seed.Int64()
+	return nil
+}
+
+func (in *Interpret) newQuickcheckSeed() (int64, error) {
+	if s := os.Getenv(quickcheckSeedEnv); s != "" {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Incorrect %v: %v", quickcheckSeedEnv, err)
+		}
+		return seed, nil
+	}
+	if in.quickcheckSeed != 0 {
+		return in.quickcheckSeed, nil
+	}
+	return time.Now().UnixNano(), nil
+}
+
+// expandForall rewrites forall forms in the expression.
+func (in *Interpret) expandForall(v types.Value) (types.Value, error) {
+	se, ok := v.E.(*types.Sexpr)
+	if !ok || se.Quoted || se.Length() == 0 {
+		return v, nil
+	}
+	list := make([]types.Value, 0, len(se.List))
+	changed := false
+	for _, item := range se.List {
+		expanded, err := in.expandForall(item)
+		if err != nil {
+			return v, err
+		}
+		if ise, ok := item.E.(*types.Sexpr); ok && expanded.E != types.Expr(ise) {
+			changed = true
+		}
+		list = append(list, expanded)
+	}
+	if head, ok := list[0].E.(types.Ident); !ok || head != "forall" || se.Lambda {
+		// forms without forall are kept as is
+		if !changed {
+			return v, nil
+		}
+		return types.Value{E: &types.Sexpr{List: list, Quoted: se.Quoted, Lambda: se.Lambda, File: se.File, Line: se.Line, Col: se.Col}, T: v.T}, nil
+	}
+	// (forall [count] (args...) body...)
+	args := list[1:]
+	var count types.Value
+	if len(args) > 0 {
+		if _, ok := args[0].E.(types.Int); ok {
+			count, args = args[0], args[1:]
+		}
+	}
+	if len(args) < 2 {
+		return v, fmt.Errorf("forall expects arguments and property, found: %v", se)
+	}
+	spec, ok := args[0].E.(*types.Sexpr)
+	if !ok || spec.Empty() {
+		return v, fmt.Errorf("forall expects list of arguments, found: %v", args[0])
+	}
+	argfmt, err := ParseArgFmt(spec)
+	if err != nil {
+		return v, fmt.Errorf("forall: %v", err)
+	}
+	lambda := []types.Value{{E: types.Ident("lambda")}}
+	for i, arg := range argfmt.Args {
+		if arg.Name == "" {
+			return v, fmt.Errorf("forall expects named arguments, found: %v", spec)
+		}
+		set := []types.Value{
+			{E: types.Ident("set")},
+			{E: types.Ident(arg.Name)},
+			{E: types.Ident(fmt.Sprintf("_%d", i+1))},
+		}
+		if arg.T != types.TypeUnknown {
+			set = append(set, types.Value{E: types.Ident(arg.T.String())})
+		}
+		lambda = append(lambda, types.Value{E: &types.Sexpr{List: set}})
+	}
+	lambda = append(lambda, args[1:]...)
+	call := []types.Value{
+		{E: types.Ident("qc.forall")},
+		{E: &types.Sexpr{List: spec.List, Quoted: true}, T: types.TypeList},
+		{E: &types.Sexpr{List: lambda, File: se.File, Line: se.Line, Col: se.Col}},
+	}
+	if count.E != nil {
+		call = append(call, count)
+	}
+	return types.Value{E: &types.Sexpr{List: call, File: se.File, Line: se.Line, Col: se.Col}, T: v.T}, nil
+}
+
+// (qc.forall '(args...) property [count])
+func (in *Interpret) FForall(args []types.Value) (*types.Value, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("forall: expected arguments and property, found %v", args)
+	}
+	argfmt, err := ParseArgFmt(args[0].E)
+	if err != nil {
+		return nil, fmt.Errorf("forall: %v", err)
+	}
+	name, ok := args[1].E.(types.Ident)
+	if !ok {
+		return nil, fmt.Errorf("forall: expected property function, found %v", args[1])
+	}
+	fn, ok := in.funcs[string(name)]
+	if !ok {
+		return nil, fmt.Errorf("forall: unknown function: %v", name)
+	}
+	tests := quickcheckTests
+	if len(args) == 3 {
+		n, ok := args[2].E.(types.Int)
+		if !ok {
+			return nil, fmt.Errorf("forall: expected number of tests, found %v", args[2])
+		}
+		tests = int(n.Int64())
+	}
+	seed, err := in.newQuickcheckSeed()
+	if err != nil {
+		return nil, err
+	}
+	r := rand.New(rand.NewSource(seed))
+	spec := argfmtString(argfmt)
+	for test := 1; test <= tests; test++ {
+		size := test * quickcheckMaxSize / tests
+		params := make([]types.Value, 0, len(argfmt.Args))
+		for _, arg := range argfmt.Args {
+			v, err := in.generate(r, arg.T, size, quickcheckDepth)
+			if err != nil {
+				return nil, fmt.Errorf("forall %v: %v", spec, err)
+			}
+			params = append(params, v)
+		}
+		failure, err := checkProperty(fn, params)
+		if err != nil {
+			return nil, fmt.Errorf("forall %v: %v", spec, err)
+		}
+		if failure == "" {
+			continue
+		}
+		params, failure, shrinks, err := in.shrinkFailure(fn, params, failure)
+		if err != nil {
+			return nil, fmt.Errorf("forall %v: %v", spec, err)
+		}
+		b := &strings.Builder{}
+		fmt.Fprintf(b, "forall %v: falsified after %d tests and %d shrinks (seed %d):", spec, test, shrinks, seed)
+		for i, arg := range argfmt.Args {
+			fmt.Fprintf(b, "\n    %v = ", arg.Name)
+			printLiteral(b, params[i].E)
+		}
+		fmt.Fprintf(b, "\n%v", failure)
+		return nil, fmt.Errorf("%v", b)
+	}
+	return &types.Value{E: types.Bool(true), T: types.TypeBool}, nil
+}
+
+// checkProperty returns description of failure or empty string if property holds.
+// Error is returned if property does not return boolean.
+func checkProperty(fn types.Function, params []types.Value) (string, error) {
+	res, err := fn.Eval(params)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	b, ok := res.E.(types.Bool)
+	if !ok {
+		v := &strings.Builder{}
+		printLiteral(v, res.E)
+		return "", fmt.Errorf("property should return :bool, found %v (%v)", v, res.T)
+	}
+	if !b {
+		return "property is false", nil
+	}
+	return "", nil
+}
+
+// shrinkFailure looks for smaller parameters which still falsify the property.
+func (in *Interpret) shrinkFailure(fn types.Function, params []types.Value, failure string) ([]types.Value, string, int, error) {
+	shrinks := 0
+L:
+	for shrinks < quickcheckShrinks {
+		for i := range params {
+			for _, c := range in.shrink(params[i]) {
+				try := append([]types.Value{}, params...)
+				try[i] = c
+				f, err := checkProperty(fn, try)
+				if err != nil {
+					return nil, "", 0, err
+				}
+				if f != "" {
+					params, failure = try, f
+					shrinks++
+					continue L
+				}
+			}
+		}
+		break
+	}
+	return params, failure, shrinks, nil
+}
+
+const quickcheckChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 .,-_()\n"
+
+// generate returns random value of specified type.
+func (in *Interpret) generate(r *rand.Rand, t types.Type, size, depth int) (types.Value, error) {
+	t = in.UnaliasType(t)
+	switch t.Basic() {
+	case string(types.TypeInt):
+		return types.Value{E: in.intMaker.MakeInt(int64(r.Intn(2*size+1) - size)), T: types.TypeInt}, nil
+	case string(types.TypeFloat):
+		return types.Value{E: in.floatMaker.MakeFloat(r.NormFloat64() * float64(size)), T: types.TypeFloat}, nil
+	case string(types.TypeBool):
+		return types.Value{E: types.Bool(r.Intn(2) == 1), T: types.TypeBool}, nil
+	case string(types.TypeStr):
+		b := make([]byte, r.Intn(size+1))
+		for i := range b {
+			b[i] = quickcheckChars[r.Intn(len(quickcheckChars))]
+		}
+		return types.Value{E: types.Str(b), T: types.TypeStr}, nil
+	case string(types.TypeAny), string(types.TypeUnknown):
+		basic := []types.Type{types.TypeInt, types.TypeStr, types.TypeBool, "list[any]"}
+		if depth <= 0 {
+			basic = basic[:3]
+		}
+		return in.generate(r, basic[r.Intn(len(basic))], size, depth-1)
+	case "list", "args":
+		elem := types.TypeAny
+		if a := t.Arguments(); len(a) == 1 && len(a[0]) > 1 {
+			elem = types.Type(a[0])
+		}
+		n := 0
+		if depth > 0 {
+			n = r.Intn(size/2 + 1)
+		}
+		list := &types.Sexpr{Quoted: true}
+		for i := 0; i < n; i++ {
+			v, err := in.generate(r, elem, size, depth-1)
+			if err != nil {
+				return v, err
+			}
+			list.List = append(list.List, v)
+		}
+		return types.Value{E: list, T: t}, nil
+	case string(types.TypeFunc):
+		return types.Value{}, fmt.Errorf("cannot generate values of type %v", t)
+	}
+	// user-defined type: generate value of the parent type
+	parent, ok := in.types[t.Canonical()]
+	if !ok || parent == "" {
+		return types.Value{}, fmt.Errorf("cannot generate values of type %v", t)
+	}
+	binds := make(map[string]types.Type)
+	for i, a := range t.Arguments() {
+		binds[string(rune('a'+i))] = types.Type(a)
+	}
+	v, err := in.generate(r, parent.Expand(binds), size, depth)
+	if err != nil {
+		return v, err
+	}
+	v.T = t
+	return v, nil
+}
+
+// shrink returns values "smaller" than v, the most simple ones go first.
+func (in *Interpret) shrink(v types.Value) (res []types.Value) {
+	add := func(e types.Expr) {
+		res = append(res, types.Value{E: e, T: v.T})
+	}
+	switch a := v.E.(type) {
+	case types.Int:
+		n := a.Int64()
+		if n == 0 {
+			return nil
+		}
+		add(in.intMaker.MakeInt(0))
+		if n < 0 {
+			add(in.intMaker.MakeInt(-n))
+		}
+		h := n / 2
+		if h != 0 {
+			add(in.intMaker.MakeInt(h))
+		}
+		step := int64(1)
+		if n < 0 {
+			step = -1
+		}
+		if p := n - step; p != 0 && p != h {
+			add(in.intMaker.MakeInt(p))
+		}
+	case types.Float:
+		f := a.Float64()
+		if f == 0 {
+			return nil
+		}
+		add(in.floatMaker.MakeFloat(0))
+		if t := float64(int64(f)); t != f {
+			add(in.floatMaker.MakeFloat(t))
+		}
+		if h := f / 2; h != f && (h > 1e-3 || h < -1e-3) {
+			add(in.floatMaker.MakeFloat(h))
+		}
+	case types.Bool:
+		if a {
+			add(types.Bool(false))
+		}
+	case types.Str:
+		s := string(a)
+		if s == "" {
+			return nil
+		}
+		add(types.Str(""))
+		if len(s) > 1 {
+			add(types.Str(s[:len(s)/2]))
+			add(types.Str(s[len(s)/2:]))
+		}
+		for i := range s {
+			add(types.Str(s[:i] + s[i+1:]))
+		}
+		for i := range s {
+			if s[i] != 'a' {
+				add(types.Str(s[:i] + "a" + s[i+1:]))
+			}
+		}
+	case *types.Sexpr:
+		items := a.List
+		if len(items) == 0 {
+			return nil
+		}
+		list := func(l []types.Value) types.Expr {
+			return &types.Sexpr{List: l, Quoted: true}
+		}
+		add(list(nil))
+		if len(items) > 1 {
+			add(list(items[:len(items)/2]))
+			add(list(items[len(items)/2:]))
+		}
+		for i := range items {
+			add(list(append(append([]types.Value{}, items[:i]...), items[i+1:]...)))
+		}
+		for i := range items {
+			for _, c := range in.shrink(items[i]) {
+				l := append([]types.Value{}, items...)
+				l[i] = c
+				add(list(l))
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/avoronkov/spil/types"
+)
+
+func TestForall(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		err  string
+	}{
+		{"holds", `(forall (x:int y:int) (= (+ x y) (+ y x)))`, ""},
+		{"closure", `(set n 3) (forall (x:int) (= (- (+ x n) n) x))`, ""},
+		{"count", `(forall 10 (b:bool) (or b (not b)))`, ""},
+		{"shrink int", `(forall (x:int) (< x 7))`, "\n    x = 7\nproperty is false"},
+		{"shrink list", `(forall (l:list[int]) (= l '()))`, "\n    l = '(0)\nproperty is false"},
+		{"shrink str", `(forall (s:str) (= s ""))`, "\n    s = \"a\"\nproperty is false"},
+		{"error", `(forall (x:int) (= (zero x) 0))`, "\n    x = 1\nerror: "},
+		{"not bool", `(forall (x:int) x)`, "property should return :bool"},
+		{"seed", `(forall (x:int) (< x 0))`, "(seed 42)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := NewInterpreter(ioutil.Discard)
+			code := "(use quickcheck :seed 42)\n(def zero (0) 0)\n(deftest prop " + test.code + ")"
+			if err := in.Parse("test.lisp", strings.NewReader(code)); err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if errs, _ := in.Check(); len(errs) > 0 {
+				t.Fatalf("Check failed: %v", errs)
+			}
+			in.Compile()
+			_, err := in.tests[0].Eval(nil)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("Property failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Incorrect error: expected %q, found %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestForallKeepsPositions(t *testing.T) {
+	for _, code := range []string{
+		"(def f (x:int) x)\n(print\n  (f \"a\"))",
+		"(use quickcheck)\n(def f (x:int) x)\n(print\n  (f \"a\"))\n(deftest p (forall (x:int) (= x x)))",
+	} {
+		in := NewInterpreter(ioutil.Discard)
+		if err := in.Parse("test.lisp", strings.NewReader(code)); err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		errs, _ := in.Check()
+		if len(errs) != 1 {
+			t.Fatalf("Expected one error, found %v", errs)
+		}
+		d := newDiagnostic(severityError, errs[0])
+		if lines := strings.Count(code[:strings.Index(code, "(f \"a\")")], "\n") + 1; d.File != "test.lisp" || d.Line != lines || d.Column != 3 {
+			t.Errorf("Incorrect position of error in %q: %v:%v:%v", code, d.File, d.Line, d.Column)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	in := NewInterpreter(ioutil.Discard)
+	code := "(deftype :point :list[int]) (deftype :pair[a,b] :list[any])"
+	if err := in.Parse("test.lisp", strings.NewReader(code)); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for _, tp := range []types.Type{"int", "float", "str", "bool", "any", "list", "list[str]", "point", "pair[int,str]"} {
+		for i := 0; i < 20; i++ {
+			v, err := in.generate(r, tp, 10, quickcheckDepth)
+			if err != nil {
+				t.Fatalf("generate(%v) failed: %v", tp, err)
+			}
+			if ok, err := in.canConvertType(v.T, in.UnaliasType(tp)); !ok || err != nil {
+				t.Errorf("generate(%v) returned value of type %v: %v", tp, v.T, err)
+			}
+		}
+	}
+	if _, err := in.generate(r, "func", 10, quickcheckDepth); err == nil {
+		t.Errorf("generate(func) should fail")
+	}
+}
+
+func TestShrink(t *testing.T) {
+	in := NewInterpreter(ioutil.Discard)
+	tests := []struct {
+		value string
+		exp   []string
+	}{
+		{"0", nil},
+		{"10", []string{"0", "5", "9"}},
+		{"-3", []string{"0", "3", "-1", "-2"}},
+		{"'T", []string{"'F"}},
+		{`"ab"`, []string{`""`, `"a"`, `"b"`, `"b"`, `"a"`, `"aa"`}},
+		{"'(2)", []string{"'()", "'()", "'(0)", "'(1)"}},
+		{"'(1 2)", []string{"'()", "'(1)", "'(2)", "'(2)", "'(1)", "'(0 2)", "'(1 0)", "'(1 1)"}},
+	}
+	for _, test := range tests {
+		p := NewParser(strings.NewReader(test.value), in)
+		v, err := p.NextExpr(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var act []string
+		for _, s := range in.shrink(*v) {
+			b := &strings.Builder{}
+			printLiteral(b, s.E)
+			act = append(act, b.String())
+		}
+		if strings.Join(act, " ") != strings.Join(test.exp, " ") {
+			t.Errorf("Incorrect shrinks of %v: expected %v, found %v", test.value, test.exp, act)
+		}
+	}
+}
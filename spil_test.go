@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -8,27 +9,37 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/avoronkov/spil/golden"
 )
 
 func TestExamples(t *testing.T) {
-	inputs, err := filepath.Glob("examples/ex.*")
+	golden.Test(t, "examples", runInterpreter, golden.Int64, golden.Big, "no-vm", "no-opt", "no-opt-no-vm")
+}
+
+// runInterpreter runs script in golden.Int64 or golden.Big mode,
+// "no-vm" mode disables bytecode VM, "no-opt" mode disables optimizations.
+func runInterpreter(input, mode string) (*golden.Result, error) {
+	f, err := os.Open(input)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-
-	for _, test := range inputs {
-		for _, bigint := range []bool{false, true} {
-			name := test
-			if bigint {
-				name += "-big"
-			}
-			t.Run(name, func(t *testing.T) {
-				dir, file := filepath.Split(test)
-				output := filepath.Join(dir, "out"+file[2:])
-				checkInterpreter(t, test, output, bigint)
-			})
-		}
+	defer f.Close()
+	path, err := filepath.Abs(input)
+	if err != nil {
+		return nil, err
 	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	in := NewInterpreter(stdout)
+	in.Stderr = stderr
+	in.UseBigInt(mode == golden.Big)
+	res := &golden.Result{}
+	vm := mode != "no-vm" && mode != "no-opt-no-vm"
+	opt := mode != "no-opt" && mode != "no-opt-no-vm"
+	res.ExitCode = in.exitStatus(runOpt(in, path, f, vm, opt))
+	res.Stdout = stdout.Bytes()
+	res.Stderr = stderr.Bytes()
+	return res, nil
 }
 
 func TestBuiltin(t *testing.T) {
@@ -45,13 +56,13 @@ func TestBuiltin(t *testing.T) {
 			t.Run(name, func(t *testing.T) {
 				dir, file := filepath.Split(test)
 				output := filepath.Join(dir, "output."+file)
-				checkInterpreter(t, test, output, bigint)
+				checkInterpreter(t, test, output, bigint, true)
 			})
 		}
 	}
 }
 
-func checkInterpreter(t *testing.T, input, output string, bigint bool) {
+func checkInterpreter(t *testing.T, input, output string, bigint, vm bool) {
 	fin, err := os.Open(input)
 	if err != nil {
 		t.Fatalf("Cannot open input file: %v", err)
@@ -74,7 +85,7 @@ func checkInterpreter(t *testing.T, input, output string, bigint bool) {
 	if err != nil {
 		t.Fatalf("Abs(%v) failed: %v", input, err)
 	}
-	if err := run(in, inputPath, fin); err != nil {
+	if err := run(in, inputPath, fin, vm); err != nil {
 		t.Fatalf("Interpreter Run() failed: %v", err)
 	}
 
@@ -83,12 +94,25 @@ func checkInterpreter(t *testing.T, input, output string, bigint bool) {
 	}
 }
 
-func run(i *Interpret, file string, input io.Reader) error {
+func run(i *Interpret, file string, input io.Reader, vm bool) error {
+	return runOpt(i, file, input, vm, true)
+}
+
+// runOpt is run with optimizations optionally disabled (see "spil -no-opt").
+func runOpt(i *Interpret, file string, input io.Reader, vm, opt bool) error {
 	if err := i.Parse(file, input); err != nil {
 		return err
 	}
-	if err := i.Check(); err != nil {
+	if err, _ := i.Check(); err != nil {
 		return fmt.Errorf("Check failed: %v", err)
 	}
+	if opt {
+		if warns := i.Optimize(); len(warns) > 0 {
+			return fmt.Errorf("Optimize reported warnings: %v", warns)
+		}
+	}
+	if vm {
+		i.Compile()
+	}
 	return i.Run()
 }
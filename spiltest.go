@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// "spil test" runs tests defined with deftest in *_test.lisp files.
+
+func testCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "print all tests and their output")
+	run := flags.String("run", "", "run only tests matching regular expression")
+	cover := flags.String("cover", "", "write coverage profile to file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil test [-v] [-run regexp] [-cover file] [files or directories...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		if filter, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintf(os.Stderr, "Incorrect -run expression: %v\n", err)
+			return 2
+		}
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findTestFiles(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "No test files found\n")
+		return 1
+	}
+	t := &testRunner{w: os.Stdout, verbose: *verbose, filter: filter, cover: *cover != ""}
+	failed := false
+	for _, file := range files {
+		if !t.runFile(file) {
+			failed = true
+		}
+	}
+	if t.cover {
+		if err := writeCoverProfile(*cover, t.blocks); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// findTestFiles returns files specified explicitly and *_test.lisp files from directories.
+func findTestFiles(paths []string) (files []string, err error) {
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.Walk(p, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(file, "_test.lisp") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+type testRunner struct {
+	w       io.Writer
+	verbose bool
+	filter  *regexp.Regexp
+	// collect coverage of all test files into blocks
+	cover  bool
+	blocks []coverBlock
+}
+
+// runFile runs tests from file and reports if all of them passed.
+func (t *testRunner) runFile(file string) bool {
+	start := time.Now()
+	output := &bytes.Buffer{}
+	in, err := t.load(file, output)
+	if err != nil {
+		fmt.Fprintf(t.w, "FAIL\t%v\n%v\n", file, indent(err.Error()))
+		return false
+	}
+	passed := true
+	for _, test := range in.tests {
+		name := strings.TrimPrefix(test.name, "deftest ")
+		if t.filter != nil && !t.filter.MatchString(name) {
+			continue
+		}
+		if !t.runTest(in, test, name, output) {
+			passed = false
+		}
+	}
+	if t.cover {
+		t.blocks = mergeCover(t.blocks, in.CoverBlocks())
+	}
+	status := "ok  "
+	if !passed {
+		status = "FAIL"
+	}
+	fmt.Fprintf(t.w, "%v\t%v\t%.3fs\n", status, file, time.Since(start).Seconds())
+	return passed
+}
+
+func (t *testRunner) load(file string, output io.Writer) (*Interpret, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	in := NewInterpreter(output)
+	in.IncludeDirs = searchDirs(pluginDir)
+	if err := in.Parse(path, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if errs, _ := in.Check(); len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, fmt.Errorf("%v", strings.Join(msgs, "\n"))
+	}
+	if t.cover {
+		in.EnableCoverage()
+		return in, nil
+	}
+	in.Optimize()
+	in.Compile()
+	return in, nil
+}
+
+func (t *testRunner) runTest(in *Interpret, test *FuncInterpret, name string, output *bytes.Buffer) bool {
+	if t.verbose {
+		fmt.Fprintf(t.w, "=== RUN   %v\n", name)
+	}
+	in.resetMemo()
+	output.Reset()
+	start := time.Now()
+	err := evalTest(test)
+	elapsed := time.Since(start).Seconds()
+	if err != nil {
+		fmt.Fprintf(t.w, "--- FAIL: %v (%.3fs)\n%v\n", name, elapsed, indent(err.Error()))
+		if output.Len() > 0 {
+			fmt.Fprintf(t.w, "    output:\n%v", indent(indent(output.String())))
+		}
+		return false
+	}
+	if t.verbose {
+		fmt.Fprintf(t.w, "--- PASS: %v (%.3fs)\n", name, elapsed)
+		if output.Len() > 0 {
+			fmt.Fprintf(t.w, "%v", indent(output.String()))
+		}
+	}
+	return true
+}
+
+// evalTest turns panics raised while evaluating the test into its failure like RunArgs does.
+func evalTest(test *FuncInterpret) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	_, err = test.Eval(nil)
+	return err
+}
+
+// resetMemo clears results remembered by def' functions, so tests do not depend on each other.
+func (in *Interpret) resetMemo() {
+	for _, fn := range in.funcs {
+		if fi, ok := fn.(*FuncInterpret); ok {
+			for _, impl := range fi.bodies {
+				if impl.memo {
+					impl.results = make(map[string]*types.Value)
+				}
+			}
+		}
+	}
+}
+
+func indent(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = "    " + l
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpilTest(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		passed bool
+		output []string
+	}{
+		{
+			"passed",
+			`(def sq (x) (* x x))
+(deftest sq (assert= 16 (sq 4)) (assert-type (sq 2) :int))`,
+			true,
+			[]string{"ok  \t"},
+		},
+		{
+			"failed",
+			`(deftest sum (print "sum") (assert= '(1 2 3) (list 1 2 4)))`,
+			false,
+			[]string{
+				"--- FAIL: sum",
+				"    expected: '(1 2 3)\n    actual:   '(1 2 4)\n                    ^\n",
+				"    output:\n        sum\n",
+				"FAIL\t",
+			},
+		},
+		{
+			"isolated memo",
+			`(def' f (n) (print "eval" n) n)
+(deftest first (f 1) (assert= 1 2))
+(deftest second (f 1) (assert= 1 2))`,
+			false,
+			[]string{
+				"--- FAIL: first (",
+				"    output:\n        eval 1\n--- FAIL: second (",
+				"    output:\n        eval 1\nFAIL",
+			},
+		},
+		{
+			"assert-error",
+			`(def f (0) 0)
+(deftest ok (assert-error \(f 1) "no matching"))
+(deftest fail (assert-error \(f 0)))`,
+			false,
+			[]string{"--- FAIL: fail", "    assert-error failed: expected error, found value 0\n"},
+		},
+		{
+			"panics",
+			`(use std)
+(deftest lazy (assert= '(1) (filter \(error "boom") '(1 2))))
+(def f () (/ 1 0))
+(deftest div (assert-error f))
+(deftest ok (assert= 1 1))`,
+			false,
+			[]string{"--- FAIL: lazy", "error: boom\n", "--- FAIL: div", "    runtime error: integer divide by zero\n", "FAIL\t"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "x_test.lisp")
+			if err := ioutil.WriteFile(file, []byte(test.code), 0644); err != nil {
+				t.Fatal(err)
+			}
+			out := &strings.Builder{}
+			r := &testRunner{w: out}
+			if passed := r.runFile(file); passed != test.passed {
+				t.Errorf("Incorrect result: expected %v, actual %v\n%v", test.passed, passed, out)
+			}
+			for _, exp := range test.output {
+				if !strings.Contains(out.String(), exp) {
+					t.Errorf("Output does not contain %q:\n%v", exp, out)
+				}
+			}
+		})
+	}
+}
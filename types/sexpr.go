@@ -10,6 +10,10 @@ type Sexpr struct {
 	List   []Value
 	Quoted bool
 	Lambda bool
+	// source position of the opening brace (empty for generated expressions)
+	File string
+	Line int
+	Col  int
 }
 
 func QList(args ...Value) *Sexpr {
@@ -94,6 +98,9 @@ func (s *Sexpr) Tail() (List, error) {
 	return &Sexpr{
 		List:   s.List[1:],
 		Quoted: s.Quoted,
+		File:   s.File,
+		Line:   s.Line,
+		Col:    s.Col,
 	}, nil
 }
 
@@ -77,7 +77,7 @@ func (t Type) Canonical() Type {
 			if i > 0 {
 				res += ","
 			}
-			res += string('a' + i)
+			res += string(rune('a' + i))
 		}
 		res += "]"
 	}
@@ -85,7 +85,7 @@ func (t Type) Canonical() Type {
 }
 
 func (t Type) Expand(types map[string]Type) Type {
-	if types == nil {
+	if len(types) == 0 {
 		return t
 	}
 	if newT, ok := types[t.Basic()]; ok {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -19,6 +20,11 @@ type FuncInterpret struct {
 	capturedVars map[string]*types.Value
 
 	genericReturnTypes map[string]types.Type
+
+	// function bodies are compiled into bytecode
+	compiled bool
+	// types of parameters -> matching implementations
+	dispatchCache map[string][]dispatchEntry
 }
 
 func (f *FuncInterpret) FuncType() types.Type {
@@ -32,6 +38,37 @@ func (f *FuncInterpret) FuncType() types.Type {
 	return ft
 }
 
+// position returns name of function and position of its definition.
+// Lambdas are named after the place they are defined at.
+func (f *FuncInterpret) position() (name, file string, line int) {
+	name = f.name
+	if len(f.bodies) > 0 {
+		file, line = f.bodies[0].file, f.bodies[0].line
+	}
+	if !strings.HasPrefix(name, "__lambda__") {
+		return name, file, line
+	}
+	name = "lambda"
+	for _, st := range f.bodies[0].body {
+		if se, ok := st.E.(*types.Sexpr); ok && se.Line > 0 {
+			file, line = se.File, se.Line
+			name = fmt.Sprintf("lambda %v:%d", filepath.Base(file), line)
+			break
+		}
+	}
+	return name, file, line
+}
+
+// errorIn attaches name of the function to the error raised while evaluating its body.
+// Library functions are skipped, so errors are reported in the function of the program calling them.
+func (f *FuncInterpret) errorIn(err error) error {
+	name, file, _ := f.position()
+	if f.interpret.libraryFiles[file] {
+		return err
+	}
+	return inFunc(name, err)
+}
+
 type FuncImpl struct {
 	argfmt *ArgFmt
 	body   []types.Value
@@ -43,6 +80,14 @@ type FuncImpl struct {
 	returnType types.Type
 	// function type
 	funcType types.Type
+	// compiled body
+	code *vmCode
+	// source position of the definition
+	file string
+	line int
+	col  int
+	// docstring
+	doc string
 }
 
 func NewFuncImpl(argfmt *ArgFmt, body []types.Value, memo bool, returnType types.Type) *FuncImpl {
@@ -93,6 +138,7 @@ func NewFuncInterpret(i *Interpret, name string) *FuncInterpret {
 		name:               name,
 		capturedVars:       make(map[string]*types.Value),
 		genericReturnTypes: make(map[string]types.Type),
+		dispatchCache:      make(map[string][]dispatchEntry),
 	}
 }
 
@@ -149,7 +195,7 @@ func (f *FuncInterpret) TryBindAll(params []types.Value) (rt types.Type, err err
 				}
 
 				if err != nil {
-					return "", err
+					return "", inFunc(f.name, err)
 				}
 				if t != tt && tt != types.TypeUnknown {
 					return "", fmt.Errorf("%v: mismatch return type: declared %v != actual %v", f.name, t, tt)
@@ -158,7 +204,7 @@ func (f *FuncInterpret) TryBindAll(params []types.Value) (rt types.Type, err err
 		}
 	}
 	if !rtDefined {
-		return "", fmt.Errorf("%v: no matching function implementation found for %v", f.name, params)
+		return "", withCode(codeNoMatchingImpl, fmt.Errorf("%v: no matching function implementation found for %v", f.name, params))
 	}
 	return rt, nil
 }
@@ -170,11 +216,22 @@ func (f *FuncInterpret) TryBind(params []types.Value) (num int, rt types.Type, t
 			return idx, t, tps, nil
 		}
 	}
-	return -1, types.TypeUnknown, nil, fmt.Errorf("%v: TryBind: no matching function implementation found for %v", f.name, params)
+	return -1, types.TypeUnknown, nil, withCode(codeNoMatchingImpl, fmt.Errorf("%v: TryBind: no matching function implementation found for %v", f.name, params))
 }
 
 func (f *FuncInterpret) Eval(params []types.Value) (result *types.Value, err error) {
+	if p := f.interpret.prof; p != nil {
+		p.enter(f)
+		defer p.leave()
+	}
+	if f.compiled {
+		return f.evalVM(params)
+	}
 	run := NewFuncRuntime(f)
+	if d := f.interpret.debug; d != nil {
+		d.enter(run)
+		defer d.leave()
+	}
 	impl, result, rt, types, err := run.bind(params)
 	if err != nil {
 		return nil, err
@@ -185,12 +242,12 @@ func (f *FuncInterpret) Eval(params []types.Value) (result *types.Value, err err
 	run.types = types
 	res, err := run.Eval(impl)
 	if err != nil {
-		return nil, err
+		return nil, f.errorIn(err)
 	}
 	run.cleanup()
 	newT, err := run.updateType(res.T, rt)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot cast type %v to %v: %v", res.T, rt, err)
+		return nil, withCode(codeCannotCast, fmt.Errorf("Cannot cast type %v to %v: %v", res.T, rt, err))
 	}
 	res.T = newT
 	return res, err
@@ -235,13 +292,26 @@ func (f *FuncRuntime) bind(params []types.Value) (impl *FuncImpl, result *types.
 		return nil, nil, "", nil, err
 	}
 	impl = f.fi.bodies[idx]
+	if c := f.fi.interpret.cover; c != nil {
+		c.clause(impl)
+	}
+	prof := f.fi.interpret.prof
+	if prof != nil {
+		prof.bound(f.fi, idx)
+	}
 	if impl.memo {
 		keyArgs, err := keyOfArgs(args)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Cannot compute hash of args: %v, %v\n", args, err)
 		} else if res, ok := impl.results[keyArgs]; ok {
+			if prof != nil {
+				prof.memo(f.fi, true)
+			}
 			return nil, res, "", nil, nil
 		}
+		if prof != nil {
+			prof.memo(f.fi, false)
+		}
 	}
 
 	if impl.argfmt != nil {
@@ -288,6 +358,11 @@ func (f *FuncRuntime) bind(params []types.Value) (impl *FuncImpl, result *types.
 		f.vars[fmt.Sprintf("_%d", i+1)] = arg
 	}
 	f.args = args
+	if d := f.fi.interpret.debug; d != nil {
+		if err := d.bound(f, impl); err != nil {
+			return nil, nil, "", nil, err
+		}
+	}
 	return impl, nil, rt, tps, nil
 }
 
@@ -321,14 +396,14 @@ L:
 					if forceType != nil {
 						newT, err := f.updateType(e.T, *forceType)
 						if err != nil {
-							return nil, fmt.Errorf("Cannot cast %v to %v: %v", e.T, *forceType, err)
+							return nil, withCode(codeCannotCast, fmt.Errorf("Cannot cast %v to %v: %v", e.T, *forceType, err))
 						}
 						e.T = newT
 					}
 					if bodyForceType != nil {
 						newT, err := f.updateType(e.T, *bodyForceType)
 						if err != nil {
-							return nil, fmt.Errorf("Cannot cast %v to %v: %v", e.T, *bodyForceType, err)
+							return nil, withCode(codeCannotCast, fmt.Errorf("Cannot cast %v to %v: %v", e.T, *bodyForceType, err))
 						}
 						e.T = newT
 					}
@@ -403,7 +478,7 @@ L:
 				var result *types.Value
 				impl, result, _, _, err = f.bind(args)
 				if err != nil {
-					return nil, err
+					return nil, f.fi.interpret.callError(lst, err)
 				}
 				if result != nil {
 					return result, nil
@@ -447,6 +522,15 @@ func (f *FuncRuntime) lastParameter(e *types.Value) (*types.Value, *types.Type,
 		if a.Length() == 0 {
 			return nil, nil, fmt.Errorf("%v: Unexpected empty s-expression: %v", f.fi.name, a)
 		}
+		cover := f.fi.interpret.cover
+		if cover != nil {
+			cover.expr(a)
+		}
+		if d := f.fi.interpret.debug; d != nil {
+			if err := d.expr(f, a); err != nil {
+				return nil, nil, err
+			}
+		}
 		head, _ := a.Head()
 		if name, ok := head.E.(types.Ident); ok {
 			if a.Lambda {
@@ -484,6 +568,9 @@ func (f *FuncRuntime) lastParameter(e *types.Value) (*types.Value, *types.Type,
 				if !ok {
 					return nil, nil, fmt.Errorf("Argument %v should evaluate to boolean value, actual %v", arg, res)
 				}
+				if cover != nil {
+					cover.branch(a, bool(boolRes))
+				}
 				if bool(boolRes) {
 					return f.lastParameter(&a.List[2])
 				}
@@ -518,7 +605,7 @@ func (f *FuncRuntime) lastParameter(e *types.Value) (*types.Value, *types.Type,
 					// TODO check matching types
 					newT, err := f.updateType(ret.T, *retType)
 					if err != nil {
-						return nil, nil, fmt.Errorf("Cannot cast %v to %v: %v", ret.T, *retType, err)
+						return nil, nil, withCode(codeCannotCast, fmt.Errorf("Cannot cast %v to %v: %v", ret.T, *retType, err))
 					}
 					ret.T = newT
 					ft = retType
@@ -580,7 +667,7 @@ func (f *FuncRuntime) lastParameter(e *types.Value) (*types.Value, *types.Type,
 				tail, _ := a.Tail()
 				gen, err := f.evalGen(tail.(*types.Sexpr) /*hashable*/, name == "gen'")
 				if err != nil {
-					return nil, nil, err
+					return nil, nil, f.fi.interpret.callError(a, err)
 				}
 				return &types.Value{E: gen, T: types.TypeList}, nil, nil
 			}
@@ -666,7 +753,7 @@ func (f *FuncRuntime) setVar(se *types.Sexpr, scoped bool) error {
 		}
 		newT, err := f.updateType(value.T, t.Expand(f.types))
 		if err != nil {
-			return fmt.Errorf("Cannot cast type %v to %v: %v", value.T, t, err)
+			return withCode(codeCannotCast, fmt.Errorf("Cannot cast type %v to %v: %v", value.T, t, err))
 		}
 		value.T = newT
 	}
@@ -728,7 +815,7 @@ func (f *FuncRuntime) findFunc(fname string) (result types.Function, err error)
 	}
 	fu, ok := f.fi.interpret.funcs[fname]
 	if !ok {
-		return nil, fmt.Errorf("%v: Unknown function: %v", f.fi.name, fname)
+		return nil, withCode(codeUnknownFunction, fmt.Errorf("%v: Unknown function: %v", f.fi.name, fname))
 	}
 	return fu, nil
 }
@@ -746,7 +833,7 @@ func (f *FuncRuntime) evalFunc(se *types.Sexpr) (result *types.Value, err error)
 	fname := string(name)
 	fu, err := f.findFunc(fname)
 	if err != nil {
-		return nil, err
+		return nil, f.fi.interpret.callError(se, err)
 	}
 
 	// evaluate arguments
@@ -761,7 +848,7 @@ func (f *FuncRuntime) evalFunc(se *types.Sexpr) (result *types.Value, err error)
 		args = append(args, *res)
 	}
 	result, err = fu.Eval(args)
-	return result, err
+	return result, f.fi.interpret.callError(se, err)
 }
 
 func (f *FuncRuntime) evalLambda(se *types.Sexpr) (types.Expr, error) {
@@ -779,8 +866,11 @@ func (f *FuncRuntime) replaceVars(st []types.Value, fi *FuncInterpret) (res []ty
 	for _, s := range st {
 		switch a := s.E.(type) {
 		case *types.Sexpr:
-			v := &types.Sexpr{Quoted: a.Quoted}
+			v := &types.Sexpr{Quoted: a.Quoted, File: a.File, Line: a.Line, Col: a.Col}
 			v.List = f.replaceVars(a.List, fi)
+			if c := f.fi.interpret.cover; c != nil {
+				c.alias(v, a)
+			}
 			res = append(res, types.Value{E: v, T: s.T})
 		case types.Ident:
 			if lambdaArgRe.MatchString(string(a)) {
@@ -820,10 +910,23 @@ func (f *FuncRuntime) evalApply(se *types.Sexpr) (types.Expr, error) {
 
 	return &types.Sexpr{
 		List: cmd,
+		File: se.File,
+		Line: se.Line,
+		Col:  se.Col,
 	}, nil
 }
 
 func (f *FuncInterpret) matchParameters(argfmt *ArgFmt, params []types.Value) (result bool, tps map[string]types.Type) {
+	ok, tps := f.matchTypes(argfmt, params)
+	if !ok || !f.matchValues(argfmt, params) {
+		return false, nil
+	}
+	return true, tps
+}
+
+// matchTypes checks that types of parameters match the function signature.
+// The result depends only on types of parameters so it can be cached.
+func (f *FuncInterpret) matchTypes(argfmt *ArgFmt, params []types.Value) (result bool, tps map[string]types.Type) {
 	if argfmt == nil {
 		// null matches everything (lambda case)
 		return true, nil
@@ -832,7 +935,6 @@ func (f *FuncInterpret) matchParameters(argfmt *ArgFmt, params []types.Value) (r
 		return true, nil
 	}
 
-	binds := map[string]types.Expr{}
 	typeBinds := map[string]types.Type{}
 	for i, arg := range argfmt.Args {
 		// check for varargs
@@ -872,34 +974,47 @@ func (f *FuncInterpret) matchParameters(argfmt *ArgFmt, params []types.Value) (r
 		if i >= len(params) {
 			return false, nil
 		}
-		param := params[i]
-		match, err := f.interpret.matchType(arg.T, param.T, &typeBinds)
+		match, err := f.interpret.matchType(arg.T, params[i].T, &typeBinds)
 		if err != nil {
 			return false, nil
 		}
 		if !match {
 			return false, nil
 		}
-		if !f.matchValue(&arg, &param) {
-			return false, nil
+	}
+	if len(argfmt.Args) != len(params) {
+		return false, nil
+	}
+	return true, typeBinds
+}
+
+// matchValues checks that values of parameters match the patterns of the function signature.
+func (f *FuncInterpret) matchValues(argfmt *ArgFmt, params []types.Value) bool {
+	if argfmt == nil || argfmt.Wildcard != "" {
+		return true
+	}
+	for i, arg := range argfmt.Args {
+		if arg.T.Basic() == "args" {
+			return true
 		}
-		if arg.Name == "" {
-			continue
+		if i >= len(params) {
+			return false
 		}
-		if param.E == nil {
+		param := params[i]
+		if !f.matchValue(&arg, &param) {
+			return false
+		}
+		if arg.Name == "" || param.E == nil {
 			continue
 		}
-		if binded, ok := binds[arg.Name]; ok {
-			if !types.Equal(binded, param.E) {
-				return false, nil
+		// the same name used twice should be bound to equal values
+		for j := 0; j < i; j++ {
+			if argfmt.Args[j].Name == arg.Name && params[j].E != nil && !types.Equal(params[j].E, param.E) {
+				return false
 			}
 		}
-		binds[arg.Name] = param.E
-	}
-	if len(argfmt.Args) != len(params) {
-		return false, nil
 	}
-	return true, typeBinds
+	return true
 }
 
 func (f *FuncInterpret) matchValue(a *Arg, p *types.Value) bool {
@@ -949,21 +1064,25 @@ func (f *FuncInterpret) matchParam(a *Arg, p *types.Value) bool {
 
 func (f *FuncRuntime) cleanup() {
 	for _, varname := range f.scopedVars {
-		expr := f.vars[varname]
-		switch a := expr.E.(type) {
-		case types.Ident:
-			f.fi.interpret.DeleteLambda(string(a))
-		case io.Closer:
-			if err := a.Close(); err != nil {
-				fmt.Fprintf(os.Stderr, "Close() failed: %v\n", err)
-			}
-		default:
-			fmt.Fprintf(os.Stderr, "Don't know how to clean variable of type: %v\n", expr)
-		}
+		closeScoped(f.fi.interpret, f.vars[varname])
 	}
 	f.scopedVars = f.scopedVars[:0]
 }
 
+// closeScoped releases variable defined with set'.
+func closeScoped(in *Interpret, expr types.Value) {
+	switch a := expr.E.(type) {
+	case types.Ident:
+		in.DeleteLambda(string(a))
+	case io.Closer:
+		if err := a.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Close() failed: %v\n", err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Don't know how to clean variable of type: %v\n", expr)
+	}
+}
+
 func (i *Interpret) matchType(arg types.Type, val types.Type, typeBinds *map[string]types.Type) (result bool, eerroorr error) {
 	arg = i.UnaliasType(arg)
 	val = i.UnaliasType(val)
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// "spil vet" reports suspicious constructs which are accepted by the type checker.
+// Every check can be disabled with -<check>=false flag.
+
+var vetChecks = []struct {
+	name string
+	doc  string
+}{
+	{"unused", "variables and parameters which are never used"},
+	{"uncalled", "functions which are never called from the program or tests"},
+	{"shadow", "variables which shadow functions or other variables"},
+	{"unreachable", "function clauses which never match because of the earlier clauses"},
+	{"closeable", "set' on values which cannot be closed"},
+	{"loop", "recursion not in tail position in functions annotated with '; spil:loop'"},
+	{"memo", "memoized functions called with unhashable lazy lists"},
+}
+
+// vetLoopDirective is a comment before function definition which marks the function as a loop:
+// all its recursive calls should be tail calls.
+const vetLoopDirective = "spil:loop"
+
+func vetCommand(args []string) int {
+	flags := flag.NewFlagSet("vet", flag.ExitOnError)
+	enabled := make(map[string]*bool)
+	for _, c := range vetChecks {
+		enabled[c.name] = flags.Bool(c.name, true, "report "+c.doc)
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil vet [-check=false]... file.lisp\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	in, err := loadProgram(flags.Arg(0), ioutil.Discard)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	file, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	checks := make(map[string]bool)
+	for name, on := range enabled {
+		checks[name] = *on
+	}
+	warnings := in.Vet(file, checks)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "%v\n", w)
+	}
+	if len(warnings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+type vetWarning struct {
+	File    string
+	Line    int
+	Check   string
+	Message string
+}
+
+func (w vetWarning) String() string {
+	return fmt.Sprintf("%v:%d: %v (%v)", displayName(w.File), w.Line, w.Message, w.Check)
+}
+
+type vetter struct {
+	in       *Interpret
+	checks   map[string]bool
+	warnings []vetWarning
+	// functions annotated as loops
+	loops map[string]bool
+	// function -> functions it refers to
+	refs map[string]map[string]bool
+	// functions returning lazy lists
+	lazy map[string]bool
+}
+
+// Vet runs enabled checks over the parsed program.
+// Functions of the library are not checked, uncalled functions are reported only in the program file.
+func (in *Interpret) Vet(file string, checks map[string]bool) []vetWarning {
+	v := &vetter{
+		in:     in,
+		checks: checks,
+		loops:  make(map[string]bool),
+		refs:   make(map[string]map[string]bool),
+		lazy:   make(map[string]bool),
+	}
+	var names []string
+	files := make(map[string]bool)
+	for name, fn := range in.funcs {
+		fi, ok := fn.(*FuncInterpret)
+		if !ok || strings.HasPrefix(name, "__") || isLibraryFile(fi.bodies[0].file) {
+			continue
+		}
+		names = append(names, name)
+		for _, impl := range fi.bodies {
+			files[impl.file] = true
+		}
+	}
+	sort.Strings(names)
+	for f := range files {
+		v.loopDirectives(f)
+	}
+
+	v.function("__main__", file, 0, nil, in.mainBody)
+	for _, t := range in.tests {
+		impl := t.bodies[0]
+		v.function(t.name, impl.file, impl.line, nil, impl.body)
+	}
+	for _, name := range names {
+		fi := in.funcs[name].(*FuncInterpret)
+		for _, impl := range fi.bodies {
+			v.function(name, impl.file, impl.line, impl.argfmt, impl.body)
+		}
+		v.unreachable(fi)
+	}
+	v.uncalled(file, names)
+
+	sort.SliceStable(v.warnings, func(i, j int) bool {
+		a, b := v.warnings[i], v.warnings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return v.warnings
+}
+
+func isLibraryFile(file string) bool {
+	return strings.HasPrefix(file, "library/")
+}
+
+func (v *vetter) warn(check, file string, line int, format string, args ...interface{}) {
+	if !v.checks[check] {
+		return
+	}
+	v.warnings = append(v.warnings, vetWarning{File: file, Line: line, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// loopDirectives finds functions annotated as loops in the file.
+func (v *vetter) loopDirectives(file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		// embedded module
+		return
+	}
+	defer f.Close()
+	nodes, err := ParseCST(f)
+	if err != nil {
+		return
+	}
+	for i := 0; i+1 < len(nodes); i++ {
+		if n := nodes[i]; n.Kind != cstComment || strings.TrimSpace(strings.TrimLeft(n.Text, ";#")) != vetLoopDirective {
+			continue
+		}
+		if next := nodes[i+1]; isDefinition(next) && len(next.Items) > 1 {
+			v.loops[next.Items[1].Text] = true
+		}
+	}
+}
+
+// uncalled reports functions of the file which are not reachable from the program and tests.
+func (v *vetter) uncalled(file string, names []string) {
+	reached := make(map[string]bool)
+	queue := []string{"__main__"}
+	for _, t := range v.in.tests {
+		queue = append(queue, t.name)
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for ref := range v.refs[name] {
+			if !reached[ref] {
+				reached[ref] = true
+				queue = append(queue, ref)
+			}
+		}
+	}
+	for _, name := range names {
+		impl := v.in.funcs[name].(*FuncInterpret).bodies[0]
+		if !reached[name] && impl.file == file {
+			v.warn("uncalled", impl.file, impl.line, "function %v is never called", name)
+		}
+	}
+}
+
+// unreachable reports clauses which are matched by one of the earlier clauses
+// (the same check as the warnings of the optimizer, see Interpret.unreachableClauses).
+func (v *vetter) unreachable(fi *FuncInterpret) {
+	for j, impl := range fi.bodies {
+		for _, prev := range fi.bodies[:j] {
+			if v.in.subsumes(prev.argfmt, impl.argfmt) {
+				v.warn("unreachable", impl.file, impl.line, "clause of %v is unreachable: arguments are matched by the clause at line %d", fi.name, prev.line)
+				break
+			}
+		}
+	}
+}
+
+type vetVar struct {
+	name  string
+	file  string
+	line  int
+	param bool
+	used  bool
+}
+
+type vetScope struct {
+	parent *vetScope
+	vars   map[string]*vetVar
+}
+
+func (s *vetScope) lookup(name string) *vetVar {
+	for ; s != nil; s = s.parent {
+		if vr, ok := s.vars[name]; ok {
+			return vr
+		}
+	}
+	return nil
+}
+
+// vetFunc keeps state of checking one function clause.
+type vetFunc struct {
+	v    *vetter
+	name string
+	file string
+	// declared variables in order of declaration
+	vars     []*vetVar
+	types    map[string]types.Type
+	lazyVars map[string]bool
+	// depth of lambdas
+	lambda int
+}
+
+func (v *vetter) function(name, file string, line int, argfmt *ArgFmt, body []types.Value) {
+	f := &vetFunc{
+		v:        v,
+		name:     name,
+		file:     file,
+		types:    make(map[string]types.Type),
+		lazyVars: make(map[string]bool),
+	}
+	if v.refs[name] == nil {
+		v.refs[name] = make(map[string]bool)
+	}
+	scope := &vetScope{vars: make(map[string]*vetVar)}
+	if argfmt != nil {
+		if argfmt.Wildcard != "" {
+			f.declare(scope, argfmt.Wildcard, file, line, true)
+		}
+		for _, a := range argfmt.Args {
+			if a.Name == "" {
+				continue
+			}
+			if vr, ok := scope.vars[a.Name]; ok {
+				// repeated parameter matches equal arguments
+				vr.used = true
+				continue
+			}
+			f.declare(scope, a.Name, file, line, true)
+		}
+		for n, t := range argfmt.Values() {
+			f.types[n] = t
+		}
+	}
+	f.statements(scope, body, true)
+	for _, vr := range f.vars {
+		if vr.used || strings.HasPrefix(vr.name, "_") {
+			continue
+		}
+		if vr.param {
+			v.warn("unused", vr.file, vr.line, "parameter %v of %v is not used", vr.name, name)
+		} else {
+			v.warn("unused", vr.file, vr.line, "variable %v is not used", vr.name)
+		}
+	}
+}
+
+func (f *vetFunc) declare(scope *vetScope, name, file string, line int, param bool) {
+	if prev := scope.lookup(name); prev != nil {
+		kind := "variable"
+		if prev.param {
+			kind = "parameter"
+		}
+		f.v.warn("shadow", file, line, "%v shadows %v declared at line %d", name, kind, prev.line)
+	} else if _, ok := f.v.in.funcs[name]; ok {
+		f.v.warn("shadow", file, line, "%v shadows function %v", name, name)
+	}
+	vr := &vetVar{name: name, file: file, line: line, param: param}
+	scope.vars[name] = vr
+	f.vars = append(f.vars, vr)
+}
+
+// lastExpr returns index of the statement which result is returned (trailing type declaration is skipped).
+func lastExpr(body []types.Value) int {
+	last := len(body) - 1
+	if last > 0 {
+		if id, ok := body[last].E.(types.Ident); ok {
+			if _, ok := types.ParseType(string(id)); ok {
+				last--
+			}
+		}
+	}
+	return last
+}
+
+func (f *vetFunc) statements(scope *vetScope, body []types.Value, tail bool) {
+	last := lastExpr(body)
+	for i, st := range body {
+		f.expr(scope, st, tail && i == last)
+	}
+}
+
+func (f *vetFunc) expr(scope *vetScope, e types.Value, tail bool) {
+	switch a := e.E.(type) {
+	case types.Ident:
+		f.ident(scope, string(a))
+	case *types.Sexpr:
+		if a.Empty() {
+			return
+		}
+		if a.Quoted {
+			for _, item := range a.List {
+				f.expr(scope, item, false)
+			}
+			return
+		}
+		if a.Lambda {
+			f.lambda++
+			inner := &vetScope{parent: scope, vars: make(map[string]*vetVar)}
+			for _, item := range a.List {
+				f.expr(inner, item, false)
+			}
+			f.lambda--
+			return
+		}
+		head, ok := a.List[0].E.(types.Ident)
+		if !ok {
+			for _, item := range a.List {
+				f.expr(scope, item, false)
+			}
+			return
+		}
+		switch name := string(head); name {
+		case "lambda":
+			f.lambda++
+			f.statements(&vetScope{parent: scope, vars: make(map[string]*vetVar)}, a.List[1:], false)
+			f.lambda--
+		case "set", "set'":
+			f.set(scope, a, name == "set'")
+		case "if":
+			for i, item := range a.List[1:] {
+				f.expr(scope, item, tail && i > 0)
+			}
+		case "do":
+			f.statements(scope, a.List[1:], tail)
+		case "apply":
+			if len(a.List) > 1 {
+				if fn, ok := a.List[1].E.(types.Ident); ok {
+					f.call(string(fn), a, nil, tail)
+				}
+			}
+			for _, item := range a.List[1:] {
+				f.expr(scope, item, false)
+			}
+		case "and", "or", "gen", "gen'":
+			for _, item := range a.List[1:] {
+				f.expr(scope, item, false)
+			}
+		default:
+			if scope.lookup(name) == nil {
+				f.call(name, a, a.List[1:], tail)
+			}
+			for _, item := range a.List {
+				f.expr(scope, item, false)
+			}
+		}
+	}
+}
+
+func (f *vetFunc) ident(scope *vetScope, name string) {
+	if vr := scope.lookup(name); vr != nil {
+		vr.used = true
+		return
+	}
+	if _, ok := f.v.in.funcs[name].(*FuncInterpret); ok {
+		f.v.refs[f.name][name] = true
+	}
+}
+
+// call checks function call in the body, args are nil for apply.
+func (f *vetFunc) call(name string, se *types.Sexpr, args []types.Value, tail bool) {
+	if (name == f.name || name == "self") && !tail && f.lambda == 0 && f.v.loops[f.name] {
+		f.v.warn("loop", se.File, se.Line, "recursive call of %v is not in tail position", f.name)
+	}
+	fi, ok := f.v.in.funcs[name].(*FuncInterpret)
+	if !ok || args == nil {
+		return
+	}
+	memo := false
+	for _, impl := range fi.bodies {
+		memo = memo || impl.memo
+	}
+	if !memo {
+		return
+	}
+	for i, arg := range args {
+		if f.isLazy(arg) {
+			f.v.warn("memo", se.File, se.Line, "memoized function %v is called with unhashable lazy list as argument %d; use gen' to make it hashable", name, i+1)
+		}
+	}
+}
+
+func (f *vetFunc) set(scope *vetScope, se *types.Sexpr, scoped bool) {
+	if len(se.List) < 3 {
+		return
+	}
+	name, ok := se.List[1].E.(types.Ident)
+	if !ok {
+		return
+	}
+	value := se.List[2]
+	f.expr(scope, value, false)
+	t := types.TypeUnknown
+	if len(se.List) == 4 {
+		if id, ok := se.List[3].E.(types.Ident); ok {
+			if tp, err := f.v.in.parseType(string(id)); err == nil {
+				t = tp
+			}
+		}
+	} else {
+		t = f.typeOf(value)
+	}
+	f.types[string(name)] = t
+	f.lazyVars[string(name)] = f.isLazy(value)
+	if scoped && !f.closeable(value, t) {
+		f.v.warn("closeable", se.File, se.Line, "set' is used on %v which cannot be closed", string(name))
+	}
+	f.declare(scope, string(name), se.File, se.Line, false)
+}
+
+// typeOf returns static type of the expression or :unknown.
+func (f *vetFunc) typeOf(e types.Value) (t types.Type) {
+	defer func() {
+		if r := recover(); r != nil {
+			t = types.TypeUnknown
+		}
+	}()
+	vars := make(map[string]types.Type, len(f.types))
+	for n, t := range f.types {
+		vars[n] = t
+	}
+	t, err := f.v.in.exprType(f.name, e, vars)
+	if err != nil {
+		return types.TypeUnknown
+	}
+	return f.v.in.UnaliasType(t)
+}
+
+// closeable reports if value assigned with set' may be closed: lambdas and files are closeable.
+func (f *vetFunc) closeable(value types.Value, t types.Type) bool {
+	switch a := value.E.(type) {
+	case types.Int, types.Float, types.Str, types.Bool:
+		return false
+	case *types.Sexpr:
+		if a.Quoted || a.Empty() {
+			return false
+		}
+	}
+	switch t.Basic() {
+	case "int", "float", "bool", "list":
+		return false
+	}
+	return true
+}
+
+// isLazy reports if the expression creates unhashable lazy list.
+func (f *vetFunc) isLazy(e types.Value) bool {
+	switch a := e.E.(type) {
+	case types.Ident:
+		return f.lazyVars[string(a)]
+	case *types.Sexpr:
+		if a.Quoted || a.Lambda || a.Empty() {
+			return false
+		}
+		head, ok := a.List[0].E.(types.Ident)
+		if !ok {
+			return false
+		}
+		switch name := string(head); name {
+		case "gen":
+			return true
+		case "if":
+			for _, item := range a.List[2:] {
+				if f.isLazy(item) {
+					return true
+				}
+			}
+			return false
+		case "do":
+			return f.bodyLazy(a.List[1:])
+		default:
+			if _, ok := f.types[name]; ok {
+				// variable holding a function
+				return false
+			}
+			return f.v.returnsLazy(name)
+		}
+	}
+	return false
+}
+
+// bodyLazy reports if the body returns unhashable lazy list.
+func (f *vetFunc) bodyLazy(body []types.Value) bool {
+	last := lastExpr(body)
+	if last < 0 {
+		return false
+	}
+	for _, st := range body[:last] {
+		if se, ok := st.E.(*types.Sexpr); ok && len(se.List) >= 3 && !se.Quoted {
+			if head, ok := se.List[0].E.(types.Ident); ok && (head == "set" || head == "set'") {
+				if name, ok := se.List[1].E.(types.Ident); ok {
+					f.lazyVars[string(name)] = f.isLazy(se.List[2])
+				}
+			}
+		}
+	}
+	return f.isLazy(body[last])
+}
+
+// returnsLazy reports if some clause of the function returns unhashable lazy list.
+func (v *vetter) returnsLazy(name string) bool {
+	if res, ok := v.lazy[name]; ok {
+		return res
+	}
+	// recursive calls do not make the result lazy
+	v.lazy[name] = false
+	fi, ok := v.in.funcs[name].(*FuncInterpret)
+	if !ok {
+		return false
+	}
+	for _, impl := range fi.bodies {
+		f := &vetFunc{v: v, name: name, types: make(map[string]types.Type), lazyVars: make(map[string]bool)}
+		if f.bodyLazy(impl.body) {
+			v.lazy[name] = true
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVet(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		exp  []string
+	}{
+		{
+			name: "unused",
+			code: `(def f (x y _z)
+	(set a 1)
+	(set b (+ x 1))
+	\(+ b _1))
+(def eq (x x) 'T)
+(def eq (x y) 'F)
+(print (f 1 2 3) (eq 1 2))`,
+			exp: []string{
+				"1 unused parameter y of f is not used",
+				"2 unused variable a is not used",
+				"6 unused parameter x of eq is not used",
+				"6 unused parameter y of eq is not used",
+			},
+		},
+		{
+			name: "uncalled",
+			code: `(def f (x) (g x))
+(def g (x) x)
+(def h (x) (h x))
+(def k (x) x)
+(deftest k-works (assert= 1 (k 1)))
+(print (f 1))`,
+			exp: []string{"3 uncalled function h is never called"},
+		},
+		{
+			name: "shadow",
+			code: `(def f (x:int) :int
+	(set y 1)
+	(set x 2)
+	(set head \(do (set y 3) (+ _1 y)))
+	(head (+ x y)))
+(print (f 1))`,
+			exp: []string{
+				"3 shadow x shadows parameter declared at line 1",
+				"4 shadow y shadows variable declared at line 2",
+				"4 shadow head shadows function head",
+			},
+		},
+		{
+			name: "unreachable",
+			code: `(def f (x) 1)
+(def f (0) 2)
+(def g (x:int) 1)
+(def g (x:str) 2)
+(def g (0) 3)
+(def h (x x) 1)
+(def h (x y) 2)
+(def h (1 2) 3)
+(deftype :age :int)
+(def k (n:int) 1)
+(def k (n:age) 2)
+(print (f 1) (g 1) (h 1 2) (k 1))`,
+			exp: []string{
+				"2 unreachable clause of f is unreachable: arguments are matched by the clause at line 1",
+				"5 unreachable clause of g is unreachable: arguments are matched by the clause at line 3",
+				"8 unreachable clause of h is unreachable: arguments are matched by the clause at line 7",
+				"11 unreachable clause of k is unreachable: arguments are matched by the clause at line 10",
+			},
+		},
+		{
+			name: "closeable",
+			code: `(def f (x) :int
+	(set' a x)
+	(set' b (+ x 1))
+	(set' c \(+ _1 x))
+	(set' d "text")
+	(c a))
+(print (f 1))`,
+			exp: []string{
+				"3 closeable set' is used on b which cannot be closed",
+				"5 closeable set' is used on d which cannot be closed",
+			},
+		},
+		{
+			name: "loop",
+			code: `; spil:loop
+(def sum (0) :int 0)
+(def sum (n:int) :int (+ n (sum (- n 1))))
+; spil:loop
+(def count (0 acc) acc)
+(def count (n acc) (if (> n 0) (count (- n 1) (+ acc 1)) (apply count (list 0 acc))))
+(def fact (0) :int 1)
+(def fact (n:int) :int (* n (fact (- n 1))))
+(print (sum 3) (count 3 0) (fact 3))`,
+			exp: []string{"3 loop recursive call of sum is not in tail position"},
+		},
+		{
+			name: "memo",
+			code: `(use std)
+(def' len (l) (len l 0))
+(def' len ('() n) n)
+(def' len (l n) (len (tail l) (+ n 1)))
+(def small (n) (if (< n 3) (list n (+ n 1)) '()))
+(def evens (l) (filter \(= (modulo _1 2) 0) l))
+(set lazy (gen small 0))
+(print (len (gen' small 0)) (len '(1 2 3)))
+(print (len (evens '(1 2 3))))
+(print (len lazy))`,
+			exp: []string{
+				"9 memo memoized function len is called with unhashable lazy list as argument 1; use gen' to make it hashable",
+				"10 memo memoized function len is called with unhashable lazy list as argument 1; use gen' to make it hashable",
+			},
+		},
+	}
+	dir, err := ioutil.TempDir("", "spil-vet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(dir, strings.Replace(test.name, " ", "-", -1)+".lisp")
+			if err := ioutil.WriteFile(file, []byte(test.code), 0644); err != nil {
+				t.Fatal(err)
+			}
+			in, err := loadProgram(file, ioutil.Discard)
+			if err != nil {
+				t.Fatalf("loadProgram failed: %v", err)
+			}
+			// only the tested check is enabled
+			var act []string
+			for _, w := range in.Vet(file, map[string]bool{test.name: true}) {
+				if w.File != file {
+					t.Errorf("Incorrect file of warning: %v", w)
+				}
+				act = append(act, fmt.Sprintf("%d %v %v", w.Line, w.Check, w.Message))
+			}
+			if !reflect.DeepEqual(act, test.exp) {
+				t.Errorf("Incorrect warnings:\nexpected %q,\n  actual %q", test.exp, act)
+			}
+		})
+	}
+}
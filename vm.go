@@ -0,0 +1,654 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/avoronkov/spil/types"
+)
+
+// Bytecode virtual machine.
+//
+// Bodies of user-defined functions are translated by compiler (see compiler.go)
+// into a flat list of instructions working on a value stack.
+// Variables are resolved into frame slots, calls of known functions are resolved
+// in advance and type casts are parsed only once.
+
+type opcode uint8
+
+const (
+	// push consts[a]
+	opConst opcode = iota
+	// push slots[a] (or variable names[b] if slot is not set)
+	opLoad
+	// push captured variable or function reference names[a]
+	opLoadName
+	// pop value into slots[a]
+	opStore
+	// pop value into slots[a] and close it on leaving the function
+	opStoreScoped
+	// cast top of the stack to casts[a]
+	opCast
+	// drop top of the stack
+	opPop
+	// jump to a
+	opJump
+	// pop boolean, jump to a if it is false (consts[b] is the condition source)
+	opJumpIfFalse
+	// pop boolean, jump to a if it is true (consts[b] is the condition source)
+	opJumpIfTrue
+	// call callees[a] with b arguments from the stack
+	opCall
+	// pop list and call callees[a] with its items as arguments
+	opApply
+	// bind function to b arguments from the stack and start over
+	opTailCall
+	// pop list, bind function to its items and start over
+	opTailApply
+	// create lazy list from b values: iterator and initial state
+	opGen
+	// create hashable lazy list from b values: iterator and initial state
+	opGenHashable
+	// create lambda function lambdas[a]
+	opLambda
+	// return top of the stack
+	opReturn
+)
+
+var opcodeNames = [...]string{
+	opConst:       "const",
+	opLoad:        "load",
+	opLoadName:    "load-name",
+	opStore:       "store",
+	opStoreScoped: "store-scoped",
+	opCast:        "cast",
+	opPop:         "pop",
+	opJump:        "jump",
+	opJumpIfFalse: "jump-if-false",
+	opJumpIfTrue:  "jump-if-true",
+	opCall:        "call",
+	opApply:       "apply",
+	opTailCall:    "tail-call",
+	opTailApply:   "tail-apply",
+	opGen:         "gen",
+	opGenHashable: "gen'",
+	opLambda:      "lambda",
+	opReturn:      "return",
+}
+
+func (o opcode) String() string {
+	return opcodeNames[o]
+}
+
+type instr struct {
+	op   opcode
+	a, b int
+}
+
+func (i instr) String() string {
+	return fmt.Sprintf("%v %v %v", i.op, i.a, i.b)
+}
+
+// Compiled body of function implementation.
+type vmCode struct {
+	instrs  []instr
+	consts  []types.Value
+	names   []string
+	casts   []types.Type
+	callees []vmCallee
+	lambdas []*vmLambda
+	// pc of call instruction -> call expression (for positions of runtime errors)
+	calls map[int]*types.Sexpr
+
+	nslots int
+	// maximum depth of the stack
+	maxStack int
+	// index of variadic argument or -1
+	varArgs int
+	// variable name -> slot
+	slotOf map[string]int
+	// slots of function arguments (-1 if argument is not bound to variable)
+	argSlots []int
+	// slot of wildcard argument
+	wildcard int
+	// slot of __args variable
+	argsSlot int
+	// slots of _1, _2, ... variables
+	posSlots []int
+
+	// body translated into Go by "spil build" (see native.go)
+	native goBody
+}
+
+func (c *vmCode) String() string {
+	b := &strings.Builder{}
+	for pc, ins := range c.instrs {
+		fmt.Fprintf(b, "%4d %v\n", pc, ins)
+	}
+	return b.String()
+}
+
+// Function called by name: it may be a variable holding function or a global function.
+type vmCallee struct {
+	name string
+	// slot of variable with the same name or -1
+	slot int
+	// function resolved at compile time
+	fn types.Function
+}
+
+type vmLambda struct {
+	body []types.Value
+	// nil if lambda body cannot be compiled
+	code *vmCode
+	// names which may be captured from the enclosing function
+	free []string
+	// slots of free names in the enclosing function (-1 if none)
+	freeSlots []int
+}
+
+type vmFrame struct {
+	fi    *FuncInterpret
+	impl  *FuncImpl
+	code  *vmCode
+	slots []types.Value
+	stack []types.Value
+	tps   map[string]types.Type
+	// slots that should be closed after leaving the function
+	scoped []int
+
+	memoImpl *FuncImpl
+	memoArgs []types.Expr
+}
+
+func (f *FuncInterpret) evalVM(params []types.Value) (*types.Value, error) {
+	m := &vmFrame{fi: f}
+	result, rt, err := m.bind(params)
+	if err != nil {
+		return nil, err
+	}
+	if result != nil {
+		return result, nil
+	}
+	if m.impl.memo {
+		m.memoImpl = m.impl
+		m.memoArgs = exprsOf(params)
+	}
+	res, err := m.run()
+	if err != nil {
+		return nil, f.errorIn(err)
+	}
+	m.cleanup()
+	newT, err := f.interpret.updateTypeCached(res.T, rt)
+	if err != nil {
+		return nil, withCode(codeCannotCast, fmt.Errorf("Cannot cast type %v to %v: %v", res.T, rt, err))
+	}
+	res.T = newT
+	return res, nil
+}
+
+func exprsOf(params []types.Value) []types.Expr {
+	args := make([]types.Expr, 0, len(params))
+	for _, p := range params {
+		args = append(args, p.E)
+	}
+	return args
+}
+
+// dispatch selects function implementation matching the parameters.
+// Type matching is cached by types of parameters, so only values are checked on every call.
+func (f *FuncInterpret) dispatch(params []types.Value) (*dispatchEntry, error) {
+	var key string
+	if len(params) == 1 {
+		key = string(params[0].T)
+	} else if len(params) > 1 {
+		b := &strings.Builder{}
+		for _, p := range params {
+			b.WriteString(string(p.T))
+			b.WriteByte(' ')
+		}
+		key = b.String()
+	}
+	entries, ok := f.dispatchCache[key]
+	if !ok {
+		for i, im := range f.bodies {
+			if ok, tps := f.matchTypes(im.argfmt, params); ok {
+				e := dispatchEntry{impl: i, tps: tps, rt: im.returnType.Expand(tps)}
+				if im.code != nil && im.code.varArgs >= 0 {
+					e.varArgsT = im.argfmt.Args[im.code.varArgs].T.Expand(tps)
+				}
+				entries = append(entries, e)
+			}
+		}
+		f.dispatchCache[key] = entries
+	}
+	for _, e := range entries {
+		im := f.bodies[e.impl]
+		if f.matchValues(im.argfmt, params) {
+			return &e, nil
+		}
+	}
+	return nil, withCode(codeNoMatchingImpl, fmt.Errorf("%v: TryBind: no matching function implementation found for %v", f.name, params))
+}
+
+type dispatchEntry struct {
+	impl int
+	tps  map[string]types.Type
+	// expanded return type
+	rt types.Type
+	// expanded type of variadic argument
+	varArgsT types.Type
+}
+
+func (m *vmFrame) bind(params []types.Value) (result *types.Value, rt types.Type, err error) {
+	m.cleanup()
+	e, err := m.fi.dispatch(params)
+	if err != nil {
+		return nil, "", err
+	}
+	impl := m.fi.bodies[e.impl]
+	prof := m.fi.interpret.prof
+	if prof != nil {
+		prof.bound(m.fi, e.impl)
+	}
+	if impl.memo {
+		keyArgs, err := keyOfArgs(exprsOf(params))
+		if err == nil {
+			if res, ok := impl.results[keyArgs]; ok {
+				if prof != nil {
+					prof.memo(m.fi, true)
+				}
+				return res, "", nil
+			}
+		}
+		if prof != nil {
+			prof.memo(m.fi, false)
+		}
+	}
+	m.impl = impl
+	m.code = impl.code
+	m.tps = e.tps
+	if cap(m.slots) >= m.code.nslots && cap(m.stack) >= m.code.maxStack {
+		m.slots = m.slots[:m.code.nslots]
+		for i := range m.slots {
+			m.slots[i] = types.Value{}
+		}
+		m.stack = m.stack[:0]
+	} else {
+		buf := make([]types.Value, m.code.nslots+m.code.maxStack)
+		m.slots = buf[:m.code.nslots:m.code.nslots]
+		m.stack = buf[m.code.nslots:m.code.nslots]
+	}
+
+	code := m.code
+	if af := impl.argfmt; af != nil {
+		if af.Wildcard != "" {
+			m.slots[code.wildcard] = types.Value{
+				E: &types.Sexpr{List: params, Quoted: true},
+				T: types.TypeList,
+			}
+		} else {
+			varArgs := false
+			for i := range af.Args {
+				if i == code.varArgs {
+					varArgs = true
+					if len(params) > i && params[i].T.Basic() == "args" {
+						m.slots[code.argSlots[i]] = params[i]
+					} else {
+						m.slots[code.argSlots[i]] = types.Value{
+							E: &types.Sexpr{
+								Quoted: true,
+								List:   params[i:],
+							},
+							T: e.varArgsT,
+						}
+					}
+					break
+				}
+				if code.argSlots[i] >= 0 {
+					m.slots[code.argSlots[i]] = params[i]
+				}
+			}
+			if !varArgs && len(af.Args) != len(params) {
+				return nil, "", fmt.Errorf("Incorrect number of arguments to %v: expected %v, found %v", m.fi.name, len(af.Args), len(params))
+			}
+		}
+	}
+	if code.argsSlot >= 0 {
+		m.slots[code.argsSlot] = types.Value{
+			E: &types.Sexpr{List: params, Quoted: true},
+			T: types.TypeList,
+		}
+	}
+	for i, s := range code.posSlots {
+		if s >= 0 && i < len(params) {
+			m.slots[s] = params[i]
+		}
+	}
+	return nil, e.rt, nil
+}
+
+func (m *vmFrame) push(v types.Value) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *vmFrame) pop() types.Value {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+// popArgs moves n values from the stack into a new slice,
+// so callee can keep references to them.
+func (m *vmFrame) popArgs(n int) []types.Value {
+	args := make([]types.Value, n)
+	copy(args, m.stack[len(m.stack)-n:])
+	m.stack = m.stack[:len(m.stack)-n]
+	return args
+}
+
+func (m *vmFrame) run() (*types.Value, error) {
+	if m.code.native != nil {
+		return m.runNative()
+	}
+	pc := 0
+	for {
+		ins := m.code.instrs[pc]
+		pc++
+		switch ins.op {
+		case opConst:
+			m.push(m.code.consts[ins.a])
+		case opLoad:
+			m.load(ins.a, ins.b)
+		case opLoadName:
+			m.push(m.loadName(m.code.names[ins.a]))
+		case opStore:
+			m.slots[ins.a] = m.pop()
+		case opStoreScoped:
+			m.storeScoped(ins.a)
+		case opCast:
+			if err := m.cast(ins.a); err != nil {
+				return nil, err
+			}
+		case opPop:
+			m.pop()
+		case opJump:
+			pc = ins.a
+		case opJumpIfFalse, opJumpIfTrue:
+			cond, err := m.cond(ins.b)
+			if err != nil {
+				return nil, err
+			}
+			if cond == (ins.op == opJumpIfTrue) {
+				pc = ins.a
+			}
+		case opCall:
+			if err := m.call(ins.a, ins.b); err != nil {
+				return nil, m.callError(pc-1, err)
+			}
+		case opApply:
+			if err := m.apply(ins.a); err != nil {
+				return nil, m.callError(pc-1, err)
+			}
+		case opTailCall, opTailApply:
+			result, err := m.tailCall(ins.op == opTailApply, ins.b)
+			if err != nil {
+				return nil, m.callError(pc-1, err)
+			}
+			if result != nil {
+				return result, nil
+			}
+			if m.code.native != nil {
+				return m.runNative()
+			}
+			pc = 0
+		case opGen, opGenHashable:
+			if err := m.gen(ins.b, ins.op == opGenHashable); err != nil {
+				return nil, m.callError(pc-1, err)
+			}
+		case opLambda:
+			m.push(m.makeLambda(m.code.lambdas[ins.a]))
+		case opReturn:
+			return m.ret(), nil
+		default:
+			panic(fmt.Errorf("%v: unexpected instruction: %v", m.fi.name, ins))
+		}
+	}
+}
+
+// callError attaches position of the call instruction at pc to the error.
+func (m *vmFrame) callError(pc int, err error) error {
+	return m.fi.interpret.callError(m.code.calls[pc], err)
+}
+
+func (m *vmFrame) load(slot, name int) {
+	v := m.slots[slot]
+	if v.E == nil {
+		m.push(m.loadName(m.code.names[name]))
+	} else {
+		m.push(m.funcRef(v))
+	}
+}
+
+func (m *vmFrame) storeScoped(slot int) {
+	m.slots[slot] = m.pop()
+	m.scoped = append(m.scoped, slot)
+}
+
+func (m *vmFrame) cast(idx int) error {
+	top := &m.stack[len(m.stack)-1]
+	t := m.code.casts[idx].Expand(m.tps)
+	newT, err := m.fi.interpret.updateTypeCached(top.T, t)
+	if err != nil {
+		return withCode(codeCannotCast, fmt.Errorf("Cannot cast %v to %v: %v", top.T, t, err))
+	}
+	top.T = newT
+	return nil
+}
+
+// cond pops condition value (consts[src] is the condition source).
+func (m *vmFrame) cond(src int) (bool, error) {
+	v := m.pop()
+	cond, ok := v.E.(types.Bool)
+	if !ok {
+		return false, fmt.Errorf("Argument %v should evaluate to boolean value, actual %v", m.code.consts[src], v)
+	}
+	return bool(cond), nil
+}
+
+func (m *vmFrame) call(callee, nargs int) error {
+	fu, err := m.findFunc(&m.code.callees[callee])
+	if err != nil {
+		return err
+	}
+	res, err := fu.Eval(m.popArgs(nargs))
+	if err != nil {
+		return err
+	}
+	m.push(*res)
+	return nil
+}
+
+func (m *vmFrame) apply(callee int) error {
+	args, err := m.applyArgs(m.pop())
+	if err != nil {
+		return err
+	}
+	fu, err := m.findFunc(&m.code.callees[callee])
+	if err != nil {
+		return err
+	}
+	res, err := fu.Eval(args)
+	if err != nil {
+		return err
+	}
+	m.push(*res)
+	return nil
+}
+
+// tailCall binds function to new arguments.
+// It returns non-nil result if it is found in memo cache.
+func (m *vmFrame) tailCall(apply bool, nargs int) (*types.Value, error) {
+	var args []types.Value
+	if apply {
+		var err error
+		if args, err = m.applyArgs(m.pop()); err != nil {
+			return nil, err
+		}
+	} else {
+		args = m.popArgs(nargs)
+	}
+	result, _, err := m.bind(args)
+	return result, err
+}
+
+func (m *vmFrame) gen(nargs int, hashable bool) error {
+	args := m.popArgs(nargs)
+	fident, ok := args[0].E.(types.Ident)
+	if !ok {
+		return fmt.Errorf("gen expects first argument to be a funtion, found: %v", args[0])
+	}
+	fu, err := m.findFunc(&vmCallee{name: string(fident), slot: m.slotOf(string(fident))})
+	if err != nil {
+		return err
+	}
+	m.push(types.Value{E: NewLazyList(fu, args[1:], hashable), T: types.TypeList})
+	return nil
+}
+
+func (m *vmFrame) ret() *types.Value {
+	res := m.pop()
+	if m.memoImpl != nil {
+		m.memoImpl.RememberResult(m.fi.name, m.memoArgs, &res)
+	}
+	return &res
+}
+
+func (m *vmFrame) slotOf(name string) int {
+	if s, ok := m.code.slotOf[name]; ok {
+		return s
+	}
+	return -1
+}
+
+// loadName returns captured variable or identifier (e.g. function name).
+func (m *vmFrame) loadName(name string) types.Value {
+	if v, ok := m.fi.capturedVars[name]; ok {
+		return m.funcRef(*v)
+	}
+	return m.funcRef(types.Value{E: types.Ident(name), T: types.TypeUnknown})
+}
+
+// funcRef sets function type for values referencing functions.
+func (m *vmFrame) funcRef(v types.Value) types.Value {
+	id, ok := v.E.(types.Ident)
+	if !ok {
+		return v
+	}
+	if fe, ok := m.fi.interpret.funcs[string(id)]; ok {
+		if fi, ok := fe.(*FuncInterpret); ok {
+			v.T = fi.FuncType()
+		} else {
+			v.T = types.TypeFunc
+		}
+	}
+	return v
+}
+
+func (m *vmFrame) findFunc(c *vmCallee) (types.Function, error) {
+	var v *types.Value
+	if c.slot >= 0 && m.slots[c.slot].E != nil {
+		v = &m.slots[c.slot]
+	} else if cv, ok := m.fi.capturedVars[c.name]; ok {
+		v = cv
+	}
+	fname := c.name
+	if v != nil {
+		if v.T.Basic() != "func" && v.T != types.TypeUnknown {
+			return nil, fmt.Errorf("%v: incorrect type of '%v', expected :func, found: %v", m.fi.name, fname, v)
+		}
+		vident, ok := v.E.(types.Ident)
+		if !ok {
+			return nil, fmt.Errorf("%v: cannot use argument %v as function", m.fi.name, v)
+		}
+		fname = string(vident)
+	} else if c.fn != nil {
+		return c.fn, nil
+	}
+	fu, ok := m.fi.interpret.funcs[fname]
+	if !ok {
+		return nil, withCode(codeUnknownFunction, fmt.Errorf("%v: Unknown function: %v", m.fi.name, fname))
+	}
+	return fu, nil
+}
+
+func (m *vmFrame) applyArgs(v types.Value) ([]types.Value, error) {
+	lst, ok := v.E.(types.List)
+	if !ok {
+		return nil, fmt.Errorf("apply expects result to be a list of argument")
+	}
+	if se, ok := lst.(*types.Sexpr); ok {
+		args := make([]types.Value, 0, len(se.List))
+		for _, item := range se.List {
+			args = append(args, m.applyArg(item))
+		}
+		return args, nil
+	}
+	var args []types.Value
+	for !lst.Empty() {
+		h, err := lst.Head()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, m.applyArg(*h))
+		lst, err = lst.Tail()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// applyArg evaluates item of list passed to apply.
+func (m *vmFrame) applyArg(v types.Value) types.Value {
+	switch a := v.E.(type) {
+	case types.Ident:
+		if s := m.slotOf(string(a)); s >= 0 && m.slots[s].E != nil {
+			return m.funcRef(m.slots[s])
+		}
+		return m.loadName(string(a))
+	case *types.Sexpr:
+		return types.Value{E: a, T: types.TypeList}
+	case *LazyList:
+		return types.Value{E: a, T: types.TypeList}
+	}
+	return v
+}
+
+func (m *vmFrame) makeLambda(l *vmLambda) types.Value {
+	in := m.fi.interpret
+	name := in.NewLambdaName()
+	fi := NewFuncInterpret(in, name)
+	for i, n := range l.free {
+		if s := l.freeSlots[i]; s >= 0 && m.slots[s].E != nil {
+			v := m.slots[s]
+			fi.AddVar(n, &v)
+		} else if v, ok := m.fi.capturedVars[n]; ok {
+			fi.AddVar(n, v)
+		}
+	}
+	fi.AddImpl(nil, l.body, false, types.TypeUnknown)
+	if l.code != nil {
+		fi.bodies[0].code = l.code
+		fi.compiled = true
+	}
+	in.funcs[name] = fi
+	return types.Value{E: types.Ident(name), T: types.TypeFunc}
+}
+
+func (m *vmFrame) cleanup() {
+	for _, s := range m.scoped {
+		closeScoped(m.fi.interpret, m.slots[s])
+	}
+	m.scoped = m.scoped[:0]
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		compiled []string
+		skipped  []string
+	}{
+		{
+			"tail call",
+			`(def count (0) 0)
+(def count (n) (count (- n 1)))
+(print (count 10))`,
+			[]string{"count", "__main__"},
+			nil,
+		},
+		{
+			"lambda and gen",
+			`(use std)
+(def ints (n) (gen \(+ _1 1) n))
+(print (take 3 (ints 0)))`,
+			[]string{"ints"},
+			nil,
+		},
+		{
+			"head is not identifier",
+			`(def weird (f) ((f) 1))
+(print 1)`,
+			[]string{"__main__"},
+			[]string{"weird"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := NewInterpreter(ioutil.Discard)
+			if err := in.Parse("__test__", strings.NewReader(test.code)); err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			in.Compile()
+			for _, name := range test.compiled {
+				if !in.lookupFunc(t, name).compiled {
+					t.Errorf("Function %v is not compiled", name)
+				}
+			}
+			for _, name := range test.skipped {
+				if in.lookupFunc(t, name).compiled {
+					t.Errorf("Function %v should not be compiled", name)
+				}
+			}
+		})
+	}
+}
+
+func (in *Interpret) lookupFunc(t *testing.T, name string) *FuncInterpret {
+	if name == "__main__" {
+		return in.main
+	}
+	fi, ok := in.funcs[name].(*FuncInterpret)
+	if !ok {
+		t.Fatalf("Function not found: %v", name)
+	}
+	return fi
+}
+
+func benchmarkScript(b *testing.B, script string, vm bool) {
+	data, err := ioutil.ReadFile(script)
+	if err != nil {
+		b.Fatal(err)
+	}
+	file, err := filepath.Abs(script)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		in := NewInterpreter(ioutil.Discard)
+		if err := run(in, file, strings.NewReader(string(data)), vm); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPrimeVM(b *testing.B) {
+	benchmarkScript(b, "examples/ex.prime.lisp", true)
+}
+
+func BenchmarkPrimeTreeWalker(b *testing.B) {
+	benchmarkScript(b, "examples/ex.prime.lisp", false)
+}
+
+func BenchmarkTailCallVM(b *testing.B) {
+	benchmarkScript(b, "examples/ex.tail-call.lisp", true)
+}
+
+func BenchmarkTailCallTreeWalker(b *testing.B) {
+	benchmarkScript(b, "examples/ex.tail-call.lisp", false)
+}
+
+func BenchmarkLazyVM(b *testing.B) {
+	benchmarkScript(b, "examples/ex.prime-2.lisp", true)
+}
+
+func BenchmarkLazyTreeWalker(b *testing.B) {
+	benchmarkScript(b, "examples/ex.prime-2.lisp", false)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// "spil watch" checks the program again every time the program or modules it uses are modified.
+// Libraries are embedded into spil, so only files of the program are watched.
+
+func watchCommand(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	run := flags.Bool("run", false, "run the program after successful check")
+	interval := flags.Duration("interval", 500*time.Millisecond, "how often files are checked for modification")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: spil watch [-run] [-interval duration] file.lisp [args...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+	file, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	for {
+		// clear the screen
+		fmt.Fprint(os.Stdout, "\033[H\033[2J")
+		files := watchCheck(os.Stdout, file, flags.Args()[1:], *run)
+		fmt.Fprintf(os.Stdout, "Watching %d files, press Ctrl+C to stop.\n", len(files))
+		state := modTimes(files)
+		for !modified(state) {
+			time.Sleep(*interval)
+		}
+	}
+}
+
+// watchCheck parses, checks and optionally runs the program with fresh interpreter.
+// Diagnostics and output of the program are written into w.
+// It returns files of the program which should be watched.
+func watchCheck(w io.Writer, file string, args []string, run bool) []string {
+	in := NewInterpreter(w)
+	in.Stderr = w
+	in.UseBigInt(bigint)
+	in.PluginDir = pluginDir
+	in.IncludeDirs = searchDirs(in.PluginDir)
+
+	errs, warnings := func() ([]error, []error) {
+		f, err := os.Open(file)
+		if err != nil {
+			return []error{err}, nil
+		}
+		defer f.Close()
+		if err := in.Parse(file, f); err != nil {
+			return []error{err}, nil
+		}
+		return in.Check()
+	}()
+	for _, warn := range warnings {
+		fmt.Fprintf(w, "warning: %v\n", warn)
+	}
+	for _, err := range errs {
+		fmt.Fprintf(w, "%v\n", err)
+	}
+	if len(errs) > 0 {
+		return watchedFiles(in, file)
+	}
+	for _, warn := range in.Optimize() {
+		fmt.Fprintf(w, "warning: %v\n", warn)
+	}
+	if !run {
+		fmt.Fprintf(w, "%v: ok\n", displayName(file))
+		return watchedFiles(in, file)
+	}
+	if !noVM {
+		in.Compile()
+	}
+	if code := in.exitStatus(in.RunArgs(args)); code != 0 {
+		fmt.Fprintf(w, "%v: exit status %d\n", displayName(file), code)
+	}
+	return watchedFiles(in, file)
+}
+
+// watchedFiles returns the program file, modules it uses and project files.
+func watchedFiles(in *Interpret, file string) []string {
+	seen := map[string]bool{file: true}
+	files := []string{file}
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	var modules []string
+	for _, f := range in.usedModules {
+		modules = append(modules, f)
+	}
+	sort.Strings(modules)
+	for _, f := range modules {
+		add(f)
+	}
+	if in.manifest != nil {
+		add(in.manifest.file)
+		add(filepath.Join(in.manifest.root, lockName))
+	}
+	return files
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// modTimes returns modification times of files, missing files have zero state.
+func modTimes(files []string) map[string]fileState {
+	state := make(map[string]fileState)
+	for _, f := range files {
+		state[f] = statFile(f)
+	}
+	return state
+}
+
+// modified reports whether any file was changed, created or removed since the state was taken.
+func modified(state map[string]fileState) bool {
+	for f, s := range state {
+		if cur := statFile(f); !cur.modTime.Equal(s.modTime) || cur.size != s.size {
+			return true
+		}
+	}
+	return false
+}
+
+func statFile(file string) fileState {
+	st, err := os.Stat(file)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: st.ModTime(), size: st.Size()}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spil-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "main.lisp")
+	module := filepath.Join(dir, "inc.lisp")
+	write := func(file, code string) {
+		if err := ioutil.WriteFile(file, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(main, `(use "inc.lisp") (print (inc 1))`)
+	write(module, `(def inc (x:int) :int (+ x 1))`)
+
+	out := &bytes.Buffer{}
+	files := watchCheck(out, main, nil, false)
+	if exp := []string{main, module}; !reflect.DeepEqual(files, exp) {
+		t.Errorf("Incorrect watched files: expected %v, actual %v", exp, files)
+	}
+	if !strings.HasSuffix(out.String(), "main.lisp: ok\n") {
+		t.Errorf("Unexpected output of check: %q", out.String())
+	}
+
+	out.Reset()
+	watchCheck(out, main, nil, true)
+	if exp := "2\n"; out.String() != exp {
+		t.Errorf("Incorrect output of run: expected %q, actual %q", exp, out.String())
+	}
+
+	state := modTimes(files)
+	if modified(state) {
+		t.Errorf("Files are not modified yet")
+	}
+	write(module, `(def inc (x:int) :int "one")`)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(module, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if !modified(state) {
+		t.Errorf("Modification of module is not detected")
+	}
+
+	out.Reset()
+	watchCheck(out, main, nil, true)
+	if act := out.String(); !strings.Contains(act, "inc") || strings.Contains(act, "2\n") {
+		t.Errorf("Expected type error in inc without running the program, found %q", act)
+	}
+
+	state = modTimes(files)
+	if err := os.Remove(module); err != nil {
+		t.Fatal(err)
+	}
+	if !modified(state) {
+		t.Errorf("Removal of module is not detected")
+	}
+}